@@ -2,13 +2,12 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
-	"io/fs"
+	"log/slog"
 	"os"
-	"path/filepath"
-	"time"
 
 	"github.com/pkg/errors"
 	"github.com/planetscale/singer-tap/cmd/internal"
@@ -20,6 +19,8 @@ var (
 	bufferSize     int
 	apiToken       string
 	stateDirectory string
+	logFormat      string
+	logLevel       string
 )
 
 func init() {
@@ -28,13 +29,25 @@ func init() {
 	flag.StringVar(&apiToken, "api-token", "", "API Token to authenticate with Singer")
 	flag.StringVar(&stateDirectory, "state-directory", "state", "Directory to save any received state, default is state/")
 	flag.IntVar(&bufferSize, "buffer-size", 1024, "size of the buffer used to read lines from STDIN, default is 1024")
+	flag.StringVar(&logFormat, "log-format", "text", "format of the status messages written to stderr, one of text, json")
+	flag.StringVar(&logLevel, "log-level", "info", "minimum level of the status messages written to stderr, one of debug, info, warn, error")
 }
 
 func main() {
 	flag.Parse()
 
-	logger := internal.NewLogger("HTTP Tap", os.Stdout, os.Stderr)
-	err := execute(logger, singerAPIURL, batchSize, bufferSize, apiToken)
+	format, err := internal.ParseLogFormat(logFormat)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	level, err := internal.ParseLogLevel(logLevel)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	logger := internal.NewStructuredLogger("HTTP Tap", os.Stdout, os.Stderr, format, level)
+	err = execute(logger, singerAPIURL, batchSize, bufferSize, apiToken)
 	if err != nil {
 		logger.Error(err.Error())
 		os.Exit(1)
@@ -54,9 +67,10 @@ func execute(logger internal.Logger, apiUrl string, batchSize, bufferSize int, t
 	var stream *internal.Stream
 
 	recordCount := 0
-	batchWriter := internal.NewHttpRecordWriter(batchSize, apiUrl, apiToken, "", logger)
+	stateStore := internal.NewLocalStateStore(stateDirectory)
+	batchWriter := internal.NewHttpRecordWriter(context.Background(), batchSize, apiUrl, apiToken, stateStore, internal.StateRetention{}, logger)
 	for scanner.Scan() {
-		s, r, err := parseInput(scanner.Text(), logger)
+		s, r, err := parseInput(scanner.Text(), stateStore, logger)
 		if err != nil {
 			return errors.Wrap(err, "unable to process output from STDIN")
 		}
@@ -68,7 +82,7 @@ func execute(logger internal.Logger, apiUrl string, batchSize, bufferSize int, t
 					return err
 				}
 				if recordCount > 0 {
-					logger.Info(fmt.Sprintf("Published [%v] records for stream %q", recordCount, stream.Name))
+					logger.Info("Published records", slog.String(internal.StreamKey, stream.Name), slog.Int("records", recordCount))
 				}
 			}
 
@@ -90,12 +104,12 @@ func execute(logger internal.Logger, apiUrl string, batchSize, bufferSize int, t
 	}
 
 	if recordCount > 0 {
-		logger.Info(fmt.Sprintf("Published [%v] records for stream %q", recordCount, stream.Name))
+		logger.Info("Published records", slog.String(internal.StreamKey, stream.Name), slog.Int("records", recordCount))
 	}
 	return batchWriter.Flush(*stream)
 }
 
-func parseInput(input string, logger internal.Logger) (*internal.Stream, *internal.Record, error) {
+func parseInput(input string, stateStore internal.StateStore, logger internal.Logger) (*internal.Stream, *internal.Record, error) {
 	var (
 		m MessageType
 		s internal.Stream
@@ -119,43 +133,26 @@ func parseInput(input string, logger internal.Logger) (*internal.Stream, *intern
 		return nil, &r, nil
 	case "STATE":
 		// save state
-		return nil, nil, saveState(logger, input, stateDirectory)
+		return nil, nil, saveState(logger, input, stateStore)
 	}
 
 	return nil, nil, fmt.Errorf("unknown message type : %v ", m.Type)
 }
 
-func saveState(logger internal.Logger, input string, path string) error {
-	now := time.Now()
-
+func saveState(logger internal.Logger, input string, stateStore internal.StateStore) error {
 	var st internal.WrappedState
 
 	if err := json.Unmarshal([]byte(input), &st); err != nil {
 		return err
 	}
 
-	stateFileContents, err := json.Marshal(st.Value)
+	// the default state directory is state/, it is created if it doesn't exist yet.
+	checkpoint, err := stateStore.Save(context.Background(), st.Value)
 	if err != nil {
-		return err
-	}
-
-	// the default state directory is state/; create if it doesn't exist yet
-	if _, err := os.Stat(path); os.IsNotExist(err) {
-		logger.Info(fmt.Sprintf("creating state directory at: %v", path))
-		err := os.MkdirAll(path, fs.ModePerm)
-		if err != nil {
-			logger.Error(fmt.Sprintf("unable to create state directory at: %v", path))
-			return errors.Wrap(err, "unable to create state directory")
-		}
-	}
-
-	statePath := filepath.Join(path, fmt.Sprintf("state-%v.json", now.UnixMilli()))
-	logger.Info(fmt.Sprintf("saving state to path : %v", statePath))
-
-	if err := os.WriteFile(statePath, stateFileContents, fs.ModePerm); err != nil {
-		logger.Error(fmt.Sprintf("unable to save state to path %v", statePath))
+		logger.Error("unable to save state", slog.String("location", stateStore.String()), slog.String(internal.ErrorKey, err.Error()))
 		return errors.Wrap(err, "unable to save state")
 	}
+	logger.Info("saved state", slog.String("location", stateStore.String()), slog.String("checkpoint", checkpoint.ID))
 	return nil
 }
 
@@ -0,0 +1,263 @@
+package internal
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	psdbconnect "github.com/planetscale/airbyte-source/proto/psdbconnect/v1alpha1"
+	"vitess.io/vitess/go/sqltypes"
+)
+
+// tailReconnectDelay is how long to wait before reading a shard again after its stream was closed.
+var tailReconnectDelay = 5 * time.Second
+
+// streamTail reads changes to incrementally synced streams from all shards at once, as they happen.
+// Rows from all shards are written through one record writer, so every callback holds mu.
+type streamTail struct {
+	edgeDatabase PlanetScaleDatabase
+	logger       Logger
+	source       PlanetScaleSource
+	filters      map[string]*RowFilter
+	transformers map[string]*RecordTransformer
+	recordWriter RecordWriter
+	settings     SyncSettings
+	lagGuard     *replicaLagGuard
+
+	mu     sync.Mutex
+	state  *State
+	report *SyncReport
+	// buffered is the stream whose records are buffered in the record writer,
+	// record writers only buffer records of one stream at a time.
+	buffered  *Stream
+	lastState time.Time
+}
+
+// run reads every incrementally synced stream from every shard until ctx is canceled,
+// which is a clean shutdown, or until reading from a shard fails.
+func (t *streamTail) run(ctx context.Context, streams []Stream) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	t.state.CurrentlySyncing = ""
+	t.lastState = time.Now()
+	t.settings.Health.setStatus(HealthStatusStreaming)
+
+	var (
+		wg       sync.WaitGroup
+		failOnce sync.Once
+		failure  error
+	)
+	// list the shards before any are read, reading a shard updates the state.
+	type streamShard struct {
+		stream Stream
+		shard  string
+	}
+	var shards []streamShard
+	for _, stream := range streams {
+		if !stream.IncrementalSyncRequested() {
+			t.logger.Info("stream is not synced incrementally, it will not be read continuously", slog.String(StreamKey, stream.Name))
+			continue
+		}
+		for shard := range t.state.Streams[stream.Name].Shards {
+			shards = append(shards, streamShard{stream: stream, shard: shard})
+		}
+	}
+
+	for _, ss := range shards {
+		t.logger.Info("reading changes to stream continuously", slog.String(StreamKey, ss.stream.Name), slog.String(ShardKey, ss.shard))
+		wg.Add(1)
+		go func(stream Stream, shard string) {
+			defer wg.Done()
+			if err := t.tailShard(ctx, stream, shard); err != nil {
+				failOnce.Do(func() {
+					failure = err
+					cancel()
+				})
+			}
+		}(ss.stream, ss.shard)
+	}
+
+	if t.settings.HeartbeatInterval > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := t.heartbeat(ctx); err != nil {
+				failOnce.Do(func() {
+					failure = err
+					cancel()
+				})
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.flush(); err != nil && failure == nil {
+		failure = err
+	}
+	return failure
+}
+
+func (t *streamTail) tailShard(ctx context.Context, stream Stream, shard string) error {
+	filter := t.filters[stream.Name]
+	transformer := t.transformers[stream.Name]
+	emittedStream := transformer.Schema(stream)
+
+	t.mu.Lock()
+	cursor := t.state.Streams[stream.Name].Shards[shard]
+	tc, err := cursor.SerializedCursorToTableCursor()
+	if err != nil {
+		t.mu.Unlock()
+		return err
+	}
+	streamReport := t.report.stream(stream.Name)
+	shardReport := streamReport.AddShard(shard, tc.Position)
+	t.mu.Unlock()
+
+	lastPosition := tc.Position
+	rowsSinceCheckpoint := 0
+	lastCheckpoint := time.Now()
+	onResult := func(sqlResult *sqltypes.Result) error {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		t.settings.Health.event()
+		if t.buffered != nil && t.buffered.Name != emittedStream.Name {
+			if err := t.flush(); err != nil {
+				return err
+			}
+		}
+		t.buffered = &emittedStream
+		rowsSinceCheckpoint += len(sqlResult.Rows)
+		emitted, err := printQueryResult(sqlResult, stream, emittedStream, filter, transformer, t.recordWriter)
+		streamReport.AddRows(shardReport, emitted, len(sqlResult.Rows)-emitted)
+		return err
+	}
+
+	onCursor := func(cursor *psdbconnect.TableCursor) error {
+		sc, err := TableCursorToSerializedCursor(cursor)
+		if err != nil {
+			return err
+		}
+
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		t.settings.Health.event()
+		lastPosition = cursor.Position
+		t.state.Streams[stream.Name].Shards[shard] = sc
+		if !t.settings.checkpointDue(rowsSinceCheckpoint, time.Since(lastCheckpoint)) {
+			return nil
+		}
+		if err := t.emitState(); err != nil {
+			return err
+		}
+		shardReport.Checkpoints++
+		rowsSinceCheckpoint = 0
+		lastCheckpoint = time.Now()
+		return nil
+	}
+
+	for {
+		// replication lag is checked again every time the shard is read, including after reconnecting.
+		route, _, err := t.lagGuard.check(ctx, shard)
+		if err != nil {
+			shardReport.Finish(lastPosition, err)
+			return err
+		}
+		newCursor, err := t.edgeDatabase.Read(ctx, ReadParams{
+			Source:            t.source,
+			Table:             stream,
+			LastKnownPosition: tc,
+			Columns:           readColumns(stream, filter),
+			OnResult:          onResult,
+			OnCursor:          onCursor,
+			TabletType:        route.TabletType,
+			Cells:             route.Cells,
+			Continuous:        true,
+		})
+		if ctx.Err() != nil {
+			shardReport.Status = ReadStatusInterrupted
+			shardReport.Reason = "shut down"
+			shardReport.Finish(lastPosition, nil)
+			return nil
+		}
+		if err != nil {
+			shardReport.Finish(lastPosition, err)
+			return err
+		}
+
+		// the stream was closed by the server, resume reading from where it stopped.
+		t.mu.Lock()
+		if newCursor != nil {
+			t.state.Streams[stream.Name].Shards[shard] = newCursor
+		}
+		tc, err = t.state.Streams[stream.Name].Shards[shard].SerializedCursorToTableCursor()
+		t.mu.Unlock()
+		if err != nil {
+			shardReport.Finish(lastPosition, err)
+			return err
+		}
+		t.logger.Warn("stream was closed, reconnecting", slog.String(StreamKey, stream.Name), slog.String(ShardKey, shard), slog.String(PositionKey, tc.Position))
+
+		select {
+		case <-ctx.Done():
+			shardReport.Finish(lastPosition, nil)
+			return nil
+		case <-time.After(tailReconnectDelay):
+		}
+	}
+}
+
+// heartbeat emits the state whenever no state has been emitted for the heartbeat interval,
+// so that the position of idle streams keeps moving forward.
+func (t *streamTail) heartbeat(ctx context.Context) error {
+	ticker := time.NewTicker(t.settings.HeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		t.mu.Lock()
+		var err error
+		if time.Since(t.lastState) >= t.settings.HeartbeatInterval {
+			t.logger.Debug("emitting state on heartbeat")
+			err = t.emitState()
+		}
+		t.mu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// flush writes out the buffered records, t.mu must be held.
+func (t *streamTail) flush() error {
+	if t.buffered == nil {
+		return nil
+	}
+	if err := t.recordWriter.Flush(*t.buffered); err != nil {
+		return errors.Wrap(err, "unable to flush records")
+	}
+	t.buffered = nil
+	return nil
+}
+
+// emitState flushes the buffered records and emits the state that includes them, t.mu must be held.
+func (t *streamTail) emitState() error {
+	if err := t.flush(); err != nil {
+		return err
+	}
+	if err := t.recordWriter.State(*t.state); err != nil {
+		return errors.Wrap(err, "unable to serialize state")
+	}
+	t.lastState = time.Now()
+	t.settings.Health.stateEmitted()
+	return nil
+}
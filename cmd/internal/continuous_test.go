@@ -0,0 +1,135 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	psdbconnect "github.com/planetscale/airbyte-source/proto/psdbconnect/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func getContinuousCatalog() Catalog {
+	catalog := getVerifyCatalog()
+	catalog.Streams[0].Metadata[0].Metadata.ReplicationMethod = "INCREMENTAL"
+	return catalog
+}
+
+func getContinuousCursor(position string) *psdbconnect.TableCursor {
+	return &psdbconnect.TableCursor{Shard: "-", Keyspace: "employees", Position: position}
+}
+
+func TestSync_ReadsChangesContinuouslyUntilCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ped := &testPlanetScaleEdgeDatabase{
+		ReadParamsFn: func(ctx context.Context, params ReadParams) (*SerializedCursor, error) {
+			if !params.Continuous {
+				if err := params.OnResult(getVerifyResult("10001|Georgi")); err != nil {
+					return nil, err
+				}
+				return TableCursorToSerializedCursor(getContinuousCursor("MySQL56/e42292e8-e28f-11ec-9c5b-d680f5d655b3:1-1"))
+			}
+
+			assert.Equal(t, "MySQL56/e42292e8-e28f-11ec-9c5b-d680f5d655b3:1-1", params.LastKnownPosition.Position)
+			if err := params.OnResult(getVerifyResult("10002|Bezalel")); err != nil {
+				return nil, err
+			}
+			if err := params.OnCursor(getContinuousCursor("MySQL56/e42292e8-e28f-11ec-9c5b-d680f5d655b3:1-2")); err != nil {
+				return nil, err
+			}
+			cancel()
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+	}
+	health := NewHealth()
+	writer := &eventRecordWriter{}
+
+	report, err := Sync(ctx, getTestMysqlAccess(), ped, &testSingerLogger{}, PlanetScaleSource{Database: "employees"}, getContinuousCatalog(), nil, writer, SyncSettings{Continuous: true, Health: health})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"flush 1", "state", "flush 1", "state"}, writer.events, "records read continuously should be flushed before the final state")
+
+	tc, err := writer.states[1].Streams["employees"].Shards["-"].SerializedCursorToTableCursor()
+	require.NoError(t, err)
+	assert.Equal(t, "MySQL56/e42292e8-e28f-11ec-9c5b-d680f5d655b3:1-2", tc.Position)
+
+	require.Len(t, report.Streams, 1)
+	assert.Equal(t, 2, report.Streams[0].RowsEmitted)
+	require.Len(t, report.Streams[0].Shards, 2)
+	assert.Equal(t, ReadStatusInterrupted, report.Streams[0].Shards[1].Status)
+	assert.Equal(t, HealthStatusStopped, health.status)
+}
+
+func TestSync_EmitsStateOnHeartbeat(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ped := &testPlanetScaleEdgeDatabase{
+		ReadParamsFn: func(ctx context.Context, params ReadParams) (*SerializedCursor, error) {
+			if !params.Continuous {
+				return TableCursorToSerializedCursor(params.LastKnownPosition)
+			}
+			// no changes happen while the stream is read.
+			time.Sleep(100 * time.Millisecond)
+			cancel()
+			return nil, ctx.Err()
+		},
+	}
+	writer := &eventRecordWriter{}
+
+	_, err := Sync(ctx, getTestMysqlAccess(), ped, &testSingerLogger{}, PlanetScaleSource{Database: "employees"}, getContinuousCatalog(), nil, writer, SyncSettings{Continuous: true, HeartbeatInterval: 10 * time.Millisecond})
+	require.NoError(t, err)
+	assert.Greater(t, len(writer.states), 2, "state should be emitted on heartbeats while streams are idle")
+}
+
+func TestSync_ReconnectsWhenContinuousReadEnds(t *testing.T) {
+	defer func(delay time.Duration) { tailReconnectDelay = delay }(tailReconnectDelay)
+	tailReconnectDelay = 0
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var positions []string
+	ped := &testPlanetScaleEdgeDatabase{
+		ReadParamsFn: func(ctx context.Context, params ReadParams) (*SerializedCursor, error) {
+			if !params.Continuous {
+				return TableCursorToSerializedCursor(params.LastKnownPosition)
+			}
+			positions = append(positions, params.LastKnownPosition.Position)
+			if len(positions) == 1 {
+				// the server closed the stream.
+				return TableCursorToSerializedCursor(getContinuousCursor("MySQL56/e42292e8-e28f-11ec-9c5b-d680f5d655b3:1-5"))
+			}
+			cancel()
+			return nil, ctx.Err()
+		},
+	}
+
+	_, err := Sync(ctx, getTestMysqlAccess(), ped, &testSingerLogger{}, PlanetScaleSource{Database: "employees"}, getContinuousCatalog(), nil, &eventRecordWriter{}, SyncSettings{Continuous: true})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"", "MySQL56/e42292e8-e28f-11ec-9c5b-d680f5d655b3:1-5"}, positions)
+}
+
+func TestHealth_ServesStatus(t *testing.T) {
+	health := NewHealth()
+	health.setStatus(HealthStatusStreaming)
+	health.stateEmitted()
+
+	w := httptest.NewRecorder()
+	health.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var report healthReport
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+	assert.Equal(t, HealthStatusStreaming, report.Status)
+	assert.NotNil(t, report.LastStateAt)
+	assert.Nil(t, report.LastEventAt)
+
+	health.stop(assert.AnError)
+	w = httptest.NewRecorder()
+	health.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Contains(t, w.Body.String(), assert.AnError.Error())
+}
@@ -0,0 +1,359 @@
+package internal
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	psdbconnect "github.com/planetscale/airbyte-source/proto/psdbconnect/v1alpha1"
+	"github.com/planetscale/psdb/core/codec"
+	"vitess.io/vitess/go/sqltypes"
+	querypb "vitess.io/vitess/go/vt/proto/query"
+)
+
+// copyBatchSize is the number of rows selected at once while copying a chunk of a table.
+var copyBatchSize = 10000
+
+// TableCopy is the progress of copying a table in chunks, before changes to it are read.
+type TableCopy struct {
+	// Positions are the positions of every shard when the copy started,
+	// changes to the table are read from these positions once all chunks are copied.
+	Positions map[string]string `json:"positions"`
+	Chunks    []*CopyChunk      `json:"chunks"`
+}
+
+// CopyChunk is a range of values of the first key column of a table, which is copied on its own.
+// Key values are serialized in the same way as cursors.
+type CopyChunk struct {
+	// From is the value the chunk starts at, empty for the first chunk.
+	From string `json:"from,omitempty"`
+	// Before is the value the next chunk starts at, empty for the last chunk.
+	Before string `json:"before,omitempty"`
+	// After is the key of the last row copied from the chunk, empty if no rows were copied yet.
+	After string `json:"after,omitempty"`
+	Done  bool   `json:"done,omitempty"`
+}
+
+// shouldCopyInChunks reports whether the initial copy of a stream should be split into chunks,
+// which is only possible if it has key properties and none of its shards have been read yet.
+func shouldCopyInChunks(stream Stream, shards map[string]*SerializedCursor, settings SyncSettings) bool {
+	if copyChunks(stream, settings) < 2 || len(stream.KeyProperties) == 0 {
+		return false
+	}
+	for _, cursor := range shards {
+		tc, err := cursor.SerializedCursorToTableCursor()
+		if err != nil || len(tc.Position) > 0 || tc.LastKnownPk != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func copyChunks(stream Stream, settings SyncSettings) int {
+	if chunks := streamMetadata(stream).CopyChunks; chunks > 0 {
+		return chunks
+	}
+	return settings.CopyChunks
+}
+
+// copyTable copies all rows of a stream's table in chunks that are read at the same time,
+// then sets the state of every shard to the position it was at before the copy started,
+// so that changes made during the copy are read afterwards.
+// A copy that was interrupted continues from the progress saved in the state.
+func copyTable(ctx context.Context, mysqlDatabase PlanetScaleEdgeMysqlAccess, edgeDatabase PlanetScaleDatabase, logger Logger, source PlanetScaleSource, stream Stream, filter *RowFilter, transformer *RecordTransformer, state *State, recordWriter RecordWriter, settings SyncSettings, streamReport *StreamReport, lagGuard *replicaLagGuard) error {
+	started := time.Now()
+	tableCopy := state.Copies[stream.Name]
+	if tableCopy == nil {
+		var err error
+		tableCopy, err = startCopy(ctx, mysqlDatabase, edgeDatabase, source, stream, state.Streams[stream.Name].Shards, copyChunks(stream, settings), lagGuard)
+		if err != nil {
+			return err
+		}
+		if state.Copies == nil {
+			state.Copies = map[string]*TableCopy{}
+		}
+		state.Copies[stream.Name] = tableCopy
+		if err := recordWriter.State(*state); err != nil {
+			return errors.Wrap(err, "unable to serialize state")
+		}
+	}
+
+	report := &CopyReport{Chunks: len(tableCopy.Chunks)}
+	streamReport.Copy = report
+	logger.Info("copying table in chunks", slog.String(StreamKey, stream.Name), slog.Int("chunks", len(tableCopy.Chunks)))
+
+	emittedStream := transformer.Schema(stream)
+	copier := &chunkCopier{
+		mysqlDatabase: mysqlDatabase,
+		logger:        logger,
+		source:        source,
+		stream:        stream,
+		emittedStream: emittedStream,
+		filter:        filter,
+		transformer:   transformer,
+		recordWriter:  recordWriter,
+		settings:      settings,
+		state:         state,
+		streamReport:  streamReport,
+		report:        report,
+		lastState:     time.Now(),
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		wg       sync.WaitGroup
+		failOnce sync.Once
+		failure  error
+	)
+	for i, chunk := range tableCopy.Chunks {
+		if chunk.Done {
+			report.ChunksCopied++
+			continue
+		}
+		wg.Add(1)
+		go func(i int, chunk *CopyChunk) {
+			defer wg.Done()
+			if err := copier.copyChunk(ctx, chunk); err != nil {
+				failOnce.Do(func() {
+					failure = errors.Wrapf(err, "unable to copy chunk %v of stream %v", i, stream.Name)
+					cancel()
+				})
+			}
+		}(i, chunk)
+	}
+	wg.Wait()
+	report.DurationSeconds = time.Since(started).Seconds()
+	if failure != nil {
+		return failure
+	}
+
+	// read changes made while the table was copied from the positions the copy started at.
+	shards := make(map[string]*SerializedCursor, len(tableCopy.Positions))
+	for shard, position := range tableCopy.Positions {
+		cursor, err := TableCursorToSerializedCursor(&psdbconnect.TableCursor{
+			Shard:    shard,
+			Keyspace: source.Database,
+			Position: position,
+		})
+		if err != nil {
+			return err
+		}
+		shards[shard] = cursor
+	}
+	state.Streams[stream.Name] = ShardStates{Shards: shards}
+	delete(state.Copies, stream.Name)
+	if len(state.Copies) == 0 {
+		state.Copies = nil
+	}
+
+	if err := recordWriter.Flush(emittedStream); err != nil {
+		return errors.Wrap(err, "unable to flush records")
+	}
+	if err := recordWriter.State(*state); err != nil {
+		return errors.Wrap(err, "unable to serialize state")
+	}
+	logger.Info("copied table", slog.String(StreamKey, stream.Name), slog.Int("rows", report.RowsEmitted))
+	return nil
+}
+
+// startCopy records the position of every shard and splits the table into chunks.
+func startCopy(ctx context.Context, mysqlDatabase PlanetScaleEdgeMysqlAccess, edgeDatabase PlanetScaleDatabase, source PlanetScaleSource, stream Stream, shards map[string]*SerializedCursor, chunks int, lagGuard *replicaLagGuard) (*TableCopy, error) {
+	tableCopy := &TableCopy{Positions: make(map[string]string, len(shards))}
+	for shard := range shards {
+		route, _, err := lagGuard.check(ctx, shard)
+		if err != nil {
+			return nil, err
+		}
+		position, err := edgeDatabase.LatestPosition(ctx, ReadParams{
+			Source:            source,
+			Table:             stream,
+			LastKnownPosition: &psdbconnect.TableCursor{Shard: shard, Keyspace: source.Database},
+			TabletType:        route.TabletType,
+			Cells:             route.Cells,
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to get position of shard %v before copying stream %v", shard, stream.Name)
+		}
+		if len(position) == 0 {
+			return nil, errors.Errorf("unable to get position of shard %v before copying stream %v", shard, stream.Name)
+		}
+		tableCopy.Positions[shard] = position
+	}
+
+	boundaries, err := mysqlDatabase.GetKeyBoundaries(ctx, source, stream.tableName(), stream.KeyProperties[0], chunks)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to split stream %v into chunks", stream.Name)
+	}
+
+	var from string
+	for _, boundary := range boundaries {
+		before, err := encodeKey([]sqltypes.Value{boundary})
+		if err != nil {
+			return nil, err
+		}
+		tableCopy.Chunks = append(tableCopy.Chunks, &CopyChunk{From: from, Before: before})
+		from = before
+	}
+	tableCopy.Chunks = append(tableCopy.Chunks, &CopyChunk{From: from})
+	return tableCopy, nil
+}
+
+// chunkCopier copies chunks of a table at the same time,
+// every chunk writes through the same record writer and state, so they hold mu.
+type chunkCopier struct {
+	mysqlDatabase PlanetScaleEdgeMysqlAccess
+	logger        Logger
+	source        PlanetScaleSource
+	stream        Stream
+	// emittedStream is the stream as transformed by the transformer, which its records are written with.
+	emittedStream Stream
+	filter        *RowFilter
+	transformer   *RecordTransformer
+	recordWriter  RecordWriter
+	settings      SyncSettings
+
+	mu           sync.Mutex
+	state        *State
+	streamReport *StreamReport
+	report       *CopyReport
+	rows         int
+	lastState    time.Time
+}
+
+func (c *chunkCopier) copyChunk(ctx context.Context, chunk *CopyChunk) error {
+	c.mu.Lock()
+	from, fErr := decodeKey(chunk.From)
+	before, bErr := decodeKey(chunk.Before)
+	after, aErr := decodeKey(chunk.After)
+	c.mu.Unlock()
+	for _, err := range []error{fErr, bErr, aErr} {
+		if err != nil {
+			return err
+		}
+	}
+
+	columns := readColumns(c.stream, c.filter)
+	for _, key := range c.stream.KeyProperties {
+		if !contains(columns, key) {
+			columns = append(columns, key)
+		}
+	}
+	var where string
+	if c.filter != nil {
+		where = c.filter.SQL()
+	}
+
+	for {
+		qr, err := c.mysqlDatabase.GetTableRows(ctx, c.source, TableRowsQuery{
+			Table:      c.stream.tableName(),
+			Columns:    columns,
+			KeyColumns: c.stream.KeyProperties,
+			From:       from,
+			Before:     before,
+			After:      after,
+			Where:      where,
+			Limit:      copyBatchSize,
+		})
+		if err != nil {
+			return err
+		}
+		if err := c.settings.Throttle.wait(ctx, c.stream, qr); err != nil {
+			return err
+		}
+
+		done := len(qr.Rows) < copyBatchSize
+		if len(qr.Rows) > 0 {
+			after = keyValues(qr, len(qr.Rows)-1, c.stream.KeyProperties)
+		}
+		if err := c.copied(qr, chunk, after, done); err != nil {
+			return err
+		}
+		if done {
+			return nil
+		}
+	}
+}
+
+// copied writes the rows copied from a chunk and records its progress.
+func (c *chunkCopier) copied(qr *sqltypes.Result, chunk *CopyChunk, after []sqltypes.Value, done bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	emitted, err := printQueryResult(qr, c.stream, c.emittedStream, c.filter, c.transformer, c.recordWriter)
+	if err != nil {
+		return err
+	}
+	dropped := len(qr.Rows) - emitted
+	c.report.RowsEmitted += emitted
+	c.report.RowsDropped += dropped
+	c.streamReport.RowsEmitted += emitted
+	c.streamReport.RowsDropped += dropped
+	c.rows += len(qr.Rows)
+
+	if len(after) > 0 {
+		chunk.After, err = encodeKey(after)
+		if err != nil {
+			return err
+		}
+	}
+	if done {
+		chunk.Done = true
+		c.report.ChunksCopied++
+		c.logger.Debug("copied chunk", slog.String(StreamKey, c.stream.Name), slog.Int("chunks_copied", c.report.ChunksCopied))
+	}
+
+	if !c.settings.checkpointDue(c.rows, time.Since(c.lastState)) {
+		return nil
+	}
+	// records must be flushed before the state that includes them is emitted.
+	if err := c.recordWriter.Flush(c.emittedStream); err != nil {
+		return errors.Wrap(err, "unable to flush records")
+	}
+	if err := c.recordWriter.State(*c.state); err != nil {
+		return errors.Wrap(err, "unable to serialize state")
+	}
+	c.report.Checkpoints++
+	c.rows = 0
+	c.lastState = time.Now()
+	return nil
+}
+
+// encodeKey serializes key values, along with their types, so that they can be saved in state.
+func encodeKey(values []sqltypes.Value) (string, error) {
+	if len(values) == 0 {
+		return "", nil
+	}
+	result := &sqltypes.Result{Rows: [][]sqltypes.Value{values}}
+	for i, v := range values {
+		result.Fields = append(result.Fields, &querypb.Field{Name: fmt.Sprintf("key%v", i), Type: v.Type()})
+	}
+	b, err := codec.DefaultCodec.Marshal(sqltypes.ResultToProto3(result))
+	if err != nil {
+		return "", errors.Wrap(err, "unable to serialize key")
+	}
+	return base64.StdEncoding.EncodeToString(b), nil
+}
+
+func decodeKey(s string) ([]sqltypes.Value, error) {
+	if len(s) == 0 {
+		return nil, nil
+	}
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to decode key")
+	}
+	var qr querypb.QueryResult
+	if err := codec.DefaultCodec.Unmarshal(b, &qr); err != nil {
+		return nil, errors.Wrap(err, "unable to deserialize key")
+	}
+	result := sqltypes.Proto3ToResult(&qr)
+	if len(result.Rows) != 1 {
+		return nil, errors.New("unable to deserialize key")
+	}
+	return result.Rows[0], nil
+}
@@ -0,0 +1,238 @@
+package internal
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"vitess.io/vitess/go/sqltypes"
+)
+
+// getCopyMysqlAccess returns a mysql mock that pages through the given rows, ordered by emp_no,
+// within the bounds of each query, and splits them before the given boundaries.
+func getCopyMysqlAccess(t *testing.T, boundaries []int64, rows ...string) (*mysqlAccessMock, *[]TableRowsQuery) {
+	all := getVerifyResult(rows...)
+	var (
+		mu      sync.Mutex
+		queries []TableRowsQuery
+	)
+	tma := getTestMysqlAccess()
+	tma.GetKeyBoundariesFn = func(ctx context.Context, psc PlanetScaleSource, table, column string, chunks int) ([]sqltypes.Value, error) {
+		assert.Equal(t, "emp_no", column)
+		assert.Equal(t, len(boundaries)+1, chunks)
+		var values []sqltypes.Value
+		for _, b := range boundaries {
+			values = append(values, sqltypes.NewInt64(b))
+		}
+		return values, nil
+	}
+	tma.GetTableRowsFn = func(ctx context.Context, psc PlanetScaleSource, query TableRowsQuery) (*sqltypes.Result, error) {
+		mu.Lock()
+		queries = append(queries, query)
+		mu.Unlock()
+
+		bound := func(values []sqltypes.Value) (int64, bool) {
+			if len(values) == 0 {
+				return 0, false
+			}
+			v, err := values[0].ToInt64()
+			require.NoError(t, err)
+			return v, true
+		}
+		qr := &sqltypes.Result{Fields: all.Fields}
+		for _, row := range all.Rows {
+			current, _ := row[0].ToInt64()
+			if from, ok := bound(query.From); ok && current < from {
+				continue
+			}
+			if before, ok := bound(query.Before); ok && current >= before {
+				continue
+			}
+			if after, ok := bound(query.After); ok && current <= after {
+				continue
+			}
+			if len(qr.Rows) == query.Limit {
+				break
+			}
+			qr.Rows = append(qr.Rows, row)
+		}
+		return qr, nil
+	}
+	return tma, &queries
+}
+
+func TestSync_CopiesTableInChunksBeforeReadingChanges(t *testing.T) {
+	copyBatchSize = 2
+	defer func() { copyBatchSize = 10000 }()
+
+	tma, queries := getCopyMysqlAccess(t, []int64{3}, "1|a", "2|b", "3|c", "4|d", "5|e")
+	var readFrom []string
+	ped := &testPlanetScaleEdgeDatabase{
+		LatestPositionFn: func(ctx context.Context, params ReadParams) (string, error) {
+			return "MySQL56/e42292e8-e28f-11ec-9c5b-d680f5d655b3:1-10", nil
+		},
+		ReadParamsFn: func(ctx context.Context, params ReadParams) (*SerializedCursor, error) {
+			assert.Nil(t, params.LastKnownPosition.LastKnownPk, "rows should not be copied again")
+			readFrom = append(readFrom, params.LastKnownPosition.Position)
+			return TableCursorToSerializedCursor(params.LastKnownPosition)
+		},
+	}
+
+	rw := &eventRecordWriter{}
+	report, err := Sync(context.Background(), tma, ped, &testSingerLogger{}, PlanetScaleSource{Database: "employees"}, getContinuousCatalog(), nil, rw, SyncSettings{CopyChunks: 2})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"MySQL56/e42292e8-e28f-11ec-9c5b-d680f5d655b3:1-10"}, readFrom)
+	require.NotNil(t, report.stream("employees").Copy)
+	assert.Equal(t, 2, report.stream("employees").Copy.Chunks)
+	assert.Equal(t, 2, report.stream("employees").Copy.ChunksCopied)
+	assert.Equal(t, 5, report.stream("employees").Copy.RowsEmitted)
+	assert.Equal(t, 5, report.stream("employees").RowsEmitted)
+
+	for _, query := range *queries {
+		assert.Equal(t, []string{"emp_no"}, query.KeyColumns)
+		assert.True(t, len(query.From) > 0 || len(query.Before) > 0, "every query should be bounded to a chunk")
+	}
+
+	// the first state records the chunks, the last has no copy left and starts at the copy's position.
+	require.NotEmpty(t, rw.states)
+	require.Contains(t, rw.states[0].Copies, "employees")
+	assert.Len(t, rw.states[0].Copies["employees"].Chunks, 2)
+	last := rw.states[len(rw.states)-1]
+	assert.Empty(t, last.Copies)
+	tc, err := last.Streams["employees"].Shards["-"].SerializedCursorToTableCursor()
+	require.NoError(t, err)
+	assert.Equal(t, "MySQL56/e42292e8-e28f-11ec-9c5b-d680f5d655b3:1-10", tc.Position)
+}
+
+func TestSync_ResumesInterruptedTableCopy(t *testing.T) {
+	tma, queries := getCopyMysqlAccess(t, nil, "1|a", "2|b", "3|c", "4|d", "5|e")
+	tma.GetKeyBoundariesFn = func(ctx context.Context, psc PlanetScaleSource, table, column string, chunks int) ([]sqltypes.Value, error) {
+		t.Error("should not split a table whose copy was started")
+		return nil, nil
+	}
+	ped := &testPlanetScaleEdgeDatabase{
+		LatestPositionFn: func(ctx context.Context, params ReadParams) (string, error) {
+			t.Error("should not get new positions for a table whose copy was started")
+			return "", nil
+		},
+		ReadParamsFn: func(ctx context.Context, params ReadParams) (*SerializedCursor, error) {
+			assert.Equal(t, "MySQL56/e42292e8-e28f-11ec-9c5b-d680f5d655b3:1-10", params.LastKnownPosition.Position)
+			return TableCursorToSerializedCursor(params.LastKnownPosition)
+		},
+	}
+
+	three, err := encodeKey([]sqltypes.Value{sqltypes.NewInt64(3)})
+	require.NoError(t, err)
+	four, err := encodeKey([]sqltypes.Value{sqltypes.NewInt64(4)})
+	require.NoError(t, err)
+	start, err := TableCursorToSerializedCursor(getContinuousCursor(""))
+	require.NoError(t, err)
+	state := &State{
+		Streams: map[string]ShardStates{"employees": {Shards: map[string]*SerializedCursor{"-": start}}},
+		Copies: map[string]*TableCopy{
+			"employees": {
+				Positions: map[string]string{"-": "MySQL56/e42292e8-e28f-11ec-9c5b-d680f5d655b3:1-10"},
+				Chunks: []*CopyChunk{
+					{Before: three, Done: true},
+					{From: three, After: four},
+				},
+			},
+		},
+	}
+
+	report, err := Sync(context.Background(), tma, ped, &testSingerLogger{}, PlanetScaleSource{Database: "employees"}, getContinuousCatalog(), state, &eventRecordWriter{}, SyncSettings{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, report.stream("employees").RowsEmitted)
+	require.Len(t, *queries, 1)
+	after, err := (*queries)[0].After[0].ToInt64()
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), after)
+}
+
+func TestEncodeKey_KeepsTypes(t *testing.T) {
+	key := []sqltypes.Value{sqltypes.NewInt64(10001), sqltypes.NewVarChar("d005")}
+	encoded, err := encodeKey(key)
+	require.NoError(t, err)
+	decoded, err := decodeKey(encoded)
+	require.NoError(t, err)
+	assert.Equal(t, key, decoded)
+
+	decoded, err = decodeKey("")
+	require.NoError(t, err)
+	assert.Nil(t, decoded)
+}
+
+func TestSync_RejectsChunkedCopyWithConsistentSnapshot(t *testing.T) {
+	tma, _ := getCopyMysqlAccess(t, []int64{3}, "1|a", "2|b", "3|c", "4|d")
+	ped := &testPlanetScaleEdgeDatabase{
+		ReadParamsFn: func(ctx context.Context, params ReadParams) (*SerializedCursor, error) {
+			t.Error("should not read streams that cannot be copied")
+			return nil, nil
+		},
+	}
+	_, err := Sync(context.Background(), tma, ped, &testSingerLogger{}, PlanetScaleSource{Database: "employees"}, getContinuousCatalog(), nil, &eventRecordWriter{}, SyncSettings{CopyChunks: 2, ConsistentSnapshot: true})
+	assert.ErrorContains(t, err, "stream employees cannot be copied in chunks in a sync with a consistent snapshot")
+}
+
+func TestGetKeyBoundaries_SeeksPastPreviousBoundary(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery("select min(`dept_no`), max(`dept_no`) from `employees`.`departments`").
+		WillReturnRows(sqlmock.NewRows([]string{"min", "max"}).AddRow("d001", "d009"))
+	mock.ExpectQuery("select table_rows from information_schema.tables where table_schema=? AND table_name=?;").
+		WithArgs("employees", "departments").
+		WillReturnRows(sqlmock.NewRows([]string{"table_rows"}).AddRow(9))
+	mock.ExpectQuery("select `dept_no` from `employees`.`departments` order by `dept_no` limit 1 offset 3").
+		WillReturnRows(sqlmock.NewRows([]string{"dept_no"}).AddRow("d004"))
+	mock.ExpectQuery("select `dept_no` from `employees`.`departments` where `dept_no` > ? order by `dept_no` limit 1 offset 2").
+		WithArgs("d004").
+		WillReturnRows(sqlmock.NewRows([]string{"dept_no"}).AddRow("d007"))
+
+	access := planetScaleEdgeMySQLAccess{db: db}
+	boundaries, err := access.GetKeyBoundaries(context.Background(), PlanetScaleSource{Database: "employees"}, "departments", "dept_no", 3)
+	require.NoError(t, err)
+	require.Len(t, boundaries, 2)
+	assert.Equal(t, "d004", boundaries[0].ToString())
+	assert.Equal(t, "d007", boundaries[1].ToString())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSync_CopiesTableOfStream(t *testing.T) {
+	// a stream without a table name is read from the table it was named after.
+	catalogs := map[string]Catalog{
+		"employees":    getContinuousCatalog(),
+		"hr_employees": NamespaceCatalog("hr", getContinuousCatalog()),
+	}
+	for name, catalog := range catalogs {
+		tma, queries := getCopyMysqlAccess(t, []int64{3}, "1|a", "2|b", "3|c", "4|d")
+		var splitTables []string
+		boundaries := tma.GetKeyBoundariesFn
+		tma.GetKeyBoundariesFn = func(ctx context.Context, psc PlanetScaleSource, table, column string, chunks int) ([]sqltypes.Value, error) {
+			splitTables = append(splitTables, table)
+			return boundaries(ctx, psc, table, column, chunks)
+		}
+		ped := &testPlanetScaleEdgeDatabase{
+			LatestPositionFn: func(ctx context.Context, params ReadParams) (string, error) {
+				return "MySQL56/e42292e8-e28f-11ec-9c5b-d680f5d655b3:1-10", nil
+			},
+			ReadParamsFn: func(ctx context.Context, params ReadParams) (*SerializedCursor, error) {
+				return TableCursorToSerializedCursor(params.LastKnownPosition)
+			},
+		}
+
+		report, err := Sync(context.Background(), tma, ped, &testSingerLogger{}, PlanetScaleSource{Database: "employees"}, catalog, nil, &eventRecordWriter{}, SyncSettings{CopyChunks: 2})
+		require.NoError(t, err)
+		assert.Equal(t, 4, report.stream(name).Copy.RowsEmitted)
+		assert.Equal(t, []string{"employees"}, splitTables)
+		require.NotEmpty(t, *queries)
+		for _, query := range *queries {
+			assert.Equal(t, "employees", query.Table)
+		}
+	}
+}
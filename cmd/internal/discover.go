@@ -3,13 +3,15 @@ package internal
 import (
 	"context"
 	"fmt"
-	"strings"
+	"sort"
 
 	"github.com/pkg/errors"
 )
 
 type DiscoverSettings struct {
-	AutoSelectTables      bool
+	AutoSelectTables bool
+	// IncludedTables limits discovery to these tables and views, all of them are discovered if there are none.
+	IncludedTables        []string
 	ExcludedTables        []string
 	UseIncrementalSync    bool
 	TreatTinyIntAsBoolean bool
@@ -21,43 +23,87 @@ func Discover(ctx context.Context, source PlanetScaleSource, mysql PlanetScaleEd
 		return c, errors.Wrap(err, "unable to access PlanetScale Database")
 	}
 
-	tableNames, err := mysql.GetTableNames(ctx, source)
+	// tables that are not included, or are excluded, are left out by the schema queries themselves.
+	schema, err := mysql.GetSchema(ctx, source, settings.IncludedTables, settings.ExcludedTables)
 	if err != nil {
-		return c, errors.Wrap(err, "unable to retrieve table names")
+		return c, errors.Wrap(err, "unable to retrieve schema")
 	}
 
-	excludedTables := strings.Join(settings.ExcludedTables, " ")
-
-	for _, name := range tableNames {
-		if len(excludedTables) > 0 && strings.Contains(excludedTables, name) {
-			continue
-		}
-
+	for _, t := range schema {
+		name := t.Name
 		table := Stream{
 			Name:      name,
 			ID:        fmt.Sprintf("%s:%s", source.Database, name),
 			TableName: name,
 		}
 
-		tableSchema, err := mysql.GetTableSchema(ctx, source, name, settings.TreatTinyIntAsBoolean)
-		if err != nil {
-			return c, errors.Wrapf(err, "unable to retrieve schema for table : %v , failed with : %q", name, err)
-		}
-
 		table.Schema = StreamSchema{
 			Type:       []string{"null", "object"},
-			Properties: tableSchema,
+			Properties: make(map[string]StreamProperty, len(t.Columns)),
+		}
+		for _, column := range t.Columns {
+			table.Schema.Properties[column.Name] = column.property(settings.TreatTinyIntAsBoolean)
 		}
-		keyProperties, err := mysql.GetTablePrimaryKeys(ctx, source, name)
-		if err != nil {
-			return c, errors.Wrapf(err, "unable to retrieve primary keys for table : %v , failed with : %q", name, err)
+		keyProperties := t.PrimaryKeys
+		// tables without a primary key are keyed by a unique index, if they have one whose columns are all not null.
+		if len(keyProperties) == 0 && !t.IsView {
+			keyProperties = t.UniqueKeys
 		}
 		table.KeyProperties = keyProperties
 		table.CursorProperties = keyProperties
-		table.GenerateMetadata(keyProperties, settings.AutoSelectTables, settings.UseIncrementalSync)
+
+		// views and tables without keys cannot be streamed, they are selected in full every time they are synced instead.
+		fullTable := t.IsView || len(keyProperties) == 0
+		table.GenerateMetadata(keyProperties, settings.AutoSelectTables, settings.UseIncrementalSync && !fullTable)
+		for i := range table.Metadata {
+			if len(table.Metadata[i].Metadata.BreadCrumb) == 0 {
+				table.Metadata[i].Metadata.RowCount = t.RowCount
+				if fullTable {
+					table.Metadata[i].Metadata.IsView = t.IsView
+					table.Metadata[i].Metadata.ReplicationMethod = "FULL_TABLE"
+					table.Metadata[i].Metadata.ForcedReplicationMethod = "FULL_TABLE"
+				}
+			}
+		}
+		table.setColumnMetadata(t.Columns, !fullTable)
 
 		c.Streams = append(c.Streams, table)
 	}
 
 	return c, nil
 }
+
+// setColumnMetadata records the SQL type and position of every column in the metadata of its property,
+// and orders the metadata of the properties like the columns of the table.
+// The values of virtual generated columns are not stored, so changes to them cannot be streamed;
+// they are unsupported in streams that are streamed rather than selected in full.
+func (s *Stream) setColumnMetadata(columns []TableColumn, streamed bool) {
+	positions := make(map[string]int, len(columns))
+	for _, column := range columns {
+		positions[column.Name] = column.Position
+	}
+	for _, column := range columns {
+		for i := range s.Metadata {
+			md := &s.Metadata[i].Metadata
+			if len(md.BreadCrumb) == 0 || md.BreadCrumb[len(md.BreadCrumb)-1] != column.Name {
+				continue
+			}
+			md.SqlDataType = column.ColumnType
+			md.OrdinalPosition = column.Position
+			if streamed && column.Generated == "VIRTUAL" && md.Inclusion != "automatic" {
+				md.Inclusion = "unsupported"
+				md.Selected = false
+			}
+		}
+	}
+
+	position := func(md NodeMetadata) int {
+		if len(md.BreadCrumb) == 0 {
+			return 0
+		}
+		return positions[md.BreadCrumb[len(md.BreadCrumb)-1]]
+	}
+	sort.SliceStable(s.Metadata, func(i, j int) bool {
+		return position(s.Metadata[i].Metadata) < position(s.Metadata[j].Metadata)
+	})
+}
@@ -2,12 +2,37 @@ package internal
 
 import (
 	"context"
+	"fmt"
 	"testing"
 
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
+// getEmployeesSchema returns a schema of tables with the given names, whose columns are those of the employees table,
+// keeping only the included tables and leaving out the excluded tables as the schema queries do.
+func getEmployeesSchema(names ...string) func(ctx context.Context, source PlanetScaleSource, includedTables, excludedTables []string) ([]TableSchema, error) {
+	return func(ctx context.Context, source PlanetScaleSource, includedTables, excludedTables []string) ([]TableSchema, error) {
+		var schema []TableSchema
+		for _, name := range names {
+			if (len(includedTables) > 0 && !contains(includedTables, name)) || contains(excludedTables, name) {
+				continue
+			}
+			schema = append(schema, TableSchema{
+				DatabaseTable: DatabaseTable{Name: name},
+				Columns: []TableColumn{
+					{Name: "emp_no", Nullable: true},
+					{Name: "first_name", Nullable: true},
+					{Name: "last_name", Nullable: true},
+				},
+				PrimaryKeys: []string{"emp_no"},
+			})
+		}
+		return schema, nil
+	}
+}
+
 func TestDiscover_CanFailIfCredentialsInvalid(t *testing.T) {
 	tma := getTestMysqlAccess()
 	settings := DiscoverSettings{}
@@ -23,38 +48,20 @@ func TestDiscover_CanFailIfCredentialsInvalid(t *testing.T) {
 
 func TestDiscover_CanFailIfCannotQuery(t *testing.T) {
 	tma := getTestMysqlAccess()
-	tma.GetTableNamesFn = func(ctx context.Context, source PlanetScaleSource) ([]string, error) {
-		return []string{}, errors.New("read prohibited")
+	tma.GetSchemaFn = func(ctx context.Context, source PlanetScaleSource, includedTables, excludedTables []string) ([]TableSchema, error) {
+		return nil, errors.New("read prohibited")
 	}
 
 	_, err := Discover(context.Background(), PlanetScaleSource{}, tma, DiscoverSettings{})
 	assert.NotNil(t, err)
-	assert.ErrorContains(t, err, "unable to retrieve table names: read prohibited")
+	assert.ErrorContains(t, err, "unable to retrieve schema: read prohibited")
 	assert.True(t, tma.PingContextFnInvoked)
 	assert.False(t, tma.GetVitessTabletsFnInvoked)
 }
 
 func TestDiscover_SchemaHasPrimaryKeys(t *testing.T) {
 	tma := getTestMysqlAccess()
-	tma.GetTableNamesFn = func(ctx context.Context, source PlanetScaleSource) ([]string, error) {
-		return []string{
-			"employees",
-		}, nil
-	}
-
-	tma.GetTableSchemaFn = func(ctx context.Context, source PlanetScaleSource, s string) (map[string]StreamProperty, error) {
-		return map[string]StreamProperty{
-			"emp_no":     {Types: []string{"null", "string"}},
-			"first_name": {Types: []string{"null", "string"}},
-			"last_name":  {Types: []string{"null", "string"}},
-		}, nil
-	}
-
-	tma.GetTablePrimaryKeysFn = func(ctx context.Context, source PlanetScaleSource, s string) ([]string, error) {
-		return []string{
-			"emp_no",
-		}, nil
-	}
+	tma.GetSchemaFn = getEmployeesSchema("employees")
 
 	c, err := Discover(context.Background(), PlanetScaleSource{}, tma, DiscoverSettings{})
 	assert.Nil(t, err)
@@ -64,27 +71,27 @@ func TestDiscover_SchemaHasPrimaryKeys(t *testing.T) {
 	assert.Equal(t, []string{"emp_no"}, emp.KeyProperties)
 }
 
-func TestDiscover_SchemaHasCursorProperties(t *testing.T) {
+func TestDiscover_SchemaHasRowCount(t *testing.T) {
 	tma := getTestMysqlAccess()
-	tma.GetTableNamesFn = func(ctx context.Context, source PlanetScaleSource) ([]string, error) {
-		return []string{
-			"employees",
-		}, nil
+	tma.GetSchemaFn = func(ctx context.Context, source PlanetScaleSource, includedTables, excludedTables []string) ([]TableSchema, error) {
+		return []TableSchema{{
+			DatabaseTable: DatabaseTable{Name: "employees", RowCount: 300024},
+			Columns:       []TableColumn{{Name: "emp_no", Nullable: true}},
+			PrimaryKeys:   []string{"emp_no"},
+		}}, nil
 	}
 
-	tma.GetTableSchemaFn = func(ctx context.Context, source PlanetScaleSource, s string) (map[string]StreamProperty, error) {
-		return map[string]StreamProperty{
-			"emp_no":     {Types: []string{"null", "string"}},
-			"first_name": {Types: []string{"null", "string"}},
-			"last_name":  {Types: []string{"null", "string"}},
-		}, nil
-	}
+	c, err := Discover(context.Background(), PlanetScaleSource{}, tma, DiscoverSettings{})
+	assert.Nil(t, err)
+	assert.True(t, tma.GetSchemaFnInvoked)
+	tm, err := c.Streams[0].GetTableMetadata()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(300024), tm.Metadata.RowCount)
+}
 
-	tma.GetTablePrimaryKeysFn = func(ctx context.Context, source PlanetScaleSource, s string) ([]string, error) {
-		return []string{
-			"emp_no",
-		}, nil
-	}
+func TestDiscover_SchemaHasCursorProperties(t *testing.T) {
+	tma := getTestMysqlAccess()
+	tma.GetSchemaFn = getEmployeesSchema("employees")
 
 	c, err := Discover(context.Background(), PlanetScaleSource{}, tma, DiscoverSettings{})
 	assert.Nil(t, err)
@@ -96,25 +103,7 @@ func TestDiscover_SchemaHasCursorProperties(t *testing.T) {
 
 func TestDiscover_CanSelectAllTables(t *testing.T) {
 	tma := getTestMysqlAccess()
-	tma.GetTableNamesFn = func(ctx context.Context, source PlanetScaleSource) ([]string, error) {
-		return []string{
-			"employees",
-		}, nil
-	}
-
-	tma.GetTableSchemaFn = func(ctx context.Context, source PlanetScaleSource, s string) (map[string]StreamProperty, error) {
-		return map[string]StreamProperty{
-			"emp_no":     {Types: []string{"null", "string"}},
-			"first_name": {Types: []string{"null", "string"}},
-			"last_name":  {Types: []string{"null", "string"}},
-		}, nil
-	}
-
-	tma.GetTablePrimaryKeysFn = func(ctx context.Context, source PlanetScaleSource, s string) ([]string, error) {
-		return []string{
-			"emp_no",
-		}, nil
-	}
+	tma.GetSchemaFn = getEmployeesSchema("employees")
 
 	c, err := Discover(context.Background(), PlanetScaleSource{}, tma, DiscoverSettings{
 		AutoSelectTables: true,
@@ -145,26 +134,7 @@ func TestDiscover_CanSelectAllTables(t *testing.T) {
 
 func TestDiscover_CanExcludeTables(t *testing.T) {
 	tma := getTestMysqlAccess()
-	tma.GetTableNamesFn = func(ctx context.Context, source PlanetScaleSource) ([]string, error) {
-		return []string{
-			"employees",
-			"customers",
-		}, nil
-	}
-
-	tma.GetTableSchemaFn = func(ctx context.Context, source PlanetScaleSource, s string) (map[string]StreamProperty, error) {
-		return map[string]StreamProperty{
-			"emp_no":     {Types: []string{"null", "string"}},
-			"first_name": {Types: []string{"null", "string"}},
-			"last_name":  {Types: []string{"null", "string"}},
-		}, nil
-	}
-
-	tma.GetTablePrimaryKeysFn = func(ctx context.Context, source PlanetScaleSource, s string) ([]string, error) {
-		return []string{
-			"emp_no",
-		}, nil
-	}
+	tma.GetSchemaFn = getEmployeesSchema("employees", "customers")
 
 	c, err := Discover(context.Background(), PlanetScaleSource{}, tma, DiscoverSettings{
 		AutoSelectTables: true,
@@ -199,25 +169,7 @@ func TestDiscover_CanExcludeTables(t *testing.T) {
 
 func TestDiscover_SchemaHasValidMetadata(t *testing.T) {
 	tma := getTestMysqlAccess()
-	tma.GetTableNamesFn = func(ctx context.Context, source PlanetScaleSource) ([]string, error) {
-		return []string{
-			"employees",
-		}, nil
-	}
-
-	tma.GetTableSchemaFn = func(ctx context.Context, source PlanetScaleSource, s string) (map[string]StreamProperty, error) {
-		return map[string]StreamProperty{
-			"emp_no":     {Types: []string{"null", "string"}},
-			"first_name": {Types: []string{"null", "string"}},
-			"last_name":  {Types: []string{"null", "string"}},
-		}, nil
-	}
-
-	tma.GetTablePrimaryKeysFn = func(ctx context.Context, source PlanetScaleSource, s string) ([]string, error) {
-		return []string{
-			"emp_no",
-		}, nil
-	}
+	tma.GetSchemaFn = getEmployeesSchema("employees")
 
 	c, err := Discover(context.Background(), PlanetScaleSource{}, tma, DiscoverSettings{})
 	assert.Nil(t, err)
@@ -240,3 +192,144 @@ func TestDiscover_SchemaHasValidMetadata(t *testing.T) {
 		BreadCrumb: []string{"properties", "last_name"},
 	}, mm["last_name"].Metadata, "non-key properties should be selectable")
 }
+
+func TestDiscover_ForcesFullTableForViewsAndKeylessTables(t *testing.T) {
+	tma := getTestMysqlAccess()
+	tma.GetSchemaFn = func(ctx context.Context, source PlanetScaleSource, includedTables, excludedTables []string) ([]TableSchema, error) {
+		columns := []TableColumn{{Name: "emp_no", Nullable: true}}
+		return []TableSchema{
+			{DatabaseTable: DatabaseTable{Name: "current_employees", IsView: true}, Columns: columns},
+			{DatabaseTable: DatabaseTable{Name: "employees"}, Columns: columns, PrimaryKeys: []string{"emp_no"}},
+			{DatabaseTable: DatabaseTable{Name: "events"}, Columns: columns},
+			{DatabaseTable: DatabaseTable{Name: "salaries"}, Columns: columns, UniqueKeys: []string{"emp_no"}},
+		}, nil
+	}
+
+	c, err := Discover(context.Background(), PlanetScaleSource{}, tma, DiscoverSettings{UseIncrementalSync: true})
+	require.NoError(t, err)
+	require.Len(t, c.Streams, 4)
+	streams := map[string]Stream{}
+	for _, s := range c.Streams {
+		streams[s.Name] = s
+	}
+
+	view := streamMetadata(streams["current_employees"])
+	assert.True(t, view.IsView)
+	assert.Equal(t, "FULL_TABLE", view.ReplicationMethod)
+	assert.Equal(t, "FULL_TABLE", view.ForcedReplicationMethod)
+
+	keyless := streamMetadata(streams["events"])
+	assert.False(t, keyless.IsView)
+	assert.Equal(t, "FULL_TABLE", keyless.ForcedReplicationMethod)
+
+	assert.Equal(t, []string{"emp_no"}, streams["employees"].KeyProperties)
+	assert.Equal(t, "INCREMENTAL", streamMetadata(streams["employees"]).ReplicationMethod)
+	assert.Empty(t, streamMetadata(streams["employees"]).ForcedReplicationMethod)
+
+	// a not null unique key stands in for a missing primary key.
+	assert.Equal(t, []string{"emp_no"}, streams["salaries"].KeyProperties)
+	assert.Equal(t, "INCREMENTAL", streamMetadata(streams["salaries"]).ReplicationMethod)
+}
+
+func TestDiscover_DescribesColumnsInMetadata(t *testing.T) {
+	tma := getTestMysqlAccess()
+	tma.GetSchemaFn = func(ctx context.Context, source PlanetScaleSource, includedTables, excludedTables []string) ([]TableSchema, error) {
+		columns := []TableColumn{
+			{Name: "emp_no", Position: 1, ColumnType: "int"},
+			{Name: "last_name", Position: 2, ColumnType: "varchar(16)", Nullable: true, MaxLength: 16},
+			{Name: "first_name", Position: 3, ColumnType: "varchar(14)", Nullable: true, MaxLength: 14},
+			{Name: "full_name", Position: 4, ColumnType: "varchar(31)", Nullable: true, Generated: "VIRTUAL"},
+			{Name: "name_length", Position: 5, ColumnType: "int", Nullable: true, Generated: "STORED"},
+		}
+		return []TableSchema{
+			{DatabaseTable: DatabaseTable{Name: "employees"}, Columns: columns, PrimaryKeys: []string{"emp_no"}},
+			{DatabaseTable: DatabaseTable{Name: "employee_names", IsView: true}, Columns: columns},
+		}, nil
+	}
+
+	c, err := Discover(context.Background(), PlanetScaleSource{}, tma, DiscoverSettings{AutoSelectTables: true})
+	require.NoError(t, err)
+	require.Len(t, c.Streams, 2)
+
+	emp := c.Streams[0]
+	assert.Equal(t, []string{"integer"}, emp.Schema.Properties["emp_no"].Types)
+	assert.Equal(t, int64(16), emp.Schema.Properties["last_name"].MaxLength)
+
+	var properties []string
+	for _, m := range emp.Metadata[1:] {
+		properties = append(properties, m.Metadata.BreadCrumb[1])
+	}
+	assert.Equal(t, []string{"emp_no", "last_name", "first_name", "full_name", "name_length"}, properties,
+		"properties should be in the order of the table's columns")
+	assert.Empty(t, emp.Metadata[0].Metadata.BreadCrumb)
+
+	mm := emp.Metadata.GetPropertyMap()
+	assert.Equal(t, "varchar(14)", mm["first_name"].Metadata.SqlDataType)
+	assert.Equal(t, 3, mm["first_name"].Metadata.OrdinalPosition)
+	assert.Equal(t, "unsupported", mm["full_name"].Metadata.Inclusion, "virtual columns cannot be streamed")
+	assert.False(t, mm["full_name"].Metadata.Selected)
+	assert.Equal(t, "available", mm["name_length"].Metadata.Inclusion, "stored columns can be streamed")
+	assert.NotContains(t, emp.Metadata.GetSelectedProperties(), "full_name")
+
+	// views are selected in full, so their virtual columns can be read.
+	view := c.Streams[1].Metadata.GetPropertyMap()
+	assert.Equal(t, "available", view["full_name"].Metadata.Inclusion)
+	assert.True(t, view["full_name"].Metadata.Selected)
+}
+
+func TestDiscover_ReadsSchemaOfAllTablesAtOnce(t *testing.T) {
+	tma := getTestMysqlAccess()
+	var names []string
+	for i := 0; i < 3000; i++ {
+		names = append(names, fmt.Sprintf("table_%04d", i))
+	}
+	schemaFn := getEmployeesSchema(names...)
+	calls := 0
+	tma.GetSchemaFn = func(ctx context.Context, source PlanetScaleSource, includedTables, excludedTables []string) ([]TableSchema, error) {
+		calls++
+		assert.Empty(t, includedTables)
+		assert.Equal(t, []string{"table_0001"}, excludedTables, "excluded tables should be left out by the query")
+		return schemaFn(ctx, source, includedTables, excludedTables)
+	}
+
+	c, err := Discover(context.Background(), PlanetScaleSource{Database: "employees"}, tma, DiscoverSettings{ExcludedTables: []string{"table_0001"}})
+	require.NoError(t, err)
+	assert.Equal(t, 1, calls)
+	assert.Len(t, c.Streams, 2999)
+	assert.Equal(t, "table_0000", c.Streams[0].Name)
+	assert.Equal(t, "employees:table_0002", c.Streams[1].ID)
+	assert.Equal(t, []string{"emp_no"}, c.Streams[1].KeyProperties)
+}
+
+func TestDiscover_ReadsSchemaOfIncludedTables(t *testing.T) {
+	tma := getTestMysqlAccess()
+	schemaFn := getEmployeesSchema("employees", "employees_archive", "salaries")
+	tma.GetSchemaFn = func(ctx context.Context, source PlanetScaleSource, includedTables, excludedTables []string) ([]TableSchema, error) {
+		assert.Equal(t, []string{"employees"}, includedTables, "only included tables should be read by the query")
+		assert.Equal(t, []string{"employees_archive"}, excludedTables)
+		return schemaFn(ctx, source, includedTables, excludedTables)
+	}
+
+	c, err := Discover(context.Background(), PlanetScaleSource{Database: "employees"}, tma, DiscoverSettings{
+		IncludedTables: []string{"employees"},
+		ExcludedTables: []string{"employees_archive"},
+	})
+	require.NoError(t, err)
+	// tables whose names are part of the name of an excluded table are still discovered.
+	require.Len(t, c.Streams, 1)
+	assert.Equal(t, "employees", c.Streams[0].Name)
+}
+
+func TestTablesFilter_KeepsIncludedAndLeavesOutExcludedTables(t *testing.T) {
+	filter, args := tablesFilter("table_name", "employees", nil, nil)
+	assert.Empty(t, filter)
+	assert.Equal(t, []interface{}{"employees"}, args)
+
+	filter, args = tablesFilter("s.table_name", "employees", nil, []string{"salaries", "titles"})
+	assert.Equal(t, " AND s.table_name not in (?, ?)", filter)
+	assert.Equal(t, []interface{}{"employees", "salaries", "titles"}, args)
+
+	filter, args = tablesFilter("table_name", "employees", []string{"employees", "salaries"}, []string{"salaries"})
+	assert.Equal(t, " AND table_name in (?, ?) AND table_name not in (?)", filter)
+	assert.Equal(t, []interface{}{"employees", "employees", "salaries", "salaries"}, args)
+}
@@ -0,0 +1,126 @@
+package internal
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	"vitess.io/vitess/go/sqltypes"
+	querypb "vitess.io/vitess/go/vt/proto/query"
+	"vitess.io/vitess/go/vt/sqlparser"
+	"vitess.io/vitess/go/vt/vtgate/evalengine"
+)
+
+// RowFilter evaluates the filter expression of a stream, like "created_at >= '2024-01-01'",
+// against rows read from that stream.
+type RowFilter struct {
+	expression sqlparser.Expr
+	evaluable  evalengine.Expr
+	// columns are the columns referenced by the expression, in the order the evaluable expects them.
+	columns []string
+}
+
+// NewRowFilter parses a filter expression and checks that every column it references exists in the stream.
+func NewRowFilter(expression string, s Stream) (*RowFilter, error) {
+	parsed, err := sqlparser.ParseExpr(expression)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to parse filter %q for stream %q", expression, s.Name)
+	}
+
+	f := &RowFilter{expression: parsed}
+	f.evaluable, err = evalengine.Translate(parsed, &evalengine.Config{
+		ResolveColumn: func(name *sqlparser.ColName) (int, error) {
+			column := name.Name.String()
+			if _, ok := s.Schema.Properties[column]; !ok {
+				return 0, fmt.Errorf("column %q does not exist", column)
+			}
+			for i, c := range f.columns {
+				if c == column {
+					return i, nil
+				}
+			}
+			f.columns = append(f.columns, column)
+			return len(f.columns) - 1, nil
+		},
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid filter %q for stream %q", expression, s.Name)
+	}
+
+	return f, nil
+}
+
+// Columns returns the columns that must be read to evaluate this filter.
+func (f *RowFilter) Columns() []string {
+	return f.columns
+}
+
+// SQL returns the filter expression in a form that can be used in a where clause.
+func (f *RowFilter) SQL() string {
+	return sqlparser.String(f.expression)
+}
+
+// Match reports whether a row satisfies the filter, a nil filter matches all rows.
+func (f *RowFilter) Match(fields []*querypb.Field, row []sqltypes.Value) (bool, error) {
+	if f == nil {
+		return true, nil
+	}
+
+	env := evalengine.EmptyExpressionEnv()
+	env.Row = make([]sqltypes.Value, len(f.columns))
+	for i, column := range f.columns {
+		idx := -1
+		for j, field := range fields {
+			if field.Name == column {
+				idx = j
+				break
+			}
+		}
+		if idx < 0 || idx >= len(row) {
+			return false, fmt.Errorf("column %q used in filter is missing from row", column)
+		}
+		env.Row[i] = row[idx]
+	}
+
+	result, err := env.Evaluate(f.evaluable)
+	if err != nil {
+		return false, errors.Wrapf(err, "unable to evaluate filter %q", f.SQL())
+	}
+	return result.ToBoolean(), nil
+}
+
+// newRowFilters returns the filters configured for all selected streams in a catalog, keyed by stream name.
+// The catalog should not be filtered yet, so that filters can refer to columns that are not selected.
+func newRowFilters(catalog Catalog) (map[string]*RowFilter, error) {
+	filters := map[string]*RowFilter{}
+	for _, stream := range catalog.Streams {
+		tm, err := stream.GetTableMetadata()
+		if err != nil {
+			return nil, err
+		}
+		if !tm.Metadata.Selected || len(tm.Metadata.Filter) == 0 {
+			continue
+		}
+
+		f, err := NewRowFilter(tm.Metadata.Filter, stream)
+		if err != nil {
+			return nil, err
+		}
+		filters[stream.Name] = f
+	}
+	return filters, nil
+}
+
+// readColumns returns the selected properties of a stream
+// along with any other columns needed to evaluate its filter.
+func readColumns(s Stream, f *RowFilter) []string {
+	columns := s.Metadata.GetSelectedProperties()
+	if f == nil {
+		return columns
+	}
+	for _, column := range f.Columns() {
+		if !contains(columns, column) {
+			columns = append(columns, column)
+		}
+	}
+	return columns
+}
@@ -0,0 +1,106 @@
+package internal
+
+import (
+	"context"
+	"testing"
+
+	psdbconnect "github.com/planetscale/airbyte-source/proto/psdbconnect/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"vitess.io/vitess/go/sqltypes"
+)
+
+func TestRowFilter_CanMatchRows(t *testing.T) {
+	stream := getVerifyCatalog().Streams[0]
+	f, err := NewRowFilter("emp_no > 10001 and first_name = 'Parto'", stream)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"emp_no", "first_name"}, f.Columns())
+	assert.Equal(t, "emp_no > 10001 and first_name = 'Parto'", f.SQL())
+
+	qr := getVerifyResult("10001|Parto", "10002|Bezalel", "10003|Parto")
+	var matched []bool
+	for _, row := range qr.Rows {
+		match, err := f.Match(qr.Fields, row)
+		require.NoError(t, err)
+		matched = append(matched, match)
+	}
+	assert.Equal(t, []bool{false, false, true}, matched)
+}
+
+func TestRowFilter_NilMatchesAllRows(t *testing.T) {
+	var f *RowFilter
+	qr := getVerifyResult("10001|Georgi")
+	match, err := f.Match(qr.Fields, qr.Rows[0])
+	require.NoError(t, err)
+	assert.True(t, match)
+}
+
+func TestRowFilter_RejectsInvalidExpressions(t *testing.T) {
+	stream := getVerifyCatalog().Streams[0]
+
+	_, err := NewRowFilter("emp_no >", stream)
+	assert.ErrorContains(t, err, "unable to parse filter")
+
+	_, err = NewRowFilter("hire_date > '1990-01-01'", stream)
+	assert.ErrorContains(t, err, `column "hire_date" does not exist`)
+}
+
+func TestSync_FiltersRows(t *testing.T) {
+	catalog := getVerifyCatalog()
+	catalog.Streams[0].Metadata[0].Metadata.Filter = "emp_no >= 10002"
+	// the filter column does not need to be selected.
+	catalog.Streams[0].Metadata[1].Metadata.Selected = false
+	catalog.Streams[0].Metadata[1].Metadata.Inclusion = "available"
+
+	tma := getTestMysqlAccess()
+	ped := &testPlanetScaleEdgeDatabase{
+		ReadParamsFn: func(ctx context.Context, params ReadParams) (*SerializedCursor, error) {
+			assert.Equal(t, []string{"first_name", "emp_no"}, params.Columns)
+			if err := params.OnResult(getVerifyResult("10001|Georgi", "10002|Bezalel", "10003|Parto")); err != nil {
+				return nil, err
+			}
+			return TableCursorToSerializedCursor(params.LastKnownPosition)
+		},
+	}
+	logger := &testSingerLogger{}
+
+	report, err := Sync(context.Background(), tma, ped, logger, PlanetScaleSource{Database: "employees"}, catalog, nil, logger, SyncSettings{})
+	require.NoError(t, err)
+	records := logger.records["employees"]
+	require.Len(t, records, 2)
+	assert.Equal(t, map[string]interface{}{"first_name": "Bezalel"}, records[0].Data)
+	assert.Equal(t, map[string]interface{}{"first_name": "Parto"}, records[1].Data)
+	assert.Equal(t, 2, report.Streams[0].RowsEmitted)
+	assert.Equal(t, 1, report.Streams[0].RowsDropped)
+}
+
+func TestSync_RejectsInvalidFilter(t *testing.T) {
+	catalog := getVerifyCatalog()
+	catalog.Streams[0].Metadata[0].Metadata.Filter = "salary > 1000"
+
+	ped := &testPlanetScaleEdgeDatabase{
+		ReadFn: func(ctx context.Context, ps PlanetScaleSource, s Stream, tc *psdbconnect.TableCursor) (*SerializedCursor, error) {
+			assert.Fail(t, "rows should not be read when a filter is invalid")
+			return nil, nil
+		},
+	}
+	logger := &testSingerLogger{}
+
+	_, err := Sync(context.Background(), getTestMysqlAccess(), ped, logger, PlanetScaleSource{Database: "employees"}, catalog, nil, logger, SyncSettings{})
+	assert.ErrorContains(t, err, `invalid filter "salary > 1000" for stream "employees"`)
+}
+
+func TestVerify_PushesFilterDown(t *testing.T) {
+	catalog := getVerifyCatalog()
+	catalog.Streams[0].Metadata[0].Metadata.Filter = "first_name != 'Georgi'"
+
+	tma := getTestMysqlAccess()
+	tma.GetTableRowsFn = func(ctx context.Context, psc PlanetScaleSource, query TableRowsQuery) (*sqltypes.Result, error) {
+		assert.Equal(t, "first_name != 'Georgi'", query.Where)
+		return getVerifyResult(), nil
+	}
+
+	_, err := Verify(context.Background(), tma, &testSingerLogger{}, PlanetScaleSource{Database: "employees"}, catalog, VerifySettings{})
+	require.NoError(t, err)
+	assert.True(t, tma.GetTableRowsFnInvoked)
+}
@@ -0,0 +1,106 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// HealthStatus describes what a continuous sync is doing.
+type HealthStatus string
+
+const (
+	// HealthStatusCatchingUp means streams are being read up to their latest position.
+	HealthStatusCatchingUp HealthStatus = "catching_up"
+	// HealthStatusStreaming means all streams have caught up and changes are read as they happen.
+	HealthStatusStreaming HealthStatus = "streaming"
+	// HealthStatusStopped means the sync has stopped, because it was shut down or failed.
+	HealthStatusStopped HealthStatus = "stopped"
+)
+
+// Health tracks the progress of a sync and serves it over HTTP, for use as a health check.
+// A nil *Health ignores all updates.
+type Health struct {
+	mu          sync.Mutex
+	status      HealthStatus
+	lastEventAt time.Time
+	lastStateAt time.Time
+	err         string
+}
+
+// healthReport is the body of a response to a health check.
+type healthReport struct {
+	Status      HealthStatus `json:"status"`
+	LastEventAt *time.Time   `json:"last_event_at,omitempty"`
+	LastStateAt *time.Time   `json:"last_state_at,omitempty"`
+	Error       string       `json:"error,omitempty"`
+}
+
+func NewHealth() *Health {
+	return &Health{status: HealthStatusCatchingUp}
+}
+
+// ServeHTTP responds with the status of the sync as JSON,
+// with a 503 status code once the sync has stopped.
+func (h *Health) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	report := healthReport{Status: h.status, Error: h.err}
+	if !h.lastEventAt.IsZero() {
+		lastEventAt := h.lastEventAt
+		report.LastEventAt = &lastEventAt
+	}
+	if !h.lastStateAt.IsZero() {
+		lastStateAt := h.lastStateAt
+		report.LastStateAt = &lastStateAt
+	}
+	h.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if report.Status == HealthStatusStopped {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(report)
+}
+
+func (h *Health) setStatus(status HealthStatus) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.status = status
+}
+
+// stop records that the sync stopped, along with the error it failed with, if any.
+func (h *Health) stop(err error) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.status = HealthStatusStopped
+	if err != nil {
+		h.err = err.Error()
+	}
+}
+
+// event records that a row or position was read.
+func (h *Health) event() {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastEventAt = time.Now().UTC()
+}
+
+// stateEmitted records that a STATE message was emitted.
+func (h *Health) stateEmitted() {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastStateAt = time.Now().UTC()
+}
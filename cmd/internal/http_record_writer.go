@@ -2,16 +2,16 @@ package internal
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
-	"io/fs"
-	"os"
-	"path/filepath"
+	"log/slog"
 	"time"
 
 	"github.com/hashicorp/go-retryablehttp"
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 const (
@@ -19,30 +19,36 @@ const (
 	MaxBatchRequestSize int = 2 * 1024 * 1024
 )
 
-func NewHttpRecordWriter(batchSize int, apiURL, apiToken, stateFileDir string, logger StatusLogger) RecordWriter {
+// NewHttpRecordWriter returns a writer that posts records to the import API and saves state to a store,
+// with requests to both made under the given context.
+func NewHttpRecordWriter(ctx context.Context, batchSize int, apiURL, apiToken string, stateStore StateStore, retention StateRetention, logger StatusLogger) RecordWriter {
 	client := retryablehttp.NewClient()
 	// Wait 3 seconds before retrying
 	client.RetryWaitMin = 3 * time.Second
 	client.Logger = nil
 	return &httpBatchWriter{
-		batchSize:    batchSize,
-		apiURL:       apiURL,
-		apiToken:     apiToken,
-		client:       client,
-		stateFileDir: stateFileDir,
-		logger:       logger,
-		messages:     make([]ImportMessage, 0, batchSize),
+		ctx:            ctx,
+		batchSize:      batchSize,
+		apiURL:         apiURL,
+		apiToken:       apiToken,
+		client:         client,
+		stateStore:     stateStore,
+		stateRetention: retention,
+		logger:         logger,
+		messages:       make([]ImportMessage, 0, batchSize),
 	}
 }
 
 type httpBatchWriter struct {
-	batchSize    int
-	apiURL       string
-	apiToken     string
-	client       *retryablehttp.Client
-	messages     []ImportMessage
-	stateFileDir string
-	logger       StatusLogger
+	ctx            context.Context
+	batchSize      int
+	apiURL         string
+	apiToken       string
+	client         *retryablehttp.Client
+	messages       []ImportMessage
+	stateStore     StateStore
+	stateRetention StateRetention
+	logger         StatusLogger
 }
 
 type BatchResponse struct {
@@ -51,19 +57,19 @@ type BatchResponse struct {
 }
 
 func (h *httpBatchWriter) State(state State) error {
-	now := time.Now()
-
-	stateFileContents, err := json.Marshal(state)
+	cp, err := h.stateStore.Save(h.ctx, state)
 	if err != nil {
-		return err
+		h.logger.Error("unable to save state", slog.String("location", h.stateStore.String()), slog.String(ErrorKey, err.Error()))
+		return errors.Wrap(err, "unable to save state")
 	}
+	h.logger.Info("saved state", slog.String("location", h.stateStore.String()), slog.String("checkpoint", cp.ID))
 
-	statePath := filepath.Join(h.stateFileDir, fmt.Sprintf("state-%v.json", now.UnixMilli()))
-	h.logger.Info(fmt.Sprintf("saving state to path : %v", statePath))
-
-	if err := os.WriteFile(statePath, stateFileContents, fs.ModePerm); err != nil {
-		h.logger.Error(fmt.Sprintf("unable to save state to path %v", statePath))
-		return errors.Wrap(err, "unable to save state")
+	pruned, err := PruneState(h.ctx, h.stateStore, h.stateRetention)
+	if err != nil {
+		return errors.Wrap(err, "unable to prune state")
+	}
+	if len(pruned) > 0 {
+		h.logger.Debug("pruned state", slog.String("location", h.stateStore.String()), slog.Int("checkpoints", len(pruned)))
 	}
 	return nil
 }
@@ -74,48 +80,64 @@ func (h *httpBatchWriter) Flush(stream Stream) error {
 	}
 
 	batches := getBatchMessages(h.messages, stream, MaxObjectsInBatch, MaxBatchRequestSize)
-	h.logger.Info(fmt.Sprintf("flushing [%v] messages for stream %q in [%v] batches", len(h.messages), stream.Name, len(batches)))
+	h.logger.Info("flushing messages",
+		slog.String(StreamKey, stream.Name),
+		slog.Int(BatchSizeKey, len(h.messages)),
+		slog.Int("batches", len(batches)),
+	)
 	if len(batches) > 0 {
 		h.printLastPKSynced(batches[len(batches)-1], stream)
 	}
 
 	for _, batch := range batches {
-		b, err := json.Marshal(batch)
-		if err != nil {
+		if err := h.postBatch(batch, stream); err != nil {
 			return err
 		}
+	}
+	h.messages = h.messages[:0]
 
-		stitch, err := retryablehttp.NewRequest("POST", h.apiURL+"/v2/import/batch", bytes.NewBuffer(b))
-		if err != nil {
-			return err
-		}
-		stitch.Header.Set("Content-Type", "application/json")
-		stitch.Header.Set("Authorization", "Bearer "+h.apiToken)
+	return nil
+}
 
-		stitchResponse, err := h.client.Do(stitch)
-		if err != nil {
-			return err
-		}
+func (h *httpBatchWriter) postBatch(batch ImportBatch, stream Stream) (err error) {
+	ctx, span := startSpan(h.ctx, "httpBatchWriter.postBatch",
+		streamAttribute.String(stream.Name),
+		batchSizeAttribute.Int(len(batch.Messages)),
+	)
+	defer func() { endSpan(span, err) }()
 
-		defer stitchResponse.Body.Close()
+	b, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+	span.SetAttributes(attribute.Int("bytes", len(b)))
 
-		if stitchResponse.StatusCode > 203 {
-			body, err := io.ReadAll(stitchResponse.Body)
-			if err != nil {
-				return err
-			}
-			return fmt.Errorf("server request failed with %s", body)
-		}
+	stitch, err := retryablehttp.NewRequestWithContext(ctx, "POST", h.apiURL+"/v2/import/batch", bytes.NewBuffer(b))
+	if err != nil {
+		return err
+	}
+	stitch.Header.Set("Content-Type", "application/json")
+	stitch.Header.Set("Authorization", "Bearer "+h.apiToken)
 
-		var resp BatchResponse
-		decoder := json.NewDecoder(stitchResponse.Body)
-		if err := decoder.Decode(&resp); err != nil {
+	stitchResponse, err := h.client.Do(stitch)
+	if err != nil {
+		return err
+	}
+
+	defer stitchResponse.Body.Close()
+	span.SetAttributes(attribute.Int("http.status_code", stitchResponse.StatusCode))
+
+	if stitchResponse.StatusCode > 203 {
+		body, err := io.ReadAll(stitchResponse.Body)
+		if err != nil {
 			return err
 		}
+		return fmt.Errorf("server request failed with %s", body)
 	}
-	h.messages = h.messages[:0]
 
-	return nil
+	var resp BatchResponse
+	decoder := json.NewDecoder(stitchResponse.Body)
+	return decoder.Decode(&resp)
 }
 
 func (h *httpBatchWriter) printLastPKSynced(batch ImportBatch, stream Stream) {
@@ -124,12 +146,11 @@ func (h *httpBatchWriter) printLastPKSynced(batch ImportBatch, stream Stream) {
 	}
 
 	lastRowSynced := batch.Messages[len(batch.Messages)-1]
-	msg := fmt.Sprintf("Last row for table [%v] in the last batch  has primary keys : [ ", stream.TableName)
+	keys := make([]any, 0, len(stream.KeyProperties))
 	for _, keyProp := range stream.KeyProperties {
-		msg += fmt.Sprintf("{ %s : %v } ", keyProp, lastRowSynced.Data[keyProp])
+		keys = append(keys, slog.Any(keyProp, lastRowSynced.Data[keyProp]))
 	}
-	msg += "]"
-	h.logger.Info(msg)
+	h.logger.Debug("last row synced in the last batch", slog.String(StreamKey, stream.Name), slog.Group("primary_keys", keys...))
 }
 
 func (h *httpBatchWriter) Record(record Record, stream Stream) error {
@@ -1,9 +1,14 @@
 package internal
 
 import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestCanSplitIntoBatches(t *testing.T) {
@@ -30,3 +35,40 @@ func TestCanSplitIntoBatches(t *testing.T) {
 
 	assert.Equal(t, len(messages), totalMessages)
 }
+
+func TestSync_CommitsBatchesWithTransformedSchema(t *testing.T) {
+	var batches []ImportBatch
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var batch ImportBatch
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&batch))
+		batches = append(batches, batch)
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	catalog := getVerifyCatalog()
+	catalog.Streams[0].Metadata[1].Metadata.Transforms = []ColumnTransform{{Type: TransformRename, Name: "id"}}
+	catalog.Streams[0].Metadata[2].Metadata.Transforms = []ColumnTransform{{Type: TransformHash}}
+	ped := &testPlanetScaleEdgeDatabase{
+		ReadParamsFn: func(ctx context.Context, params ReadParams) (*SerializedCursor, error) {
+			if err := params.OnResult(getVerifyResult("10001|Georgi")); err != nil {
+				return nil, err
+			}
+			return TableCursorToSerializedCursor(params.LastKnownPosition)
+		},
+	}
+	logger := &testSingerLogger{}
+	writer := NewHttpRecordWriter(context.Background(), 100, server.URL, "token", NewLocalStateStore(t.TempDir()), StateRetention{}, logger)
+
+	_, err := Sync(context.Background(), getTestMysqlAccess(), ped, logger, PlanetScaleSource{Database: "employees"}, catalog, nil, writer, SyncSettings{})
+	require.NoError(t, err)
+
+	require.Len(t, batches, 1)
+	batch := batches[0]
+	assert.Equal(t, []string{"id"}, batch.PrimaryKeys, "keys should be named as they are emitted")
+	assert.Contains(t, batch.Schema.Properties, "id")
+	assert.NotContains(t, batch.Schema.Properties, "emp_no")
+	assert.Equal(t, []string{"null", "string"}, batch.Schema.Properties["first_name"].Types, "hashed columns should be strings")
+	require.Len(t, batch.Messages, 1)
+	assert.Contains(t, batch.Messages[0].Data, "id")
+}
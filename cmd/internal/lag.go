@@ -0,0 +1,162 @@
+package internal
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	psdbconnect "github.com/planetscale/airbyte-source/proto/psdbconnect/v1alpha1"
+)
+
+// replicaLagPollInterval is how often replication lag is checked again while waiting for it to drop.
+var replicaLagPollInterval = 10 * time.Second
+
+// replicaLagGuard checks the replication lag of the tablets a shard is about to be read from,
+// so that rows are only read from replica and rdonly tablets that are not too far behind their primary.
+// Shards are checked from every goroutine that reads them, so fellBack is guarded by mu.
+type replicaLagGuard struct {
+	mysqlDatabase PlanetScaleEdgeMysqlAccess
+	// primaryMysql selects rows from the primary tablet once a shard has fallen back to it,
+	// rows are selected with mysqlDatabase if nil.
+	primaryMysql PlanetScaleEdgeMysqlAccess
+	logger       Logger
+	source       PlanetScaleSource
+	settings     SyncSettings
+	route        TabletRoute
+
+	mu       sync.Mutex
+	fellBack bool
+}
+
+// selectDatabase checks every shard before rows are selected with SQL, and returns the connection to select them with.
+// Selects read from all shards at once, so they read from the primary tablet once any shard has fallen back to it.
+func (g *replicaLagGuard) selectDatabase(ctx context.Context, shards []string) (PlanetScaleEdgeMysqlAccess, error) {
+	for _, shard := range shards {
+		if _, _, err := g.check(ctx, shard); err != nil {
+			return nil, err
+		}
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.fellBack && g.primaryMysql != nil {
+		return g.primaryMysql, nil
+	}
+	return g.mysqlDatabase, nil
+}
+
+// check returns the tablets to read a shard from, limited to the cells whose tablets are within the maximum lag,
+// along with the highest lag of those tablets in seconds, or -1 if the lag is not checked.
+// While no tablet is within the maximum lag, it waits for up to the configured time for the lag to drop,
+// and then either falls back to the primary tablet or fails.
+func (g *replicaLagGuard) check(ctx context.Context, shard string) (TabletRoute, int64, error) {
+	if g.settings.MaxReplicaLag <= 0 || g.route.TabletType == psdbconnect.TabletType_primary {
+		return g.route, -1, nil
+	}
+
+	maxLag := int64(g.settings.MaxReplicaLag / time.Second)
+	deadline := time.Now().Add(g.settings.ReplicaLagWait)
+	for {
+		statuses, err := g.mysqlDatabase.GetReplicationStatus(ctx, g.source)
+		if err != nil {
+			return g.route, -1, errors.Wrap(err, "unable to check replication lag")
+		}
+
+		// a cell is only read from if all of its tablets are within the maximum lag,
+		// since any of them could be picked. Tablets whose lag is unknown might be arbitrarily far behind.
+		var (
+			order   []string
+			within        = map[string]bool{}
+			lags          = map[string]int64{}
+			lowest  int64 = -1
+			checked int
+		)
+		for _, status := range statuses {
+			cell := status.Cell()
+			if status.Shard != shard || !strings.EqualFold(status.TabletType, vitessTabletType(g.route.TabletType)) || !contains(g.route.Cells, cell) {
+				continue
+			}
+			checked++
+			if status.Lag >= 0 && (lowest < 0 || status.Lag < lowest) {
+				lowest = status.Lag
+			}
+			ok := status.Lag >= 0 && status.Lag <= maxLag
+			if _, seen := within[cell]; !seen {
+				order = append(order, cell)
+				within[cell] = ok
+			} else {
+				within[cell] = within[cell] && ok
+			}
+			if status.Lag > lags[cell] {
+				lags[cell] = status.Lag
+			}
+		}
+
+		var (
+			cells []string
+			lag   int64
+		)
+		for _, cell := range order {
+			if within[cell] {
+				cells = append(cells, cell)
+				if lags[cell] > lag {
+					lag = lags[cell]
+				}
+			}
+		}
+		if len(cells) > 0 {
+			g.logger.Info("replication lag is within the maximum",
+				slog.String(ShardKey, shard),
+				slog.String(TabletTypeKey, TabletTypeToString(g.route.TabletType)),
+				slog.Any(CellsKey, cells),
+				slog.Int64("lag_seconds", lag),
+			)
+			return TabletRoute{TabletType: g.route.TabletType, Cells: cells}, lag, nil
+		}
+
+		remaining := time.Until(deadline)
+		if remaining > 0 {
+			g.logger.Warn("replication lag exceeds the maximum, waiting for it to drop",
+				slog.String(ShardKey, shard),
+				slog.Int64("lag_seconds", lowest),
+				slog.Int("tablets", checked),
+			)
+			wait := replicaLagPollInterval
+			if remaining < wait {
+				wait = remaining
+			}
+			select {
+			case <-ctx.Done():
+				return g.route, lowest, ctx.Err()
+			case <-time.After(wait):
+			}
+			continue
+		}
+
+		if g.settings.ReplicaLagFallback {
+			tablets, err := g.mysqlDatabase.GetVitessTablets(ctx, g.source)
+			if err != nil {
+				return g.route, lowest, err
+			}
+			cells := servingCells(psdbconnect.TabletType_primary, tablets, nil)
+			if len(cells) == 0 {
+				return g.route, lowest, errors.Errorf("replication lag of shard %v exceeds %v and there is no serving primary tablet to fall back to", shard, g.settings.MaxReplicaLag)
+			}
+			g.logger.Warn("replication lag exceeds the maximum, reading from the primary tablet instead",
+				slog.String(ShardKey, shard),
+				slog.Int64("lag_seconds", lowest),
+			)
+			g.mu.Lock()
+			g.fellBack = true
+			g.mu.Unlock()
+			return TabletRoute{TabletType: psdbconnect.TabletType_primary, Cells: cells}, lowest, nil
+		}
+
+		if lowest < 0 {
+			return g.route, lowest, errors.Errorf("replication lag of %v tablets of shard %v is unknown", TabletTypeToString(g.route.TabletType), shard)
+		}
+		return g.route, lowest, errors.Errorf("replication lag of %v tablets of shard %v is %vs, which exceeds %v", TabletTypeToString(g.route.TabletType), shard, lowest, g.settings.MaxReplicaLag)
+	}
+}
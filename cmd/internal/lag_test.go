@@ -0,0 +1,180 @@
+package internal
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	psdbconnect "github.com/planetscale/airbyte-source/proto/psdbconnect/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"vitess.io/vitess/go/sqltypes"
+)
+
+func getLagGuard(settings SyncSettings, lags ...[]ReplicationStatus) (*replicaLagGuard, *mysqlAccessMock) {
+	tma := getTestMysqlAccess()
+	tma.GetVitessTabletsFn = func(ctx context.Context, psc PlanetScaleSource) ([]VitessTablet, error) {
+		return getRoutingTablets(), nil
+	}
+	calls := 0
+	tma.GetReplicationStatusFn = func(ctx context.Context, psc PlanetScaleSource) ([]ReplicationStatus, error) {
+		statuses := lags[calls]
+		if calls < len(lags)-1 {
+			calls++
+		}
+		return statuses, nil
+	}
+	return &replicaLagGuard{
+		mysqlDatabase: tma,
+		logger:        &testSingerLogger{},
+		settings:      settings,
+		route: TabletRoute{
+			TabletType: psdbconnect.TabletType_replica,
+			Cells:      []string{"aws_useast1b_2", "aws_useast1c_3"},
+		},
+	}, tma
+}
+
+func replicaStatus(alias string, lag int64) ReplicationStatus {
+	return ReplicationStatus{Keyspace: "employees", Shard: "-", TabletType: "REPLICA", Alias: alias, Lag: lag}
+}
+
+func TestReplicaLagGuard_OnlyReadsFromCellsWithinMaximumLag(t *testing.T) {
+	guard, _ := getLagGuard(SyncSettings{MaxReplicaLag: 10 * time.Second}, []ReplicationStatus{
+		replicaStatus("aws_useast1b_2-100", 3),
+		replicaStatus("aws_useast1c_3-200", 2),
+		replicaStatus("aws_useast1c_3-201", 30),
+		// tablets outside of the route are not read from, so their lag does not matter.
+		replicaStatus("aws_uswest2a_4-300", 1),
+		{Keyspace: "employees", Shard: "-80", TabletType: "REPLICA", Alias: "aws_useast1b_2-400", Lag: 100},
+	})
+	route, lag, err := guard.check(context.Background(), "-")
+	require.NoError(t, err)
+	assert.Equal(t, TabletRoute{TabletType: psdbconnect.TabletType_replica, Cells: []string{"aws_useast1b_2"}}, route)
+	assert.Equal(t, int64(3), lag)
+}
+
+func TestReplicaLagGuard_WaitsForLagToDrop(t *testing.T) {
+	replicaLagPollInterval = time.Millisecond
+	defer func() { replicaLagPollInterval = 10 * time.Second }()
+
+	guard, _ := getLagGuard(SyncSettings{MaxReplicaLag: 10 * time.Second, ReplicaLagWait: time.Minute},
+		[]ReplicationStatus{replicaStatus("aws_useast1b_2-100", 60)},
+		[]ReplicationStatus{replicaStatus("aws_useast1b_2-100", -1)},
+		[]ReplicationStatus{replicaStatus("aws_useast1b_2-100", 5)},
+	)
+	route, lag, err := guard.check(context.Background(), "-")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"aws_useast1b_2"}, route.Cells)
+	assert.Equal(t, int64(5), lag)
+}
+
+func TestReplicaLagGuard_FallsBackToPrimaryOrFails(t *testing.T) {
+	lagging := []ReplicationStatus{replicaStatus("aws_useast1b_2-100", 60), replicaStatus("aws_useast1c_3-200", 45)}
+
+	guard, _ := getLagGuard(SyncSettings{MaxReplicaLag: 10 * time.Second}, lagging)
+	_, lag, err := guard.check(context.Background(), "-")
+	assert.EqualError(t, err, "replication lag of replica tablets of shard - is 45s, which exceeds 10s")
+	assert.Equal(t, int64(45), lag)
+
+	guard, _ = getLagGuard(SyncSettings{MaxReplicaLag: 10 * time.Second, ReplicaLagFallback: true}, lagging)
+	route, lag, err := guard.check(context.Background(), "-")
+	require.NoError(t, err)
+	assert.Equal(t, TabletRoute{TabletType: psdbconnect.TabletType_primary, Cells: []string{"aws_useast1a_1"}}, route)
+	assert.Equal(t, int64(45), lag)
+}
+
+func TestReplicaLagGuard_DoesNotCheckPrimaryTablets(t *testing.T) {
+	guard, _ := getLagGuard(SyncSettings{}, nil)
+	route, lag, err := guard.check(context.Background(), "-")
+	require.NoError(t, err)
+	assert.Equal(t, guard.route, route)
+	assert.Equal(t, int64(-1), lag)
+
+	guard, _ = getLagGuard(SyncSettings{MaxReplicaLag: time.Second}, nil)
+	guard.route = TabletRoute{TabletType: psdbconnect.TabletType_primary, Cells: []string{"aws_useast1a_1"}}
+	route, _, err = guard.check(context.Background(), "-")
+	require.NoError(t, err)
+	assert.Equal(t, guard.route, route)
+}
+
+func TestSync_ReportsReplicaLag(t *testing.T) {
+	tma := getTestMysqlAccess()
+	tma.GetVitessTabletsFn = func(ctx context.Context, psc PlanetScaleSource) ([]VitessTablet, error) {
+		return getRoutingTablets(), nil
+	}
+	tma.GetReplicationStatusFn = func(ctx context.Context, psc PlanetScaleSource) ([]ReplicationStatus, error) {
+		return []ReplicationStatus{replicaStatus("aws_useast1c_3-200", 2)}, nil
+	}
+	var cells []string
+	ped := &testPlanetScaleEdgeDatabase{
+		ReadParamsFn: func(ctx context.Context, params ReadParams) (*SerializedCursor, error) {
+			cells = params.Cells
+			return TableCursorToSerializedCursor(params.LastKnownPosition)
+		},
+	}
+
+	source := PlanetScaleSource{Database: "employees", TabletTypes: []string{"replica"}}
+	report, err := Sync(context.Background(), tma, ped, &testSingerLogger{}, source, getOrderedCatalog(NodeMetadata{}), nil, &eventRecordWriter{}, SyncSettings{MaxReplicaLag: 10 * time.Second})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"aws_useast1c_3"}, cells)
+	shardReport := report.stream("stream0").Shards[0]
+	assert.Equal(t, "replica", shardReport.TabletType)
+	require.NotNil(t, shardReport.ReplicaLagSeconds)
+	assert.Equal(t, int64(2), *shardReport.ReplicaLagSeconds)
+}
+
+func TestReplicaLagGuard_SelectsFromPrimaryOnceShardFellBack(t *testing.T) {
+	primary := getTestMysqlAccess()
+	guard, replica := getLagGuard(SyncSettings{MaxReplicaLag: 10 * time.Second, ReplicaLagFallback: true},
+		[]ReplicationStatus{replicaStatus("aws_useast1b_2-100", 3)},
+		[]ReplicationStatus{replicaStatus("aws_useast1b_2-100", 60)},
+	)
+	guard.primaryMysql = primary
+
+	selectMysql, err := guard.selectDatabase(context.Background(), []string{"-"})
+	require.NoError(t, err)
+	assert.Same(t, replica, selectMysql)
+
+	selectMysql, err = guard.selectDatabase(context.Background(), []string{"-"})
+	require.NoError(t, err)
+	assert.Same(t, primary, selectMysql)
+}
+
+func TestSync_CopiesFromPrimaryAfterFallback(t *testing.T) {
+	replica := getTestMysqlAccess()
+	replica.GetVitessTabletsFn = func(ctx context.Context, psc PlanetScaleSource) ([]VitessTablet, error) {
+		return getRoutingTablets(), nil
+	}
+	replica.GetReplicationStatusFn = func(ctx context.Context, psc PlanetScaleSource) ([]ReplicationStatus, error) {
+		return []ReplicationStatus{replicaStatus("aws_useast1b_2-100", 60), replicaStatus("aws_useast1c_3-200", 45)}, nil
+	}
+	replica.GetTableRowsFn = func(ctx context.Context, psc PlanetScaleSource, query TableRowsQuery) (*sqltypes.Result, error) {
+		t.Error("rows should not be selected from lagging replicas")
+		return nil, nil
+	}
+	primary, queries := getCopyMysqlAccess(t, []int64{3}, "1|a", "2|b", "3|c", "4|d")
+
+	var tabletTypes []psdbconnect.TabletType
+	ped := &testPlanetScaleEdgeDatabase{
+		LatestPositionFn: func(ctx context.Context, params ReadParams) (string, error) {
+			tabletTypes = append(tabletTypes, params.TabletType)
+			return "MySQL56/e42292e8-e28f-11ec-9c5b-d680f5d655b3:1-10", nil
+		},
+		ReadParamsFn: func(ctx context.Context, params ReadParams) (*SerializedCursor, error) {
+			tabletTypes = append(tabletTypes, params.TabletType)
+			return TableCursorToSerializedCursor(params.LastKnownPosition)
+		},
+	}
+
+	source := PlanetScaleSource{Database: "employees", TabletTypes: []string{"replica"}}
+	settings := SyncSettings{MaxReplicaLag: 10 * time.Second, ReplicaLagFallback: true, CopyChunks: 2, PrimaryMysql: primary}
+	report, err := Sync(context.Background(), replica, ped, &testSingerLogger{}, source, getContinuousCatalog(), nil, &eventRecordWriter{}, settings)
+	require.NoError(t, err)
+	assert.NotEmpty(t, *queries)
+	assert.Equal(t, 4, report.stream("employees").Copy.RowsEmitted)
+	require.NotEmpty(t, tabletTypes)
+	for _, tabletType := range tabletTypes {
+		assert.Equal(t, psdbconnect.TabletType_primary, tabletType)
+	}
+}
@@ -1,16 +1,18 @@
 package internal
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"log/slog"
+	"strings"
+	"sync"
 	"time"
 )
 
 type Logger interface {
-	Log(message string)
-	Info(message string)
-	Error(message string)
+	StatusLogger
 	Schema(Catalog) error
 	StreamSchema(Stream) error
 	Record(Record, Stream) error
@@ -20,11 +22,76 @@ type Logger interface {
 
 const MaxBatchSize = 10000
 
+// Keys used for the structured fields attached to status messages,
+// so that every component reports the same value under the same name.
+const (
+	ComponentKey  = "component"
+	StreamKey     = "stream"
+	ShardKey      = "shard"
+	TabletTypeKey = "tablet_type"
+	CellsKey      = "cells"
+	PositionKey   = "position"
+	BatchSizeKey  = "batch_size"
+	ErrorKey      = "error"
+)
+
+// LogFormat controls how status messages are written to stderr.
+type LogFormat string
+
+const (
+	LogFormatText LogFormat = "text"
+	LogFormatJSON LogFormat = "json"
+)
+
+// ParseLogFormat validates a log format provided on the command line.
+func ParseLogFormat(format string) (LogFormat, error) {
+	switch LogFormat(strings.ToLower(format)) {
+	case LogFormatText:
+		return LogFormatText, nil
+	case LogFormatJSON:
+		return LogFormatJSON, nil
+	default:
+		return "", fmt.Errorf("unsupported log format %q, must be one of text, json", format)
+	}
+}
+
+// ParseLogLevel validates a log level provided on the command line.
+func ParseLogLevel(level string) (slog.Level, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return l, fmt.Errorf("unsupported log level %q, must be one of debug, info, warn, error", level)
+	}
+	return l, nil
+}
+
+// withAttrs returns a copy of base with extra appended,
+// so that a shared set of fields can be extended per message.
+func withAttrs(base []slog.Attr, extra ...slog.Attr) []slog.Attr {
+	attrs := make([]slog.Attr, 0, len(base)+len(extra))
+	attrs = append(attrs, base...)
+	return append(attrs, extra...)
+}
+
 func NewLogger(component string, stdout io.Writer, stderr io.Writer) Logger {
+	return NewStructuredLogger(component, stdout, stderr, LogFormatText, slog.LevelInfo)
+}
+
+// NewStructuredLogger returns a Logger that writes Singer messages to stdout
+// and leveled status messages to stderr in the requested format.
+func NewStructuredLogger(component string, stdout io.Writer, stderr io.Writer, format LogFormat, level slog.Level) Logger {
+	opts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	if format == LogFormatJSON {
+		handler = slog.NewJSONHandler(stderr, opts)
+	} else {
+		handler = slog.NewTextHandler(stderr, opts)
+	}
+
 	sl := singerLogger{
 		writer:        stdout,
 		stderr:        stderr,
 		component:     component,
+		status:        slog.New(handler).With(slog.String(ComponentKey, component)),
 		recordEncoder: json.NewEncoder(stdout),
 		records:       make([]Record, 0, MaxBatchSize),
 	}
@@ -32,23 +99,38 @@ func NewLogger(component string, stdout io.Writer, stderr io.Writer) Logger {
 }
 
 type singerLogger struct {
+	// mu guards the Singer messages written to stdout, which can be written by several streams at once.
+	mu            sync.Mutex
 	recordEncoder *json.Encoder
 	writer        io.Writer
 	stderr        io.Writer
+	status        *slog.Logger
 	records       []Record
 	component     string
 }
 
-func (sl *singerLogger) Info(msg string) {
-	sl.Log("INFO : " + msg)
+func (sl *singerLogger) Debug(msg string, attrs ...slog.Attr) {
+	sl.log(slog.LevelDebug, msg, attrs)
+}
+
+func (sl *singerLogger) Info(msg string, attrs ...slog.Attr) {
+	sl.log(slog.LevelInfo, msg, attrs)
+}
+
+func (sl *singerLogger) Warn(msg string, attrs ...slog.Attr) {
+	sl.log(slog.LevelWarn, msg, attrs)
 }
 
-func (sl *singerLogger) Error(msg string) {
-	sl.Log("ERROR : " + msg)
+func (sl *singerLogger) Error(msg string, attrs ...slog.Attr) {
+	sl.log(slog.LevelError, msg, attrs)
 }
 
 func (sl *singerLogger) Log(msg string) {
-	fmt.Fprintln(sl.stderr, sl.component+" : "+msg)
+	sl.log(slog.LevelInfo, msg, nil)
+}
+
+func (sl *singerLogger) log(level slog.Level, msg string, attrs []slog.Attr) {
+	sl.status.LogAttrs(context.Background(), level, msg, attrs...)
 }
 
 type StateMessage struct {
@@ -57,6 +139,8 @@ type StateMessage struct {
 }
 
 func (sl *singerLogger) State(state State) error {
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
 	return sl.recordEncoder.Encode(StateMessage{
 		Type:  "STATE",
 		Value: state,
@@ -65,27 +149,39 @@ func (sl *singerLogger) State(state State) error {
 
 func (sl *singerLogger) StreamSchema(stream Stream) error {
 	stream.Type = "SCHEMA"
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
 	return sl.recordEncoder.Encode(stream)
 }
 
 func (sl *singerLogger) Schema(schema Catalog) error {
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
 	return sl.recordEncoder.Encode(schema)
 }
 
 func (sl *singerLogger) Record(r Record, s Stream) error {
 	now := time.Now()
 	r.TimeExtracted = now.Format(time.RFC3339Nano)
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
 	sl.records = append(sl.records, r)
 	if len(sl.records) == MaxBatchSize {
-		sl.Flush(s)
+		sl.flush()
 	}
 	return nil
 }
 
 func (sl *singerLogger) Flush(s Stream) error {
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+	sl.flush()
+	return nil
+}
+
+func (sl *singerLogger) flush() {
 	for _, record := range sl.records {
 		sl.recordEncoder.Encode(record)
 	}
 	sl.records = sl.records[:0]
-	return nil
 }
@@ -0,0 +1,59 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogger_CanLogStructuredFields(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	logger := NewStructuredLogger("PlanetScale Tap", &stdout, &stderr, LogFormatJSON, slog.LevelInfo)
+
+	logger.Info("syncing rows from stream", slog.String(StreamKey, "employees"), slog.String(ShardKey, "-"))
+
+	var line map[string]interface{}
+	require.NoError(t, json.Unmarshal(stderr.Bytes(), &line))
+	assert.Equal(t, "INFO", line["level"])
+	assert.Equal(t, "syncing rows from stream", line["msg"])
+	assert.Equal(t, "PlanetScale Tap", line[ComponentKey])
+	assert.Equal(t, "employees", line[StreamKey])
+	assert.Equal(t, "-", line[ShardKey])
+	assert.Empty(t, stdout.String(), "status messages should not be written to stdout")
+}
+
+func TestLogger_CanFilterByLevel(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	logger := NewStructuredLogger("PlanetScale Tap", &stdout, &stderr, LogFormatText, slog.LevelWarn)
+
+	logger.Debug("peeking to see if there's any new rows")
+	logger.Info("no new rows found, exiting")
+	logger.Warn("returning with cursor after grpc error")
+	logger.Error("non-grpc error")
+
+	lines := strings.Split(strings.TrimSpace(stderr.String()), "\n")
+	require.Len(t, lines, 2)
+	assert.Contains(t, lines[0], "level=WARN")
+	assert.Contains(t, lines[1], "level=ERROR")
+}
+
+func TestLogger_CanParseFormatAndLevel(t *testing.T) {
+	format, err := ParseLogFormat("JSON")
+	assert.NoError(t, err)
+	assert.Equal(t, LogFormatJSON, format)
+
+	_, err = ParseLogFormat("xml")
+	assert.ErrorContains(t, err, "unsupported log format")
+
+	level, err := ParseLogLevel("debug")
+	assert.NoError(t, err)
+	assert.Equal(t, slog.LevelDebug, level)
+
+	_, err = ParseLogLevel("chatty")
+	assert.ErrorContains(t, err, "unsupported log level")
+}
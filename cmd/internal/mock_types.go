@@ -4,9 +4,15 @@ import (
 	"context"
 	"database/sql"
 	"io"
+	"log/slog"
+	"sync"
 
 	psdbconnect "github.com/planetscale/airbyte-source/proto/psdbconnect/v1alpha1"
 	"google.golang.org/grpc"
+	"vitess.io/vitess/go/sqltypes"
+	querypb "vitess.io/vitess/go/vt/proto/query"
+	vtgatepb "vitess.io/vitess/go/vt/proto/vtgate"
+	vtgateservicepb "vitess.io/vitess/go/vt/proto/vtgateservice"
 )
 
 func NewTestLogger() Logger {
@@ -27,7 +33,15 @@ func (tal *testSingerLogger) Log(message string) {
 	tal.logMessages = append(tal.logMessages, message)
 }
 
-func (tal *testSingerLogger) Info(message string) {
+func (tal *testSingerLogger) Debug(message string, attrs ...slog.Attr) {
+	tal.logMessages = append(tal.logMessages, message)
+}
+
+func (tal *testSingerLogger) Info(message string, attrs ...slog.Attr) {
+	tal.logMessages = append(tal.logMessages, message)
+}
+
+func (tal *testSingerLogger) Warn(message string, attrs ...slog.Attr) {
 	tal.logMessages = append(tal.logMessages, message)
 }
 
@@ -35,7 +49,9 @@ type testPlanetScaleEdgeDatabase struct {
 	CanConnectFn        func(ctx context.Context, ps PlanetScaleSource) error
 	CanConnectFnInvoked bool
 	ReadFn              func(ctx context.Context, ps PlanetScaleSource, s Stream, tc *psdbconnect.TableCursor) (*SerializedCursor, error)
+	ReadParamsFn        func(ctx context.Context, params ReadParams) (*SerializedCursor, error)
 	ReadFnInvoked       bool
+	LatestPositionFn    func(ctx context.Context, params ReadParams) (string, error)
 }
 
 func (tpe *testPlanetScaleEdgeDatabase) CanConnect(ctx context.Context, ps PlanetScaleSource) error {
@@ -45,17 +61,26 @@ func (tpe *testPlanetScaleEdgeDatabase) CanConnect(ctx context.Context, ps Plane
 
 func (tpe *testPlanetScaleEdgeDatabase) Read(ctx context.Context, params ReadParams) (*SerializedCursor, error) {
 	tpe.ReadFnInvoked = true
+	if tpe.ReadParamsFn != nil {
+		return tpe.ReadParamsFn(ctx, params)
+	}
 	return tpe.ReadFn(ctx, params.Source, params.Table, params.LastKnownPosition)
 }
 
+func (tpe *testPlanetScaleEdgeDatabase) LatestPosition(ctx context.Context, params ReadParams) (string, error) {
+	if tpe.LatestPositionFn == nil {
+		return "", nil
+	}
+	return tpe.LatestPositionFn(ctx, params)
+}
+
 func (tpe *testPlanetScaleEdgeDatabase) Close() error {
 	// TODO implement me
 	panic("implement me")
 }
 
-func (tal *testSingerLogger) Error(message string) {
-	// TODO implement me
-	panic("implement me")
+func (tal *testSingerLogger) Error(message string, attrs ...slog.Attr) {
+	tal.logMessages = append(tal.logMessages, message)
 }
 
 func (tal *testSingerLogger) State(state State) error {
@@ -124,42 +149,64 @@ func (c *clientConnectionMock) Sync(ctx context.Context, in *psdbconnect.SyncReq
 	return c.syncFn(ctx, in, opts...)
 }
 
-type mysqlAccessMock struct {
-	PingContextFn                func(ctx context.Context, source PlanetScaleSource) error
-	PingContextFnInvoked         bool
-	GetVitessTabletsFn           func(ctx context.Context, psc PlanetScaleSource) ([]VitessTablet, error)
-	GetVitessTabletsFnInvoked    bool
-	GetTableNamesFn              func(ctx context.Context, source PlanetScaleSource) ([]string, error)
-	GetTableNamesFnInvoked       bool
-	GetTableSchemaFn             func(ctx context.Context, source PlanetScaleSource, s string) (map[string]StreamProperty, error)
-	GetTableSchemaFnInvoked      bool
-	GetTablePrimaryKeysFn        func(ctx context.Context, source PlanetScaleSource, s string) ([]string, error)
-	GetTablePrimaryKeysFnInvoked bool
-	GetVitessShardsFn            func(ctx context.Context, psc PlanetScaleSource) ([]string, error)
-	GetVitessShardsFnInvoked     bool
+type vitessClientMock struct {
+	vtgateservicepb.VitessClient
+	vstreamFn       func(ctx context.Context, in *vtgatepb.VStreamRequest, opts ...grpc.CallOption) (vtgateservicepb.Vitess_VStreamClient, error)
+	vstreamRequests []*vtgatepb.VStreamRequest
 }
 
-func (tma *mysqlAccessMock) PingContext(ctx context.Context, source PlanetScaleSource) error {
-	tma.PingContextFnInvoked = true
-	return tma.PingContextFn(ctx, source)
+func (c *vitessClientMock) VStream(ctx context.Context, in *vtgatepb.VStreamRequest, opts ...grpc.CallOption) (vtgateservicepb.Vitess_VStreamClient, error) {
+	c.vstreamRequests = append(c.vstreamRequests, in)
+	return c.vstreamFn(ctx, in, opts...)
 }
 
-func (tma *mysqlAccessMock) GetTableNames(ctx context.Context, source PlanetScaleSource) ([]string, error) {
-	tma.GetTableNamesFnInvoked = true
-	return tma.GetTableNamesFn(ctx, source)
+type vstreamClientMock struct {
+	lastResponseSent int
+	responses        []*vtgatepb.VStreamResponse
+	grpc.ClientStream
 }
 
-func (tma *mysqlAccessMock) GetTableSchema(ctx context.Context, source PlanetScaleSource, s string, b bool) (map[string]StreamProperty, error) {
-	tma.GetTableSchemaFnInvoked = true
-	return tma.GetTableSchemaFn(ctx, source, s)
+func (x *vstreamClientMock) Recv() (*vtgatepb.VStreamResponse, error) {
+	if x.lastResponseSent >= len(x.responses) {
+		return nil, io.EOF
+	}
+	x.lastResponseSent += 1
+	return x.responses[x.lastResponseSent-1], nil
 }
 
-func (tma *mysqlAccessMock) GetTablePrimaryKeys(ctx context.Context, source PlanetScaleSource, s string) ([]string, error) {
-	tma.GetTablePrimaryKeysFnInvoked = true
-	return tma.GetTablePrimaryKeysFn(ctx, source, s)
+type mysqlAccessMock struct {
+	PingContextFn             func(ctx context.Context, source PlanetScaleSource) error
+	PingContextFnInvoked      bool
+	GetVitessTabletsFn        func(ctx context.Context, psc PlanetScaleSource) ([]VitessTablet, error)
+	GetSchemaFn               func(ctx context.Context, source PlanetScaleSource, includedTables, excludedTables []string) ([]TableSchema, error)
+	GetSchemaFnInvoked        bool
+	GetVitessTabletsFnInvoked bool
+	GetVitessShardsFn         func(ctx context.Context, psc PlanetScaleSource) ([]string, error)
+	GetVitessShardsFnInvoked  bool
+	GetTableRowsFn            func(ctx context.Context, psc PlanetScaleSource, query TableRowsQuery) (*sqltypes.Result, error)
+	GetTableRowsFnInvoked     bool
+	StreamTableRowsFn         func(ctx context.Context, psc PlanetScaleSource, query TableRowsQuery, batchSize int, onRows func(*sqltypes.Result) error) error
+	GetKeyBoundariesFn        func(ctx context.Context, psc PlanetScaleSource, table, column string, chunks int) ([]sqltypes.Value, error)
+	GetReplicationStatusFn    func(ctx context.Context, psc PlanetScaleSource) ([]ReplicationStatus, error)
+	GetShardPositionFn        func(ctx context.Context, psc PlanetScaleSource, shard string, tabletType psdbconnect.TabletType) (string, error)
+	GetBinlogSettingsFn       func(ctx context.Context, psc PlanetScaleSource) (BinlogSettings, error)
+	GetTableFieldsFn          func(ctx context.Context, psc PlanetScaleSource, table string) ([]*querypb.Field, error)
+
+	// mu guards the invoked flags of methods that are called concurrently.
+	mu sync.Mutex
 }
 
-func (mysqlAccessMock) QueryContext(ctx context.Context, psc PlanetScaleSource, query string, args ...interface{}) (*sql.Rows, error) {
+func (tma *mysqlAccessMock) PingContext(ctx context.Context, source PlanetScaleSource) error {
+	tma.PingContextFnInvoked = true
+	return tma.PingContextFn(ctx, source)
+}
+
+func (tma *mysqlAccessMock) GetSchema(ctx context.Context, source PlanetScaleSource, includedTables, excludedTables []string) ([]TableSchema, error) {
+	tma.GetSchemaFnInvoked = true
+	return tma.GetSchemaFn(ctx, source, includedTables, excludedTables)
+}
+
+func (*mysqlAccessMock) QueryContext(ctx context.Context, psc PlanetScaleSource, query string, args ...interface{}) (*sql.Rows, error) {
 	// TODO implement me
 	panic("implement me")
 }
@@ -173,4 +220,51 @@ func (tma *mysqlAccessMock) GetVitessShards(ctx context.Context, psc PlanetScale
 	tma.GetVitessShardsFnInvoked = true
 	return tma.GetVitessShardsFn(ctx, psc)
 }
-func (mysqlAccessMock) Close() error { return nil }
+
+func (tma *mysqlAccessMock) GetReplicationStatus(ctx context.Context, psc PlanetScaleSource) ([]ReplicationStatus, error) {
+	if tma.GetReplicationStatusFn == nil {
+		return nil, nil
+	}
+	return tma.GetReplicationStatusFn(ctx, psc)
+}
+
+func (tma *mysqlAccessMock) GetShardPosition(ctx context.Context, psc PlanetScaleSource, shard string, tabletType psdbconnect.TabletType) (string, error) {
+	if tma.GetShardPositionFn == nil {
+		return "", nil
+	}
+	return tma.GetShardPositionFn(ctx, psc, shard, tabletType)
+}
+
+func (tma *mysqlAccessMock) GetBinlogSettings(ctx context.Context, psc PlanetScaleSource) (BinlogSettings, error) {
+	if tma.GetBinlogSettingsFn == nil {
+		return BinlogSettings{Format: "ROW", RowImage: "FULL", GTIDMode: "ON"}, nil
+	}
+	return tma.GetBinlogSettingsFn(ctx, psc)
+}
+
+func (tma *mysqlAccessMock) GetTableFields(ctx context.Context, psc PlanetScaleSource, table string) ([]*querypb.Field, error) {
+	if tma.GetTableFieldsFn == nil {
+		return nil, nil
+	}
+	return tma.GetTableFieldsFn(ctx, psc, table)
+}
+
+func (tma *mysqlAccessMock) GetKeyBoundaries(ctx context.Context, psc PlanetScaleSource, table, column string, chunks int) ([]sqltypes.Value, error) {
+	if tma.GetKeyBoundariesFn == nil {
+		return nil, nil
+	}
+	return tma.GetKeyBoundariesFn(ctx, psc, table, column, chunks)
+}
+
+func (tma *mysqlAccessMock) GetTableRows(ctx context.Context, psc PlanetScaleSource, query TableRowsQuery) (*sqltypes.Result, error) {
+	tma.mu.Lock()
+	tma.GetTableRowsFnInvoked = true
+	tma.mu.Unlock()
+	return tma.GetTableRowsFn(ctx, psc, query)
+}
+
+func (tma *mysqlAccessMock) StreamTableRows(ctx context.Context, psc PlanetScaleSource, query TableRowsQuery, batchSize int, onRows func(*sqltypes.Result) error) error {
+	return tma.StreamTableRowsFn(ctx, psc, query, batchSize, onRows)
+}
+
+func (*mysqlAccessMock) Close() error { return nil }
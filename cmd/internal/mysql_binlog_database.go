@@ -0,0 +1,525 @@
+package internal
+
+import (
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	psdbconnect "github.com/planetscale/airbyte-source/proto/psdbconnect/v1alpha1"
+	"go.opentelemetry.io/otel/attribute"
+	"google.golang.org/grpc/status"
+	"vitess.io/vitess/go/mysql"
+	"vitess.io/vitess/go/mysql/binlog"
+	"vitess.io/vitess/go/sqltypes"
+	querypb "vitess.io/vitess/go/vt/proto/query"
+	"vitess.io/vitess/go/vt/vttls"
+)
+
+// mysqlShard is the name of the only shard of a MySQL database without Vitess.
+const mysqlShard = "-"
+
+// defaultBinlogServerID is the server ID that binlogs are read with if the source has none.
+const defaultBinlogServerID = 1734829
+
+// binlogChecksumQuery tells the server which checksums this replica understands, under the names of both older and newer servers.
+const binlogChecksumQuery = "SET @master_binlog_checksum = @@global.binlog_checksum, @source_binlog_checksum = @@global.binlog_checksum"
+
+// binlogSnapshotBatchSize is how many rows are selected at a time while taking a snapshot of a table.
+var binlogSnapshotBatchSize = 10000
+
+// binlogStream is a stream of binlog events, such as a mysql.Conn that a binlog dump was requested on.
+type binlogStream interface {
+	ReadBinlogEvent() (mysql.BinlogEvent, error)
+	Close()
+}
+
+func NewMySQLBinlog(mysql PlanetScaleEdgeMysqlAccess, logger Logger, throttle *Throttle) PlanetScaleDatabase {
+	return &MySQLBinlogDatabase{
+		Mysql:    mysql,
+		Logger:   logger,
+		Throttle: throttle,
+	}
+}
+
+// MySQLBinlogDatabase is an implementation of the PlanetScaleDatabase interface for MySQL databases without Vitess.
+// It selects all rows of a table to take a snapshot of it, and then reads the changes to them from the binlog of the database,
+// starting at the GTID position that the snapshot was started at. The binlog must be row based, with GTIDs enabled.
+type MySQLBinlogDatabase struct {
+	Logger Logger
+	Mysql  PlanetScaleEdgeMysqlAccess
+	// Throttle limits how fast rows are read, reads are not limited if nil.
+	Throttle *Throttle
+	binlogFn func(ctx context.Context, ps PlanetScaleSource, position mysql.Position) (binlogStream, error)
+}
+
+func (p MySQLBinlogDatabase) CanConnect(ctx context.Context, psc PlanetScaleSource) error {
+	return p.Mysql.PingContext(ctx, psc)
+}
+
+func (p MySQLBinlogDatabase) LatestPosition(ctx context.Context, params ReadParams) (string, error) {
+	tc := params.LastKnownPosition
+	return p.getLatestCursorPosition(ctx, tc.Shard, tc.Keyspace, params.Table, params.Source, params.TabletType, params.Cells)
+}
+
+func (p MySQLBinlogDatabase) Close() error {
+	return p.Mysql.Close()
+}
+
+// Read reads rows from a table given a starting cursor, see readShard.
+// A cursor without a position, or with the last primary key that was selected, starts or resumes
+// the snapshot of the table, which is taken before the binlog is read.
+func (p MySQLBinlogDatabase) Read(ctx context.Context, params ReadParams) (*SerializedCursor, error) {
+	return readShard(ctx, "MySQLBinlogDatabase", p, p.Logger, p.Throttle, params)
+}
+
+// getLatestCursorPosition returns the GTID position that the database has executed up to.
+func (p MySQLBinlogDatabase) getLatestCursorPosition(ctx context.Context, shard, keyspace string, s Stream, ps PlanetScaleSource, tabletType psdbconnect.TabletType, cells []string) (_ string, err error) {
+	ctx, span := startSpan(ctx, "MySQLBinlogDatabase.getLatestCursorPosition",
+		streamAttribute.String(s.Name),
+		shardAttribute.String(shard),
+	)
+	defer func() { endSpan(span, err) }()
+
+	return p.Mysql.GetShardPosition(ctx, ps, shard, tabletType)
+}
+
+func (p MySQLBinlogDatabase) sync(ctx context.Context, tc *psdbconnect.TableCursor, stopPosition string, readDuration time.Duration, params ReadParams) (_ *psdbconnect.TableCursor, err error) {
+	defer p.Logger.Flush(params.Table)
+
+	rows := 0
+	ctx, span := startSpan(ctx, "MySQLBinlogDatabase.sync",
+		streamAttribute.String(params.Table.Name),
+		shardAttribute.String(tc.Shard),
+		positionAttribute.String(tc.Position),
+	)
+	defer func() {
+		span.SetAttributes(attribute.Int("rows", rows))
+		if errors.Is(err, io.EOF) {
+			endSpan(span, nil)
+			return
+		}
+		endSpan(span, err)
+	}()
+
+	// a snapshot is always taken in full, recording its progress along the way, so it is not limited by the read duration.
+	if len(tc.Position) == 0 || tc.LastKnownPk != nil {
+		return p.snapshot(ctx, tc, params, &rows)
+	}
+	return p.readBinlog(ctx, tc, stopPosition, readDuration, params, &rows)
+}
+
+// snapshot selects the rows of a table in batches ordered by its key columns, after the last primary key of the cursor if it has one.
+// A snapshot starts at the current position of the database, so that rows that change while it is taken are read again from the binlog.
+func (p MySQLBinlogDatabase) snapshot(ctx context.Context, tc *psdbconnect.TableCursor, params ReadParams, rows *int) (*psdbconnect.TableCursor, error) {
+	if len(tc.Position) == 0 {
+		position, err := p.Mysql.GetShardPosition(ctx, params.Source, tc.Shard, params.TabletType)
+		if err != nil {
+			return tc, err
+		}
+		tc = &psdbconnect.TableCursor{Shard: tc.Shard, Keyspace: tc.Keyspace, Position: position}
+	}
+
+	keys := params.Table.KeyProperties
+	var after []sqltypes.Value
+	if tc.LastKnownPk != nil {
+		lastPK := sqltypes.Proto3ToResult(tc.LastKnownPk)
+		if len(lastPK.Rows) != 1 {
+			return tc, errors.Errorf("last primary key of table %v has %v rows", params.Table.tableName(), len(lastPK.Rows))
+		}
+		// only the key columns of the last primary key are selected after, it may hold others.
+		after = keyValues(lastPK, 0, keys)
+	}
+
+	columns, err := p.columns(ctx, params)
+	if err != nil {
+		return tc, err
+	}
+	for _, key := range keys {
+		if !contains(columns, key) {
+			columns = append(columns, key)
+		}
+	}
+
+	emitRows := func(qr *sqltypes.Result) error {
+		for _, row := range qr.Rows {
+			*rows++
+			result := &sqltypes.Result{Fields: qr.Fields, Rows: []sqltypes.Row{row}}
+			if err := p.Throttle.wait(ctx, params.Table, result); err != nil {
+				return err
+			}
+			if params.OnResult != nil {
+				if err := params.OnResult(result); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	// tables without keys can't be selected in batches, so their rows are streamed by a single query.
+	if len(keys) == 0 {
+		query := TableRowsQuery{Table: params.Table.tableName(), Columns: columns}
+		if err := p.Mysql.StreamTableRows(ctx, params.Source, query, binlogSnapshotBatchSize, emitRows); err != nil {
+			return tc, err
+		}
+		tc = &psdbconnect.TableCursor{Shard: tc.Shard, Keyspace: tc.Keyspace, Position: tc.Position}
+		if params.OnCursor != nil {
+			if err := params.OnCursor(tc); err != nil {
+				return tc, err
+			}
+		}
+		return tc, nil
+	}
+
+	for {
+		query := TableRowsQuery{
+			Table:      params.Table.tableName(),
+			Columns:    columns,
+			KeyColumns: keys,
+			After:      after,
+			Limit:      binlogSnapshotBatchSize,
+		}
+		qr, err := p.Mysql.GetTableRows(ctx, params.Source, query)
+		if err != nil {
+			return tc, err
+		}
+		if err := emitRows(qr); err != nil {
+			return tc, err
+		}
+
+		next := &psdbconnect.TableCursor{Shard: tc.Shard, Keyspace: tc.Keyspace, Position: tc.Position}
+		if len(qr.Rows) == query.Limit {
+			after = keyValues(qr, len(qr.Rows)-1, keys)
+			keyFields := make([]*querypb.Field, 0, len(keys))
+			for _, key := range keys {
+				for _, field := range qr.Fields {
+					if field.Name == key {
+						keyFields = append(keyFields, field)
+					}
+				}
+			}
+			next.LastKnownPk = sqltypes.ResultToProto3(&sqltypes.Result{Fields: keyFields, Rows: []sqltypes.Row{after}})
+		}
+		tc = next
+		if params.OnCursor != nil {
+			if err := params.OnCursor(tc); err != nil {
+				return tc, err
+			}
+		}
+		if tc.LastKnownPk == nil {
+			return tc, nil
+		}
+	}
+}
+
+// readBinlog reads the changes to the rows of a table from the binlog, starting at the position of the cursor.
+func (p MySQLBinlogDatabase) readBinlog(ctx context.Context, tc *psdbconnect.TableCursor, stopPosition string, readDuration time.Duration, params ReadParams, rows *int) (*psdbconnect.TableCursor, error) {
+	// waiting for the throttle may outlast the read duration, so that a transaction is never read in part.
+	throttleCtx := ctx
+	if readDuration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, readDuration)
+		defer cancel()
+	}
+
+	current, err := mysql.DecodePosition(tc.Position)
+	if err != nil {
+		return tc, errors.Wrapf(err, "unable to decode position %q", tc.Position)
+	}
+	var stop mysql.Position
+	if len(stopPosition) > 0 {
+		if stop, err = mysql.DecodePosition(stopPosition); err != nil {
+			return tc, errors.Wrapf(err, "unable to decode stop position %q", stopPosition)
+		}
+	}
+
+	fields, err := p.Mysql.GetTableFields(ctx, params.Source, params.Table.tableName())
+	if err != nil {
+		return tc, err
+	}
+	columns, err := p.columns(ctx, params)
+	if err != nil {
+		return tc, err
+	}
+	var (
+		indexes        []int
+		selectedFields []*querypb.Field
+	)
+	for _, column := range columns {
+		for i, field := range fields {
+			if field.Name == column {
+				indexes = append(indexes, i)
+				selectedFields = append(selectedFields, field)
+			}
+		}
+	}
+
+	if err := p.checkBinlog(ctx, params.Source); err != nil {
+		return tc, err
+	}
+	stream, err := p.dumpBinlog(ctx, params.Source, current)
+	if err != nil {
+		return tc, err
+	}
+	// reading an event blocks until there is one, so the stream is closed to stop reading once the context is done.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			stream.Close()
+		case <-done:
+			stream.Close()
+		}
+	}()
+
+	var (
+		format    mysql.BinlogFormat
+		tableMaps = map[uint64]*mysql.TableMap{}
+		gtid      mysql.GTID
+		pending   []*sqltypes.Result
+	)
+	for {
+		event, err := stream.ReadBinlogEvent()
+		if err != nil {
+			if ctx.Err() != nil {
+				// a timeout ends a sync session in the same way as it does for a gRPC stream.
+				return tc, status.FromContextError(ctx.Err()).Err()
+			}
+			return tc, errors.Wrap(err, "unable to read binlog event")
+		}
+		if !event.IsValid() {
+			return tc, errors.New("read an invalid binlog event")
+		}
+		if event.IsFormatDescription() {
+			if format, err = event.Format(); err != nil {
+				return tc, errors.Wrap(err, "unable to read binlog format")
+			}
+			continue
+		}
+		// events can only be parsed once the format of the binlog is known.
+		if format.IsZero() {
+			continue
+		}
+		if event, _, err = event.StripChecksum(format); err != nil {
+			return tc, errors.Wrap(err, "unable to strip binlog event checksum")
+		}
+
+		switch {
+		case event.IsGTID():
+			if gtid, _, err = event.GTID(format); err != nil {
+				return tc, errors.Wrap(err, "unable to read GTID")
+			}
+		case event.IsTableMap():
+			tableMap, err := event.TableMap(format)
+			if err != nil {
+				return tc, errors.Wrap(err, "unable to read table map")
+			}
+			tableMaps[event.TableID(format)] = tableMap
+		case event.IsWriteRows(), event.IsUpdateRows():
+			tableMap := tableMaps[event.TableID(format)]
+			if tableMap == nil || tableMap.Database != params.Source.Database || tableMap.Name != params.Table.tableName() {
+				continue
+			}
+			if len(tableMap.Types) != len(fields) {
+				return tc, errors.Errorf("table %v has %v columns in the binlog, but %v in the database", params.Table.tableName(), len(tableMap.Types), len(fields))
+			}
+			changes, err := event.Rows(format, tableMap)
+			if err != nil {
+				return tc, errors.Wrap(err, "unable to read rows")
+			}
+			// a row image without all columns would emit the missing columns as null.
+			if changes.DataColumns.BitCount() != len(fields) {
+				return tc, errors.Errorf("row image of table %v has %v of its %v columns, binlog_row_image must be FULL",
+					params.Table.tableName(), changes.DataColumns.BitCount(), len(fields))
+			}
+			for _, change := range changes.Rows {
+				values, err := binlogRowValues(change.Data, changes.DataColumns, change.NullColumns, tableMap, fields)
+				if err != nil {
+					return tc, errors.Wrapf(err, "unable to read row of table %v", params.Table.tableName())
+				}
+				row := make(sqltypes.Row, 0, len(indexes))
+				for _, i := range indexes {
+					row = append(row, values[i])
+				}
+				pending = append(pending, &sqltypes.Result{Fields: selectedFields, Rows: []sqltypes.Row{row}})
+			}
+		case event.IsXID(), event.IsQuery():
+			if event.IsQuery() {
+				query, err := event.Query(format)
+				if err != nil {
+					return tc, errors.Wrap(err, "unable to read query")
+				}
+				// statements other than BEGIN, such as COMMIT or DDL, end the transaction of a GTID.
+				if strings.EqualFold(query.SQL, "BEGIN") {
+					continue
+				}
+			}
+			if gtid == nil {
+				continue
+			}
+			next := current.GTIDSet.AddGTID(gtid)
+			gtid = nil
+			current = mysql.Position{GTIDSet: next}
+
+			// when reading up to a fixed position, rows past it are left for the next sync session.
+			if len(params.StopPosition) > 0 && !stop.AtLeast(current) {
+				return tc, io.EOF
+			}
+			for _, result := range pending {
+				*rows++
+				if err := p.Throttle.wait(throttleCtx, params.Table, result); err != nil {
+					return tc, err
+				}
+				if params.OnResult != nil {
+					if err := params.OnResult(result); err != nil {
+						return tc, err
+					}
+				}
+			}
+			pending = nil
+
+			tc = &psdbconnect.TableCursor{Shard: tc.Shard, Keyspace: tc.Keyspace, Position: mysql.EncodePosition(current)}
+			if params.OnCursor != nil {
+				if err := params.OnCursor(tc); err != nil {
+					return tc, err
+				}
+			}
+			if !params.Continuous && len(stopPosition) > 0 && current.AtLeast(stop) {
+				return tc, io.EOF
+			}
+		}
+	}
+}
+
+// checkBinlog fails unless the binlog of a source holds the changes that are read from it,
+// which are the full rows of every change, with GTIDs to resume reading from.
+func (p MySQLBinlogDatabase) checkBinlog(ctx context.Context, ps PlanetScaleSource) error {
+	settings, err := p.Mysql.GetBinlogSettings(ctx, ps)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(settings.Format, "ROW") {
+		return errors.Errorf("binlog_format of the database is %v, changes can only be read with binlog_format ROW", settings.Format)
+	}
+	if !strings.EqualFold(settings.RowImage, "FULL") {
+		return errors.Errorf("binlog_row_image of the database is %v, changes can only be read with binlog_row_image FULL", settings.RowImage)
+	}
+	if !strings.EqualFold(settings.GTIDMode, "ON") {
+		return errors.Errorf("gtid_mode of the database is %v, changes can only be read with gtid_mode ON", settings.GTIDMode)
+	}
+	return nil
+}
+
+// columns returns the columns of a table to read, all of them if the params do not list any.
+func (p MySQLBinlogDatabase) columns(ctx context.Context, params ReadParams) ([]string, error) {
+	if len(params.Columns) > 0 {
+		return params.Columns, nil
+	}
+	fields, err := p.Mysql.GetTableFields(ctx, params.Source, params.Table.tableName())
+	if err != nil {
+		return nil, err
+	}
+	columns := make([]string, 0, len(fields))
+	for _, field := range fields {
+		columns = append(columns, field.Name)
+	}
+	return columns, nil
+}
+
+// dumpBinlog starts reading the binlog of a source from a position.
+func (p MySQLBinlogDatabase) dumpBinlog(ctx context.Context, ps PlanetScaleSource, position mysql.Position) (binlogStream, error) {
+	if p.binlogFn != nil {
+		return p.binlogFn(ctx, ps, position)
+	}
+
+	params, err := ps.binlogConnParams()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := mysql.Connect(ctx, params)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to connect to read the binlog")
+	}
+	// the server only sends events with checksums to replicas that declare that they understand them.
+	if _, err := conn.ExecuteFetch(binlogChecksumQuery, 0, false); err != nil {
+		conn.Close()
+		return nil, errors.Wrap(err, "unable to set the binlog checksum")
+	}
+	serverID := ps.BinlogServerID
+	if serverID == 0 {
+		serverID = defaultBinlogServerID
+	}
+	if err := conn.SendBinlogDumpCommand(serverID, "", position); err != nil {
+		conn.Close()
+		return nil, errors.Wrap(err, "unable to start reading the binlog")
+	}
+	return conn, nil
+}
+
+// binlogConnParams returns the parameters of a replication connection to the source, with its TLS settings.
+func (psc PlanetScaleSource) binlogConnParams() (*mysql.ConnParams, error) {
+	// the TLS settings are checked in the same way as they are for other connections.
+	if _, err := psc.TLSConfig(); err != nil {
+		return nil, err
+	}
+
+	host, port := psc.Host, 3306
+	if h, p, err := net.SplitHostPort(psc.Host); err == nil {
+		host = h
+		if port, err = strconv.Atoi(p); err != nil {
+			return nil, errors.Wrapf(err, "invalid port in host %q", psc.Host)
+		}
+	}
+
+	settings := psc.tlsSettings()
+	params := &mysql.ConnParams{
+		Host:       host,
+		Port:       port,
+		Uname:      psc.Username,
+		Pass:       psc.Password,
+		DbName:     psc.Database,
+		SslMode:    vttls.VerifyIdentity,
+		SslCa:      settings.CAFile,
+		SslCert:    settings.CertFile,
+		SslKey:     settings.KeyFile,
+		ServerName: settings.ServerName,
+	}
+	switch strings.ToLower(strings.TrimSpace(settings.Mode)) {
+	case TLSModeDisabled:
+		params.SslMode = vttls.Disabled
+	case TLSModeSkipVerify:
+		params.SslMode = vttls.Required
+	}
+	return params, nil
+}
+
+// binlogRowValues decodes the values of all columns of a row image in a rows event.
+func binlogRowValues(data []byte, dataColumns, nullColumns mysql.Bitmap, tableMap *mysql.TableMap, fields []*querypb.Field) ([]sqltypes.Value, error) {
+	values := make([]sqltypes.Value, dataColumns.Count())
+	// null columns are indexed by the columns that are present in the image, rather than all columns.
+	pos, present := 0, 0
+	for c := 0; c < dataColumns.Count(); c++ {
+		if !dataColumns.Bit(c) {
+			values[c] = sqltypes.NULL
+			continue
+		}
+		if nullColumns.Bit(present) {
+			values[c] = sqltypes.NULL
+			present++
+			continue
+		}
+		present++
+		value, length, err := binlog.CellValue(data, pos, tableMap.Types[c], tableMap.Metadata[c], fields[c])
+		if err != nil {
+			return nil, err
+		}
+		values[c] = value
+		pos += length
+	}
+	return values, nil
+}
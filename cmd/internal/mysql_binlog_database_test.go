@@ -0,0 +1,511 @@
+package internal
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+	psdbconnect "github.com/planetscale/airbyte-source/proto/psdbconnect/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"vitess.io/vitess/go/mysql"
+	"vitess.io/vitess/go/sqltypes"
+	querypb "vitess.io/vitess/go/vt/proto/query"
+	"vitess.io/vitess/go/vt/vttls"
+)
+
+const (
+	binlogTableID = 42
+	// binlogTypeLong and binlogTypeVarchar are the binlog types of the INT and VARCHAR columns of employees.
+	binlogTypeLong    = 3
+	binlogTypeVarchar = 15
+)
+
+var binlogSID = mysql.SID{0x3e, 0x11, 0xfa, 0x47, 0x71, 0xca, 0x11, 0xe1, 0x9e, 0x33, 0xc8, 0x0a, 0xa9, 0x42, 0x95, 0x62}
+
+// binlogStreamMock replays binlog events, and then reports that the connection was closed.
+type binlogStreamMock struct {
+	events []mysql.BinlogEvent
+	closed bool
+}
+
+func (s *binlogStreamMock) ReadBinlogEvent() (mysql.BinlogEvent, error) {
+	if len(s.events) == 0 {
+		return nil, io.EOF
+	}
+	event := s.events[0]
+	s.events = s.events[1:]
+	return event, nil
+}
+
+func (s *binlogStreamMock) Close() { s.closed = true }
+
+// binlogFixture builds the events of a binlog that changes the employees table.
+type binlogFixture struct {
+	format mysql.BinlogFormat
+	stream *mysql.FakeBinlogStream
+	events []mysql.BinlogEvent
+}
+
+func newBinlogFixture() *binlogFixture {
+	f := &binlogFixture{format: mysql.NewMySQL56BinlogFormat(), stream: mysql.NewFakeBinlogStream()}
+	f.events = append(f.events, mysql.NewFormatDescriptionEvent(f.format, f.stream))
+	return f
+}
+
+// transaction adds a transaction with the given GTID sequence number, which writes rows of employees with
+// the given first names, or updates them if update is set. Rows are numbered in the order they are given.
+func (f *binlogFixture) transaction(sequence uint64, table string, update bool, firstNames ...string) *binlogFixture {
+	gtid := make([]byte, 1+16+8)
+	copy(gtid[1:], binlogSID[:])
+	binary.LittleEndian.PutUint64(gtid[17:], sequence)
+	f.events = append(f.events,
+		mysql.NewMysql56BinlogEvent(f.stream.Packetize(f.format, 33, 0, gtid)),
+		mysql.NewQueryEvent(f.format, f.stream, mysql.Query{Database: "employees", SQL: "BEGIN"}),
+	)
+
+	tableMap := &mysql.TableMap{
+		Database:  "employees",
+		Name:      table,
+		Types:     []byte{binlogTypeLong, binlogTypeVarchar},
+		CanBeNull: mysql.NewServerBitmap(2),
+		Metadata:  []uint16{0, 255},
+	}
+	f.events = append(f.events, mysql.NewTableMapEvent(f.format, f.stream, binlogTableID, tableMap))
+
+	rows := mysql.Rows{DataColumns: mysql.NewServerBitmap(2)}
+	rows.DataColumns.Set(0, true)
+	rows.DataColumns.Set(1, true)
+	if update {
+		rows.IdentifyColumns = rows.DataColumns
+	}
+	for i, firstName := range firstNames {
+		data := binary.LittleEndian.AppendUint32(nil, uint32(i+1))
+		data = append(data, byte(len(firstName)))
+		data = append(data, firstName...)
+		row := mysql.Row{NullColumns: mysql.NewServerBitmap(2), Data: data}
+		if update {
+			row.NullIdentifyColumns = mysql.NewServerBitmap(2)
+			row.Identify = data
+		}
+		rows.Rows = append(rows.Rows, row)
+	}
+	if update {
+		f.events = append(f.events, mysql.NewUpdateRowsEvent(f.format, f.stream, binlogTableID, rows))
+	} else {
+		f.events = append(f.events, mysql.NewWriteRowsEvent(f.format, f.stream, binlogTableID, rows))
+	}
+	f.events = append(f.events, mysql.NewXIDEvent(f.format, f.stream))
+	return f
+}
+
+// minimalUpdate adds a transaction with the given GTID sequence number that updates the first name of the first row of employees,
+// with only the changed column in the row image, as binlog_row_image MINIMAL writes it.
+func (f *binlogFixture) minimalUpdate(sequence uint64, firstName string) *binlogFixture {
+	gtid := make([]byte, 1+16+8)
+	copy(gtid[1:], binlogSID[:])
+	binary.LittleEndian.PutUint64(gtid[17:], sequence)
+	tableMap := &mysql.TableMap{
+		Database:  "employees",
+		Name:      "employees",
+		Types:     []byte{binlogTypeLong, binlogTypeVarchar},
+		CanBeNull: mysql.NewServerBitmap(2),
+		Metadata:  []uint16{0, 255},
+	}
+	rows := mysql.Rows{IdentifyColumns: mysql.NewServerBitmap(2), DataColumns: mysql.NewServerBitmap(2)}
+	rows.IdentifyColumns.Set(0, true)
+	rows.DataColumns.Set(1, true)
+	rows.Rows = []mysql.Row{{
+		NullIdentifyColumns: mysql.NewServerBitmap(1),
+		Identify:            binary.LittleEndian.AppendUint32(nil, 1),
+		NullColumns:         mysql.NewServerBitmap(1),
+		Data:                append([]byte{byte(len(firstName))}, firstName...),
+	}}
+	f.events = append(f.events,
+		mysql.NewMysql56BinlogEvent(f.stream.Packetize(f.format, 33, 0, gtid)),
+		mysql.NewTableMapEvent(f.format, f.stream, binlogTableID, tableMap),
+		mysql.NewUpdateRowsEvent(f.format, f.stream, binlogTableID, rows),
+		mysql.NewXIDEvent(f.format, f.stream),
+	)
+	return f
+}
+
+// delete adds a transaction with the given GTID sequence number that deletes the first row of employees.
+func (f *binlogFixture) delete(sequence uint64) *binlogFixture {
+	gtid := make([]byte, 1+16+8)
+	copy(gtid[1:], binlogSID[:])
+	binary.LittleEndian.PutUint64(gtid[17:], sequence)
+	tableMap := &mysql.TableMap{
+		Database:  "employees",
+		Name:      "employees",
+		Types:     []byte{binlogTypeLong, binlogTypeVarchar},
+		CanBeNull: mysql.NewServerBitmap(2),
+		Metadata:  []uint16{0, 255},
+	}
+	rows := mysql.Rows{IdentifyColumns: mysql.NewServerBitmap(2)}
+	rows.IdentifyColumns.Set(0, true)
+	rows.IdentifyColumns.Set(1, true)
+	data := binary.LittleEndian.AppendUint32(nil, 1)
+	data = append(data, 0)
+	rows.Rows = []mysql.Row{{NullIdentifyColumns: mysql.NewServerBitmap(2), Identify: data}}
+	f.events = append(f.events,
+		mysql.NewMysql56BinlogEvent(f.stream.Packetize(f.format, 33, 0, gtid)),
+		mysql.NewTableMapEvent(f.format, f.stream, binlogTableID, tableMap),
+		mysql.NewDeleteRowsEvent(f.format, f.stream, binlogTableID, rows),
+		mysql.NewXIDEvent(f.format, f.stream),
+	)
+	return f
+}
+
+func getMySQLBinlogDatabase(latestPosition string, fixture *binlogFixture) (*MySQLBinlogDatabase, *mysqlAccessMock, *[]mysql.Position) {
+	tma := getTestMysqlAccess()
+	tma.GetShardPositionFn = func(ctx context.Context, psc PlanetScaleSource, shard string, tabletType psdbconnect.TabletType) (string, error) {
+		return latestPosition, nil
+	}
+	tma.GetTableFieldsFn = func(ctx context.Context, psc PlanetScaleSource, table string) ([]*querypb.Field, error) {
+		return []*querypb.Field{
+			{Name: "emp_no", Type: querypb.Type_INT32},
+			{Name: "first_name", Type: querypb.Type_VARCHAR},
+		}, nil
+	}
+	var positions []mysql.Position
+	md := &MySQLBinlogDatabase{
+		Logger: &testSingerLogger{},
+		Mysql:  tma,
+		binlogFn: func(ctx context.Context, ps PlanetScaleSource, position mysql.Position) (binlogStream, error) {
+			positions = append(positions, position)
+			return &binlogStreamMock{events: fixture.events}, nil
+		},
+	}
+	return md, tma, &positions
+}
+
+func readMySQLBinlog(t *testing.T, md *MySQLBinlogDatabase, tc *psdbconnect.TableCursor, columns []string) ([]string, []*psdbconnect.TableCursor) {
+	var (
+		firstNames []string
+		cursors    []*psdbconnect.TableCursor
+	)
+	sc, err := md.Read(context.Background(), ReadParams{
+		Source:            PlanetScaleSource{Database: "employees", Flavor: FlavorMySQL},
+		Table:             Stream{Name: "employees", KeyProperties: []string{"emp_no"}},
+		Columns:           columns,
+		LastKnownPosition: tc,
+		OnResult: func(result *sqltypes.Result) error {
+			for _, row := range result.Rows {
+				firstNames = append(firstNames, row[len(row)-1].ToString())
+			}
+			return nil
+		},
+		OnCursor: func(tc *psdbconnect.TableCursor) error {
+			cursors = append(cursors, tc)
+			return nil
+		},
+	})
+	require.NoError(t, err)
+	cursor, err := sc.SerializedCursorToTableCursor()
+	require.NoError(t, err)
+	return firstNames, append(cursors, cursor)
+}
+
+func TestMySQLBinlogRead_TakesSnapshotInBatches(t *testing.T) {
+	defer func(size int) { binlogSnapshotBatchSize = size }(binlogSnapshotBatchSize)
+	binlogSnapshotBatchSize = 2
+
+	md, tma, positions := getMySQLBinlogDatabase(vitessPosition1, newBinlogFixture())
+	var queries []TableRowsQuery
+	tma.GetTableRowsFn = func(ctx context.Context, psc PlanetScaleSource, query TableRowsQuery) (*sqltypes.Result, error) {
+		queries = append(queries, query)
+		result := &sqltypes.Result{Fields: []*querypb.Field{
+			{Name: "first_name", Type: querypb.Type_VARCHAR},
+			{Name: "emp_no", Type: querypb.Type_INT64},
+		}}
+		if len(query.After) == 0 {
+			result.Rows = []sqltypes.Row{
+				{sqltypes.NewVarChar("Georgi"), sqltypes.NewInt64(1)},
+				{sqltypes.NewVarChar("Bezalel"), sqltypes.NewInt64(2)},
+			}
+		} else {
+			result.Rows = []sqltypes.Row{{sqltypes.NewVarChar("Parto"), sqltypes.NewInt64(3)}}
+		}
+		return result, nil
+	}
+
+	var firstNames []string
+	sc, err := md.Read(context.Background(), ReadParams{
+		Source:            PlanetScaleSource{Database: "employees", Flavor: FlavorMySQL},
+		Table:             Stream{Name: "employees", KeyProperties: []string{"emp_no"}},
+		Columns:           []string{"first_name"},
+		LastKnownPosition: &psdbconnect.TableCursor{Keyspace: "employees", Shard: "-"},
+		OnResult: func(result *sqltypes.Result) error {
+			firstNames = append(firstNames, result.Rows[0][0].ToString())
+			return nil
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Georgi", "Bezalel", "Parto"}, firstNames)
+
+	require.Len(t, queries, 2)
+	// key columns are selected even when they are not, so that the snapshot can be resumed after them.
+	assert.Equal(t, []string{"first_name", "emp_no"}, queries[0].Columns)
+	assert.Equal(t, 2, queries[0].Limit)
+	assert.Equal(t, []sqltypes.Value{sqltypes.NewInt64(2)}, queries[1].After)
+
+	cursor, err := sc.SerializedCursorToTableCursor()
+	require.NoError(t, err)
+	// the snapshot starts the binlog at the position it was taken at, which has not moved since.
+	assert.Equal(t, vitessPosition1, cursor.Position)
+	assert.Nil(t, cursor.LastKnownPk)
+	assert.Empty(t, *positions)
+}
+
+func TestMySQLBinlogRead_StreamsSnapshotOfTablesWithoutKeys(t *testing.T) {
+	md, tma, _ := getMySQLBinlogDatabase(vitessPosition1, newBinlogFixture())
+	tma.GetTableRowsFn = func(ctx context.Context, psc PlanetScaleSource, query TableRowsQuery) (*sqltypes.Result, error) {
+		return nil, errors.New("tables without keys are not selected in batches")
+	}
+	var queries []TableRowsQuery
+	tma.StreamTableRowsFn = func(ctx context.Context, psc PlanetScaleSource, query TableRowsQuery, batchSize int, onRows func(*sqltypes.Result) error) error {
+		queries = append(queries, query)
+		fields := []*querypb.Field{{Name: "first_name", Type: querypb.Type_VARCHAR}}
+		for _, page := range [][]sqltypes.Row{
+			{{sqltypes.NewVarChar("Georgi")}, {sqltypes.NewVarChar("Bezalel")}},
+			{{sqltypes.NewVarChar("Parto")}},
+		} {
+			if err := onRows(&sqltypes.Result{Fields: fields, Rows: page}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var firstNames []string
+	sc, err := md.Read(context.Background(), ReadParams{
+		Source:            PlanetScaleSource{Database: "employees", Flavor: FlavorMySQL},
+		Table:             Stream{Name: "employees"},
+		Columns:           []string{"first_name"},
+		LastKnownPosition: &psdbconnect.TableCursor{Keyspace: "employees", Shard: "-"},
+		OnResult: func(result *sqltypes.Result) error {
+			firstNames = append(firstNames, result.Rows[0][0].ToString())
+			return nil
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Georgi", "Bezalel", "Parto"}, firstNames)
+
+	require.Len(t, queries, 1)
+	assert.Empty(t, queries[0].KeyColumns)
+	assert.Zero(t, queries[0].Limit)
+
+	cursor, err := sc.SerializedCursorToTableCursor()
+	require.NoError(t, err)
+	assert.Equal(t, vitessPosition1, cursor.Position)
+	assert.Nil(t, cursor.LastKnownPk)
+}
+
+func TestMySQLBinlogRead_ResumesSnapshotFromLastPrimaryKey(t *testing.T) {
+	md, tma, _ := getMySQLBinlogDatabase(vitessPosition1, newBinlogFixture())
+	var queries []TableRowsQuery
+	tma.GetTableRowsFn = func(ctx context.Context, psc PlanetScaleSource, query TableRowsQuery) (*sqltypes.Result, error) {
+		queries = append(queries, query)
+		return &sqltypes.Result{
+			Fields: []*querypb.Field{{Name: "emp_no", Type: querypb.Type_INT64}, {Name: "first_name", Type: querypb.Type_VARCHAR}},
+			Rows:   []sqltypes.Row{{sqltypes.NewInt64(3), sqltypes.NewVarChar("Parto")}},
+		}, nil
+	}
+
+	lastPK := sqltypes.ResultToProto3(&sqltypes.Result{
+		Fields: []*querypb.Field{{Name: "emp_no", Type: querypb.Type_INT64}, {Name: "first_name", Type: querypb.Type_VARCHAR}},
+		Rows:   []sqltypes.Row{{sqltypes.NewInt64(2), sqltypes.NewVarChar("Bezalel")}},
+	})
+	firstNames, cursors := readMySQLBinlog(t, md, &psdbconnect.TableCursor{Keyspace: "employees", Shard: "-", Position: vitessPosition1, LastKnownPk: lastPK}, []string{"emp_no", "first_name"})
+	assert.Equal(t, []string{"Parto"}, firstNames)
+
+	require.Len(t, queries, 1)
+	// only the key columns of the last primary key are selected after.
+	assert.Equal(t, []sqltypes.Value{sqltypes.NewInt64(2)}, queries[0].After)
+	assert.Equal(t, vitessPosition1, cursors[len(cursors)-1].Position)
+	assert.Nil(t, cursors[len(cursors)-1].LastKnownPk)
+}
+
+func TestMySQLBinlogRead_ReadsChangesFromBinlog(t *testing.T) {
+	fixture := newBinlogFixture().
+		transaction(6, "employees", false, "Georgi", "Bezalel").
+		// changes to other tables, and deletes, are not synced.
+		transaction(7, "departments", false, "Development").
+		delete(8).
+		transaction(9, "employees", true, "Chirstian").
+		transaction(10, "employees", false, "Kyoichi")
+	md, _, positions := getMySQLBinlogDatabase(vitessPosition3, fixture)
+
+	firstNames, cursors := readMySQLBinlog(t, md, &psdbconnect.TableCursor{Keyspace: "employees", Shard: "-", Position: vitessPosition1}, []string{"emp_no", "first_name"})
+	assert.Equal(t, []string{"Georgi", "Bezalel", "Chirstian"}, firstNames)
+
+	require.Len(t, *positions, 1)
+	assert.Equal(t, vitessPosition1, mysql.EncodePosition((*positions)[0]))
+	require.Len(t, cursors, 5)
+	assert.Equal(t, "MySQL56/3e11fa47-71ca-11e1-9e33-c80aa9429562:1-6", cursors[0].Position)
+	assert.Equal(t, vitessPosition2, cursors[1].Position)
+	// reading stops at the position that the database was at when the sync started.
+	assert.Equal(t, vitessPosition3, cursors[4].Position)
+}
+
+func TestMySQLBinlogRead_StopsAtStopPosition(t *testing.T) {
+	fixture := newBinlogFixture().
+		transaction(6, "employees", false, "Georgi").
+		transaction(7, "employees", false, "Bezalel").
+		transaction(8, "employees", false, "Parto")
+	md, _, _ := getMySQLBinlogDatabase(vitessPosition3, fixture)
+
+	var firstNames []string
+	sc, err := md.Read(context.Background(), ReadParams{
+		Source:            PlanetScaleSource{Database: "employees", Flavor: FlavorMySQL},
+		Table:             Stream{Name: "employees", KeyProperties: []string{"emp_no"}},
+		Columns:           []string{"first_name"},
+		LastKnownPosition: &psdbconnect.TableCursor{Keyspace: "employees", Shard: "-", Position: vitessPosition1},
+		StopPosition:      "MySQL56/3e11fa47-71ca-11e1-9e33-c80aa9429562:1-6",
+		OnResult: func(result *sqltypes.Result) error {
+			firstNames = append(firstNames, result.Rows[0][0].ToString())
+			return nil
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Georgi"}, firstNames)
+	cursor, err := sc.SerializedCursorToTableCursor()
+	require.NoError(t, err)
+	assert.Equal(t, "MySQL56/3e11fa47-71ca-11e1-9e33-c80aa9429562:1-6", cursor.Position)
+}
+
+func TestMySQLBinlogRead_RequiresFullRowImages(t *testing.T) {
+	fixture := newBinlogFixture().
+		transaction(6, "employees", false, "Georgi").
+		minimalUpdate(7, "Bezalel")
+	md, _, _ := getMySQLBinlogDatabase(vitessPosition3, fixture)
+
+	_, err := md.Read(context.Background(), ReadParams{
+		Source:            PlanetScaleSource{Database: "employees", Flavor: FlavorMySQL},
+		Table:             Stream{Name: "employees", KeyProperties: []string{"emp_no"}},
+		LastKnownPosition: &psdbconnect.TableCursor{Keyspace: "employees", Shard: "-", Position: vitessPosition1},
+	})
+	assert.ErrorContains(t, err, "row image of table employees has 1 of its 2 columns, binlog_row_image must be FULL")
+}
+
+func TestMySQLBinlogRead_ChecksBinlogSettings(t *testing.T) {
+	tests := []struct {
+		settings BinlogSettings
+		err      string
+	}{
+		{BinlogSettings{Format: "MIXED", RowImage: "FULL", GTIDMode: "ON"}, "binlog_format of the database is MIXED"},
+		{BinlogSettings{Format: "ROW", RowImage: "MINIMAL", GTIDMode: "ON"}, "binlog_row_image of the database is MINIMAL"},
+		{BinlogSettings{Format: "ROW", RowImage: "FULL", GTIDMode: "OFF_PERMISSIVE"}, "gtid_mode of the database is OFF_PERMISSIVE"},
+	}
+	for _, tt := range tests {
+		md, tma, positions := getMySQLBinlogDatabase(vitessPosition3, newBinlogFixture())
+		tma.GetBinlogSettingsFn = func(ctx context.Context, psc PlanetScaleSource) (BinlogSettings, error) {
+			return tt.settings, nil
+		}
+		_, err := md.Read(context.Background(), ReadParams{
+			Source:            PlanetScaleSource{Database: "employees", Flavor: FlavorMySQL},
+			Table:             Stream{Name: "employees", KeyProperties: []string{"emp_no"}},
+			LastKnownPosition: &psdbconnect.TableCursor{Keyspace: "employees", Shard: "-", Position: vitessPosition1},
+		})
+		assert.ErrorContains(t, err, tt.err)
+		assert.Empty(t, *positions, "the binlog should not be read")
+	}
+}
+
+func TestBinlogConnParams_AppliesTLSSettings(t *testing.T) {
+	params, err := PlanetScaleSource{Host: "mysql.internal", Database: "employees", Username: "user", Password: "pass"}.binlogConnParams()
+	require.NoError(t, err)
+	assert.Equal(t, "mysql.internal", params.Host)
+	assert.Equal(t, 3306, params.Port)
+	assert.Equal(t, vttls.VerifyIdentity, params.SslMode)
+
+	params, err = PlanetScaleSource{Host: "127.0.0.1:33060", TLS: &TLSSettings{Mode: "disabled"}}.binlogConnParams()
+	require.NoError(t, err)
+	assert.Equal(t, "127.0.0.1", params.Host)
+	assert.Equal(t, 33060, params.Port)
+	assert.Equal(t, vttls.Disabled, params.SslMode)
+
+	_, err = PlanetScaleSource{Host: "mysql.internal", TLS: &TLSSettings{Mode: "required"}}.binlogConnParams()
+	assert.Error(t, err)
+}
+
+// binlogServerMock is a MySQL server that serves the events of a binlog fixture to replicas.
+type binlogServerMock struct {
+	mysql.UnimplementedHandler
+	events  []mysql.BinlogEvent
+	mu      sync.Mutex
+	queries []string
+}
+
+func (s *binlogServerMock) ComQuery(c *mysql.Conn, query string, callback func(*sqltypes.Result) error) error {
+	s.mu.Lock()
+	s.queries = append(s.queries, query)
+	s.mu.Unlock()
+	return callback(&sqltypes.Result{})
+}
+
+func (s *binlogServerMock) ComPrepare(c *mysql.Conn, query string, bindVars map[string]*querypb.BindVariable) ([]*querypb.Field, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (s *binlogServerMock) ComStmtExecute(c *mysql.Conn, prepare *mysql.PrepareData, callback func(*sqltypes.Result) error) error {
+	return errors.New("not implemented")
+}
+
+func (s *binlogServerMock) ComRegisterReplica(c *mysql.Conn, replicaHost string, replicaPort uint16, replicaUser string, replicaPassword string) error {
+	return errors.New("not implemented")
+}
+
+func (s *binlogServerMock) ComBinlogDump(c *mysql.Conn, logFile string, binlogPos uint32) error {
+	return errors.New("not implemented")
+}
+
+func (s *binlogServerMock) ComBinlogDumpGTID(c *mysql.Conn, logFile string, logPos uint64, gtidSet mysql.GTIDSet) error {
+	s.mu.Lock()
+	s.queries = append(s.queries, "binlog dump")
+	s.mu.Unlock()
+	for _, event := range s.events {
+		if err := c.WriteBinlogEvent(event, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *binlogServerMock) WarningCount(c *mysql.Conn) uint16 { return 0 }
+
+func TestMySQLBinlogDump_SetsChecksumBeforeDumping(t *testing.T) {
+	fixture := newBinlogFixture().transaction(6, "employees", false, "Georgi")
+	server := &binlogServerMock{events: fixture.events}
+	listener, err := mysql.NewListener("tcp", "127.0.0.1:0", mysql.NewAuthServerNone(), server, 0, 0, false, false)
+	require.NoError(t, err)
+	defer listener.Close()
+	go listener.Accept()
+
+	position, err := mysql.DecodePosition(vitessPosition1)
+	require.NoError(t, err)
+	md := MySQLBinlogDatabase{Logger: &testSingerLogger{}}
+	stream, err := md.dumpBinlog(context.Background(), PlanetScaleSource{
+		Host:     listener.Addr().String(),
+		Database: "employees",
+		Flavor:   FlavorMySQL,
+		TLS:      &TLSSettings{Mode: TLSModeDisabled},
+	}, position)
+	require.NoError(t, err)
+	defer stream.Close()
+
+	for _, expected := range fixture.events {
+		event, err := stream.ReadBinlogEvent()
+		require.NoError(t, err)
+		assert.Equal(t, expected.Bytes(), event.Bytes())
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	// the checksums that are understood are declared before the binlog is dumped.
+	assert.Equal(t, []string{"use `employees`", binlogChecksumQuery, "binlog dump"}, server.queries)
+}
@@ -29,7 +29,7 @@ func parseSavedStateContents(contents []byte) (*State, error) {
 		return nil, fmt.Errorf("state file contents are invalid: %q", err)
 	}
 
-	if state == nil || len(state.Streams) == 0 {
+	if state == nil || (len(state.Streams) == 0 && len(state.Sources) == 0) {
 		wrappedState, err = ParseContents(contents, wrappedState)
 		if err != nil {
 			return nil, fmt.Errorf("state file contents are invalid: %q", err)
@@ -16,24 +16,68 @@ type PlanetScaleSource struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
 	Shards   string `json:"shards"`
+	// TabletTypes are the types of tablet to read rows from in order of preference, one of primary, replica or rdonly.
+	// The first type with a serving tablet is used.
+	TabletTypes []string `json:"tablet_types,omitempty"`
+	// Cells limits the tablets that rows are read from to these cells or regions.
+	Cells []string `json:"cells,omitempty"`
+	// PreferredCells are the cells or regions whose tablets are read from if they have any of the chosen type.
+	PreferredCells []string `json:"preferred_cells,omitempty"`
+	// TLS configures how connections are secured, see TLSSettings.
+	TLS *TLSSettings `json:"tls,omitempty"`
+	// Flavor is the kind of database to sync, one of planetscale, vitess for a self-hosted Vitess cluster
+	// or mysql for a MySQL database without Vitess, planetscale if empty.
+	Flavor string `json:"flavor,omitempty"`
+	// GRPCHost is the address of the gRPC API that rows are streamed from, Host if empty.
+	// Self-hosted vtgates usually serve it on another port than mysql.
+	GRPCHost string `json:"grpc_host,omitempty"`
+	// BinlogServerID is the server ID that the binlog of a mysql flavored database is read with,
+	// which must differ from the server IDs of the database's replicas.
+	BinlogServerID uint32 `json:"binlog_server_id,omitempty"`
+}
+
+const (
+	// FlavorPlanetScale streams rows from a PlanetScale database, see PlanetScaleEdgeDatabase.
+	FlavorPlanetScale = "planetscale"
+	// FlavorVitess streams rows from a self-hosted Vitess cluster, see VitessDatabase.
+	FlavorVitess = "vitess"
+	// FlavorMySQL reads rows from a MySQL database without Vitess, see MySQLBinlogDatabase.
+	FlavorMySQL = "mysql"
+)
+
+// isMySQL reports whether the source is a MySQL database without Vitess,
+// which has a single shard, mysqlShard, served by its primary.
+func (psc PlanetScaleSource) isMySQL() bool {
+	return strings.EqualFold(psc.Flavor, FlavorMySQL)
+}
+
+// grpcHost returns the address to dial the gRPC API of the source at.
+func (psc PlanetScaleSource) grpcHost() string {
+	if len(psc.GRPCHost) > 0 {
+		return psc.GRPCHost
+	}
+	return psc.Host
 }
 
 // DSN returns a DataSource that mysql libraries can use to connect to a PlanetScale database.
-func (psc PlanetScaleSource) DSN(tt psdbconnect.TabletType) string {
+func (psc PlanetScaleSource) DSN(tt psdbconnect.TabletType) (string, error) {
 	config := mysql.NewConfig()
 	config.Net = "tcp"
 	config.Addr = psc.Host
 	config.User = psc.Username
-	config.DBName = psc.Database
+	config.DBName = fmt.Sprintf("%v@%v", psc.Database, TabletTypeToString(tt))
 	config.Passwd = psc.Password
+	if psc.isMySQL() {
+		// only vtgate knows how to target a type of tablet.
+		config.DBName = psc.Database
+	}
 
-	if useSecureConnection() {
-		config.TLSConfig = "true"
-		config.DBName = fmt.Sprintf("%v@%v", psc.Database, TabletTypeToString(tt))
-	} else {
-		config.TLSConfig = "skip-verify"
+	tlsConfig, err := psc.mysqlTLSConfig()
+	if err != nil {
+		return "", err
 	}
-	return config.FormatDSN()
+	config.TLSConfig = tlsConfig
+	return config.FormatDSN(), nil
 }
 
 // GetInitialState will return the initial/blank state for a given keyspace in all of its shards.
@@ -86,8 +130,11 @@ func useSecureConnection() bool {
 }
 
 func TabletTypeToString(t psdbconnect.TabletType) string {
-	if t == psdbconnect.TabletType_replica {
+	switch t {
+	case psdbconnect.TabletType_replica:
 		return "replica"
+	case psdbconnect.TabletType_read_only:
+		return "rdonly"
 	}
 
 	return "primary"
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"log/slog"
 	"strings"
 	"time"
 
@@ -14,16 +15,19 @@ import (
 	"github.com/planetscale/psdb/auth"
 	grpcclient "github.com/planetscale/psdb/core/pool"
 	clientoptions "github.com/planetscale/psdb/core/pool/options"
+	"go.opentelemetry.io/otel/attribute"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"vitess.io/vitess/go/mysql"
 	"vitess.io/vitess/go/sqltypes"
 	_ "vitess.io/vitess/go/vt/vtctl/grpcvtctlclient"
 	_ "vitess.io/vitess/go/vt/vtgate/grpcvtgateconn"
 )
 
 type (
-	OnResult func(*sqltypes.Result) error
-	OnCursor func(*psdbconnect.TableCursor) error
+	OnResult  func(*sqltypes.Result) error
+	OnCursor  func(*psdbconnect.TableCursor) error
+	OnOutcome func(ReadOutcome)
 )
 
 type ReadParams struct {
@@ -33,8 +37,20 @@ type ReadParams struct {
 	Columns           []string
 	OnResult          OnResult
 	OnCursor          OnCursor
+	OnOutcome         OnOutcome
 	TabletType        psdbconnect.TabletType
 	Cells             []string
+	// StopPosition is the position to read up to, the latest position of the shard is used if empty.
+	StopPosition string
+	// Continuous keeps reading changes as they happen, until the context is canceled,
+	// instead of stopping at a position.
+	Continuous bool
+}
+
+func (r ReadParams) reportOutcome(status ReadStatus, reason string) {
+	if r.OnOutcome != nil {
+		r.OnOutcome(ReadOutcome{Status: status, Reason: reason})
+	}
 }
 
 var binlogsPurgedMessage = "Cannot replicate because the master purged required binary logs"
@@ -44,22 +60,40 @@ var binlogsPurgedMessage = "Cannot replicate because the master purged required
 type PlanetScaleDatabase interface {
 	CanConnect(ctx context.Context, ps PlanetScaleSource) error
 	Read(ctx context.Context, params ReadParams) (*SerializedCursor, error)
+	// LatestPosition returns the current position of the shard in params.LastKnownPosition.
+	LatestPosition(ctx context.Context, params ReadParams) (string, error)
 	Close() error
 }
 
-func NewEdge(mysql PlanetScaleEdgeMysqlAccess, logger Logger) PlanetScaleDatabase {
+func NewEdge(mysql PlanetScaleEdgeMysqlAccess, logger Logger, throttle *Throttle) PlanetScaleDatabase {
 	return &PlanetScaleEdgeDatabase{
-		Mysql:  mysql,
-		Logger: logger,
+		Mysql:    mysql,
+		Logger:   logger,
+		Throttle: throttle,
 	}
 }
 
+// NewDatabase returns the implementation of PlanetScaleDatabase for the flavor of a source.
+func NewDatabase(psc PlanetScaleSource, mysql PlanetScaleEdgeMysqlAccess, logger Logger, throttle *Throttle) (PlanetScaleDatabase, error) {
+	switch strings.ToLower(psc.Flavor) {
+	case "", FlavorPlanetScale:
+		return NewEdge(mysql, logger, throttle), nil
+	case FlavorVitess:
+		return NewVitess(mysql, logger, throttle), nil
+	case FlavorMySQL:
+		return NewMySQLBinlog(mysql, logger, throttle), nil
+	}
+	return nil, errors.Errorf("unsupported flavor %q, must be one of %v, %v, %v", psc.Flavor, FlavorPlanetScale, FlavorVitess, FlavorMySQL)
+}
+
 // PlanetScaleEdgeDatabase is an implementation of the PlanetScaleDatabase interface defined above.
 // It uses the mysql interface provided by PlanetScale for all schema/shard/tablet discovery and
 // the grpc API for incrementally syncing rows from PlanetScale.
 type PlanetScaleEdgeDatabase struct {
-	Logger   Logger
-	Mysql    PlanetScaleEdgeMysqlAccess
+	Logger Logger
+	Mysql  PlanetScaleEdgeMysqlAccess
+	// Throttle limits how fast rows are read, reads are not limited if nil.
+	Throttle *Throttle
 	clientFn func(ctx context.Context, ps PlanetScaleSource) (psdbconnect.ConnectClient, error)
 }
 
@@ -67,17 +101,36 @@ func (p PlanetScaleEdgeDatabase) CanConnect(ctx context.Context, psc PlanetScale
 	return p.Mysql.PingContext(ctx, psc)
 }
 
+func (p PlanetScaleEdgeDatabase) LatestPosition(ctx context.Context, params ReadParams) (string, error) {
+	tc := params.LastKnownPosition
+	return p.getLatestCursorPosition(ctx, tc.Shard, tc.Keyspace, params.Table, params.Source, params.TabletType, params.Cells)
+}
+
 func (p PlanetScaleEdgeDatabase) Close() error {
 	return p.Mysql.Close()
 }
 
-// Read streams rows from a table given a starting cursor.
-// 1. We will get the latest vgtid for a given table in a shard when a sync session starts.
+// Read streams rows from a table given a starting cursor, see readShard.
+func (p PlanetScaleEdgeDatabase) Read(ctx context.Context, params ReadParams) (*SerializedCursor, error) {
+	return readShard(ctx, "PlanetScaleEdgeDatabase", p, p.Logger, p.Throttle, params)
+}
+
+// shardReader syncs the rows of a table in a shard from a position in one session, see readShard.
+type shardReader interface {
+	getLatestCursorPosition(ctx context.Context, shard, keyspace string, s Stream, ps PlanetScaleSource, tabletType psdbconnect.TabletType, cells []string) (string, error)
+	// sync reads rows from a cursor until the stop position, the read duration or an error,
+	// and returns the cursor it reached along with io.EOF if it reached the stop position.
+	sync(ctx context.Context, tc *psdbconnect.TableCursor, stopPosition string, readDuration time.Duration, params ReadParams) (*psdbconnect.TableCursor, error)
+}
+
+// readShard streams rows from a table given a starting cursor.
+// 1. We will get the latest vgtid for a given table in a shard when a sync session starts,
+// unless a stop position is given.
 // 2. This latest vgtid is now the stopping point for this sync session.
 // 3. Ask vstream to stream from the last known vgtid
 // 4. When we reach the stopping point, read all rows available at this vgtid
 // 5. End the stream when (a) a vgtid newer than latest vgtid is encountered or (b) the timeout kicks in.
-func (p PlanetScaleEdgeDatabase) Read(ctx context.Context, params ReadParams) (*SerializedCursor, error) {
+func readShard(ctx context.Context, name string, p shardReader, logger Logger, throttle *Throttle, params ReadParams) (*SerializedCursor, error) {
 	var (
 		err                     error
 		sErr                    error
@@ -87,79 +140,150 @@ func (p PlanetScaleEdgeDatabase) Read(ctx context.Context, params ReadParams) (*
 	currentPosition := params.LastKnownPosition
 
 	readDuration := 90 * time.Second
-	preamble := fmt.Sprintf("[table: %v, shard : %v, tablet: %v, cells : %v ] ", params.Table.Name, currentPosition.Shard, params.TabletType, params.Cells)
+	if params.Continuous {
+		// keep the stream open for as long as the context is.
+		readDuration = 0
+	}
+	logAttrs := []slog.Attr{
+		slog.String(StreamKey, params.Table.Name),
+		slog.String(ShardKey, currentPosition.Shard),
+		slog.String(TabletTypeKey, params.TabletType.String()),
+		slog.Any(CellsKey, params.Cells),
+	}
 
 	for {
+		iterationCtx, span := startSpan(ctx, name+".Read",
+			streamAttribute.String(params.Table.Name),
+			shardAttribute.String(currentPosition.Shard),
+			tabletTypeAttribute.String(params.TabletType.String()),
+			positionAttribute.String(currentPosition.Position),
+		)
 
-		p.Logger.Info(preamble + "peeking to see if there's any new rows")
-		latestCursorPosition, lcErr := p.getLatestCursorPosition(ctx, currentPosition.Shard, currentPosition.Keyspace, params.Table, params.Source, params.TabletType, params.Cells)
-		if lcErr != nil {
-			return currentSerializedCursor, errors.Wrap(err, "Unable to get latest cursor position")
+		logger.Debug("peeking to see if there's any new rows", logAttrs...)
+		latestCursorPosition := params.StopPosition
+		if len(latestCursorPosition) == 0 {
+			var lcErr error
+			// the position is looked up on every session, also in continuous mode, so that an unreachable shard fails the read.
+			latestCursorPosition, lcErr = p.getLatestCursorPosition(iterationCtx, currentPosition.Shard, currentPosition.Keyspace, params.Table, params.Source, params.TabletType, params.Cells)
+			if lcErr != nil {
+				endSpan(span, lcErr)
+				params.reportOutcome(ReadStatusFailed, "unable to get latest cursor position: "+lcErr.Error())
+				return currentSerializedCursor, errors.Wrap(lcErr, "Unable to get latest cursor position")
+			}
 		}
-
-		// the current vgtid is the same as the last synced vgtid, no new rows.
-		if latestCursorPosition == currentPosition.Position {
-			p.Logger.Info(preamble + "no new rows found, exiting")
+		logger.Debug("latest database position", withAttrs(logAttrs, slog.String(PositionKey, latestCursorPosition))...)
+
+		if params.Continuous {
+			// changes are read for as long as the context is, rather than up to the latest position.
+			latestCursorPosition = ""
+		} else if positionAtLeast(currentPosition.Position, latestCursorPosition) && currentPosition.LastKnownPk == nil {
+			// the last synced vgtid is the current vgtid or past it, no new rows,
+			// unless the rows of the table have not all been copied yet.
+			logger.Info("no new rows found, exiting", logAttrs...)
+			endSpan(span, nil)
+			params.reportOutcome(ReadStatusFinished, "")
 			return TableCursorToSerializedCursor(currentPosition)
 		}
-		p.Logger.Info(fmt.Sprintf(preamble+"syncing rows with cursor [%v]", currentPosition))
-		p.Logger.Info(fmt.Sprintf(preamble+"latest database position is [%v]", latestCursorPosition))
+		logger.Debug("syncing rows with cursor", withAttrs(logAttrs, slog.String(PositionKey, currentPosition.Position))...)
 
-		currentPosition, err = p.sync(ctx, currentPosition, latestCursorPosition, readDuration, params)
+		currentPosition, err = p.sync(iterationCtx, currentPosition, latestCursorPosition, readDuration, params)
 		if currentPosition.Position != "" {
 			currentSerializedCursor, sErr = TableCursorToSerializedCursor(currentPosition)
 			if sErr != nil {
 				// if we failed to serialize here, we should bail.
+				endSpan(span, sErr)
 				return currentSerializedCursor, errors.Wrap(sErr, "unable to serialize current position")
 			}
 		}
+		// a server timeout or reaching the stop position are expected ways for a sync session to end.
+		if s, ok := status.FromError(err); (ok && s.Code() == codes.DeadlineExceeded) || errors.Is(err, io.EOF) {
+			endSpan(span, nil)
+		} else {
+			endSpan(span, err)
+		}
+
 		if err != nil {
+			// an overloaded tablet is read from again once the throttle has slowed reads down.
+			if isOverloaded(err) {
+				if delay, ok := throttle.backoff(); ok {
+					logger.Warn("tablet is overloaded, slowing down reads", withAttrs(logAttrs, slog.String(PositionKey, currentPosition.Position), slog.Duration("delay", delay))...)
+					select {
+					case <-ctx.Done():
+						params.reportOutcome(ReadStatusInterrupted, "canceled while backing off")
+						return currentSerializedCursor, ctx.Err()
+					case <-time.After(delay):
+					}
+					continue
+				}
+			}
 			if s, ok := status.FromError(err); ok {
 
 				// if the error is unknown, it might be because the binlogs are purged, check for known error message
 				if s.Code() == codes.Unknown && params.LastKnownPosition != nil {
 					if strings.Contains(err.Error(), binlogsPurgedMessage) {
-						p.Logger.Info("Binlogs are purged, state is stale")
+						logger.Error("Binlogs are purged, state is stale", withAttrs(logAttrs, slog.String(PositionKey, params.LastKnownPosition.Position))...)
 						return currentSerializedCursor, fmt.Errorf("state for this sync operation [%v] is stale, please restart a full sync to get the latest state", params.LastKnownPosition.Position)
 					}
 				}
 				// if the error is anything other than server timeout, keep going
 				if s.Code() != codes.DeadlineExceeded {
-					p.Logger.Info(fmt.Sprintf("%v Got error [%v], Returning with cursor :[%v] after server timeout", preamble, s.Code(), currentPosition))
+					logger.Warn("returning with cursor after grpc error", withAttrs(logAttrs, slog.String(PositionKey, currentPosition.Position), slog.String(ErrorKey, s.Code().String()))...)
+					params.reportOutcome(ReadStatusInterrupted, s.Code().String())
 					return currentSerializedCursor, nil
 				} else {
-					p.Logger.Info(preamble + "Continuing with cursor after server timeout")
+					logger.Debug("continuing with cursor after server timeout", withAttrs(logAttrs, slog.String(PositionKey, currentPosition.Position))...)
 				}
 			} else if errors.Is(err, io.EOF) {
-				p.Logger.Info(fmt.Sprintf("%vFinished reading all rows for table [%v]", preamble, params.Table.Name))
+				logger.Info("finished reading all rows", withAttrs(logAttrs, slog.String(PositionKey, currentPosition.Position))...)
+				params.reportOutcome(ReadStatusFinished, "")
 				return currentSerializedCursor, nil
 			} else {
-				p.Logger.Info(fmt.Sprintf("non-grpc error [%v]]", err))
+				logger.Error("non-grpc error", withAttrs(logAttrs, slog.String(ErrorKey, err.Error()))...)
 				return currentSerializedCursor, err
 			}
 		}
 	}
 }
 
-func (p PlanetScaleEdgeDatabase) sync(ctx context.Context, tc *psdbconnect.TableCursor, stopPosition string, readDuration time.Duration, params ReadParams) (*psdbconnect.TableCursor, error) {
+func (p PlanetScaleEdgeDatabase) sync(ctx context.Context, tc *psdbconnect.TableCursor, stopPosition string, readDuration time.Duration, params ReadParams) (_ *psdbconnect.TableCursor, err error) {
 	defer p.Logger.Flush(params.Table)
-	ctx, cancel := context.WithTimeout(ctx, readDuration)
-	defer cancel()
+	// waiting for the throttle may outlast the read duration, so that a response is never read in part.
+	throttleCtx := ctx
+	if readDuration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, readDuration)
+		defer cancel()
+	}
 
-	var (
-		err    error
-		client psdbconnect.ConnectClient
+	rows := 0
+	ctx, span := startSpan(ctx, "PlanetScaleEdgeDatabase.sync",
+		streamAttribute.String(params.Table.Name),
+		shardAttribute.String(tc.Shard),
+		positionAttribute.String(tc.Position),
 	)
+	defer func() {
+		span.SetAttributes(attribute.Int("rows", rows))
+		if errors.Is(err, io.EOF) {
+			endSpan(span, nil)
+			return
+		}
+		endSpan(span, err)
+	}()
+
+	var client psdbconnect.ConnectClient
 
 	if p.clientFn == nil {
-		conn, err := grpcclient.Dial(ctx, params.Source.Host,
-			clientoptions.WithDefaultTLSConfig(),
+		opts, err := params.Source.grpcOptions()
+		if err != nil {
+			return tc, err
+		}
+		conn, err := grpcclient.Dial(ctx, params.Source.grpcHost(), append(opts,
 			clientoptions.WithCompression(true),
 			clientoptions.WithConnectionPool(1),
 			clientoptions.WithExtraCallOption(
 				auth.NewBasicAuth(params.Source.Username, params.Source.Password).CallOption(),
 			),
-		)
+		)...)
 		if err != nil {
 			return tc, err
 		}
@@ -178,7 +302,7 @@ func (p PlanetScaleEdgeDatabase) sync(ctx context.Context, tc *psdbconnect.Table
 	}
 
 	sReq := &psdbconnect.SyncRequest{
-		TableName:  params.Table.Name,
+		TableName:  params.Table.tableName(),
 		Cursor:     tc,
 		TabletType: params.TabletType,
 		Columns:    params.Columns,
@@ -200,6 +324,11 @@ func (p PlanetScaleEdgeDatabase) sync(ctx context.Context, tc *psdbconnect.Table
 			return tc, err
 		}
 
+		// when reading up to a fixed position, rows past it are left for the next sync session.
+		if len(params.StopPosition) > 0 && watchForVgGtidChange && res.Cursor != nil && !positionAtLeast(stopPosition, res.Cursor.Position) {
+			return tc, io.EOF
+		}
+
 		if res.Cursor != nil {
 			tc = res.Cursor
 		}
@@ -209,7 +338,9 @@ func (p PlanetScaleEdgeDatabase) sync(ctx context.Context, tc *psdbconnect.Table
 		// the vgtid event might repeat, but they're ordered.
 		// so we once we reach the desired stop vgtid, we stop the sync session
 		// if we get a newer vgtid.
-		watchForVgGtidChange = watchForVgGtidChange || tc.Position == stopPosition
+		// A copy of the table can finish past the stop vgtid, if rows were written while it was copied,
+		// in which case the session stops once the copy is done.
+		watchForVgGtidChange = !params.Continuous && (watchForVgGtidChange || (tc.LastKnownPk == nil && positionAtLeast(tc.Position, stopPosition)))
 
 		for _, result := range res.Result {
 			qr := sqltypes.Proto3ToResult(result)
@@ -218,6 +349,10 @@ func (p PlanetScaleEdgeDatabase) sync(ctx context.Context, tc *psdbconnect.Table
 					Fields: result.Fields,
 				}
 				sqlResult.Rows = append(sqlResult.Rows, row)
+				rows++
+				if err := p.Throttle.wait(throttleCtx, params.Table, sqlResult); err != nil {
+					return tc, err
+				}
 				if params.OnResult != nil {
 					if err := params.OnResult(sqlResult); err != nil {
 						return tc, err
@@ -227,10 +362,12 @@ func (p PlanetScaleEdgeDatabase) sync(ctx context.Context, tc *psdbconnect.Table
 		}
 
 		if params.OnCursor != nil && res.Cursor != nil {
-			params.OnCursor(res.Cursor)
+			if err := params.OnCursor(res.Cursor); err != nil {
+				return tc, err
+			}
 		}
 
-		if watchForVgGtidChange && tc.Position != stopPosition {
+		if watchForVgGtidChange && !positionAtLeast(stopPosition, tc.Position) {
 			return tc, io.EOF
 		}
 	}
@@ -251,6 +388,26 @@ func filterFields(lastKnownPK *querypb.QueryResult, s Stream) {
 	lastKnownPK.Fields = fields
 }
 
+// positionAtLeast reports whether a position is the same as another or past it.
+// Positions that are not GTID sets, or are empty, are only compared for equality.
+func positionAtLeast(position, other string) bool {
+	if position == other {
+		return true
+	}
+	if len(position) == 0 || len(other) == 0 {
+		return false
+	}
+	p, err := mysql.DecodePosition(position)
+	if err != nil {
+		return false
+	}
+	o, err := mysql.DecodePosition(other)
+	if err != nil {
+		return false
+	}
+	return p.AtLeast(o)
+}
+
 // contains checks if a string searchTerm is present in the list.
 func contains(list []string, searchTerm string) bool {
 	for _, val := range list {
@@ -262,25 +419,31 @@ func contains(list []string, searchTerm string) bool {
 	return false
 }
 
-func (p PlanetScaleEdgeDatabase) getLatestCursorPosition(ctx context.Context, shard, keyspace string, s Stream, ps PlanetScaleSource, tabletType psdbconnect.TabletType, cells []string) (string, error) {
+func (p PlanetScaleEdgeDatabase) getLatestCursorPosition(ctx context.Context, shard, keyspace string, s Stream, ps PlanetScaleSource, tabletType psdbconnect.TabletType, cells []string) (_ string, err error) {
 	defer p.Logger.Flush(s)
 	timeout := 45 * time.Second
 	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
-	var (
-		err    error
-		client psdbconnect.ConnectClient
+	ctx, span := startSpan(ctx, "PlanetScaleEdgeDatabase.getLatestCursorPosition",
+		streamAttribute.String(s.Name),
+		shardAttribute.String(shard),
 	)
+	defer func() { endSpan(span, err) }()
+
+	var client psdbconnect.ConnectClient
 
 	if p.clientFn == nil {
-		conn, err := grpcclient.Dial(ctx, ps.Host,
-			clientoptions.WithDefaultTLSConfig(),
+		opts, err := ps.grpcOptions()
+		if err != nil {
+			return "", err
+		}
+		conn, err := grpcclient.Dial(ctx, ps.grpcHost(), append(opts,
 			clientoptions.WithCompression(true),
 			clientoptions.WithConnectionPool(1),
 			clientoptions.WithExtraCallOption(
 				auth.NewBasicAuth(ps.Username, ps.Password).CallOption(),
 			),
-		)
+		)...)
 		if err != nil {
 			return "", err
 		}
@@ -294,7 +457,7 @@ func (p PlanetScaleEdgeDatabase) getLatestCursorPosition(ctx context.Context, sh
 	}
 
 	sReq := &psdbconnect.SyncRequest{
-		TableName: s.Name,
+		TableName: s.tableName(),
 		Cursor: &psdbconnect.TableCursor{
 			Shard:    shard,
 			Keyspace: keyspace,
@@ -306,7 +469,7 @@ func (p PlanetScaleEdgeDatabase) getLatestCursorPosition(ctx context.Context, sh
 
 	c, err := client.Sync(ctx, sReq)
 	if err != nil {
-		return "", nil
+		return "", err
 	}
 
 	for {
@@ -226,6 +226,27 @@ func TestDiscover_CanPickRightSingerType(t *testing.T) {
 	}
 }
 
+func TestTableColumn_DescribesProperty(t *testing.T) {
+	defaultValue := func(s string) *string { return &s }
+
+	p := TableColumn{Name: "emp_no", ColumnType: "int", Default: defaultValue("10001"), Comment: "employee number"}.property(false)
+	assert.Equal(t, StreamProperty{Types: []string{"integer"}, Description: "employee number", Default: int64(10001)}, p,
+		"not null columns should not allow null values")
+
+	p = TableColumn{Name: "first_name", ColumnType: "varchar(14)", Nullable: true, Default: defaultValue("Georgi"), MaxLength: 14}.property(false)
+	assert.Equal(t, StreamProperty{Types: []string{"null", "string"}, Default: "Georgi", MaxLength: 14}, p)
+
+	p = TableColumn{Name: "active", ColumnType: "tinyint(1)", Default: defaultValue("1")}.property(true)
+	assert.Equal(t, StreamProperty{Types: []string{"boolean"}, Default: true}, p)
+
+	p = TableColumn{Name: "salary", ColumnType: "double", Nullable: true, Default: defaultValue("1.5")}.property(false)
+	assert.Equal(t, StreamProperty{Types: []string{"null", "number"}, Default: 1.5}, p)
+
+	p = TableColumn{Name: "hired_at", ColumnType: "datetime", Nullable: true}.property(false)
+	assert.Equal(t, StreamProperty{Types: []string{"null", "string"}, CustomFormat: "date-time"}, p,
+		"columns without a literal default should have no default")
+}
+
 func TestRead_CanPickPrimaryForUnshardedKeyspaces(t *testing.T) {
 	tma := getTestMysqlAccess()
 	b := bytes.NewBufferString("")
@@ -469,10 +490,221 @@ func TestRead_CanStopAtWellKnownCursor(t *testing.T) {
 	assert.Equal(t, 2, cc.syncFnInvokedCount)
 
 	logLines := tal.logMessages
-	assert.Equal(t, "[table: customers, shard : -, tablet: primary, cells : [] ] Finished reading all rows for table [customers]", logLines[len(logLines)-1])
+	assert.Equal(t, "finished reading all rows", logLines[len(logLines)-1])
 	assert.Equal(t, 2*(nextVGtidPosition/3), recordCount)
 }
 
+func TestRead_CanStopAtSnapshotPosition(t *testing.T) {
+	tma := getTestMysqlAccess()
+	tal := testSingerLogger{}
+	ped := PlanetScaleEdgeDatabase{
+		Logger: &tal,
+		Mysql:  tma,
+	}
+
+	var responses []*psdbconnect.SyncResponse
+	for i := 1; i <= 3; i++ {
+		responses = append(responses, &psdbconnect.SyncResponse{
+			Cursor: &psdbconnect.TableCursor{
+				Shard:    "-",
+				Keyspace: "connect-test",
+				Position: fmt.Sprintf("e4e20f06-e28f-11ec-8d20-8e7ac09cb64c:1-%v", i),
+			},
+			Result: []*query.QueryResult{
+				sqltypes.ResultToProto3(sqltypes.MakeTestResult(sqltypes.MakeTestFields(
+					"pid|description",
+					"int64|varbinary"),
+					fmt.Sprintf("%v|keyboard", i),
+				)),
+			},
+		})
+	}
+
+	cc := clientConnectionMock{
+		syncFn: func(ctx context.Context, in *psdbconnect.SyncRequest, opts ...grpc.CallOption) (psdbconnect.Connect_SyncClient, error) {
+			assert.NotEqual(t, "current", in.Cursor.Position, "should not peek for the latest position")
+			return &connectSyncClientMock{syncResponses: responses}, nil
+		},
+	}
+	ped.clientFn = func(ctx context.Context, ps PlanetScaleSource) (psdbconnect.ConnectClient, error) {
+		return &cc, nil
+	}
+
+	var pids []string
+	sc, err := ped.Read(context.Background(), ReadParams{
+		Source:            PlanetScaleSource{Database: "connect-test"},
+		Table:             Stream{Name: "customers"},
+		LastKnownPosition: &psdbconnect.TableCursor{Shard: "-", Keyspace: "connect-test"},
+		StopPosition:      responses[1].Cursor.Position,
+		OnResult: func(qr *sqltypes.Result) error {
+			pids = append(pids, qr.Rows[0][0].ToString())
+			return nil
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1", "2"}, pids, "rows past the stop position should not be read")
+	esc, err := TableCursorToSerializedCursor(responses[1].Cursor)
+	assert.NoError(t, err)
+	assert.Equal(t, esc, sc)
+	assert.Equal(t, 1, cc.syncFnInvokedCount)
+}
+
+func TestRead_StopsWhenCursorPassesSnapshotPosition(t *testing.T) {
+	tma := getTestMysqlAccess()
+	tal := testSingerLogger{}
+	ped := PlanetScaleEdgeDatabase{
+		Logger: &tal,
+		Mysql:  tma,
+	}
+
+	var responses []*psdbconnect.SyncResponse
+	for _, i := range []int{1, 4, 5} {
+		responses = append(responses, &psdbconnect.SyncResponse{
+			Cursor: &psdbconnect.TableCursor{
+				Shard:    "-",
+				Keyspace: "connect-test",
+				Position: fmt.Sprintf("MySQL56/e4e20f06-e28f-11ec-8d20-8e7ac09cb64c:1-%v", i),
+			},
+			Result: []*query.QueryResult{
+				sqltypes.ResultToProto3(sqltypes.MakeTestResult(sqltypes.MakeTestFields(
+					"pid|description",
+					"int64|varbinary"),
+					fmt.Sprintf("%v|keyboard", i),
+				)),
+			},
+		})
+	}
+
+	cc := clientConnectionMock{
+		syncFn: func(ctx context.Context, in *psdbconnect.SyncRequest, opts ...grpc.CallOption) (psdbconnect.Connect_SyncClient, error) {
+			return &connectSyncClientMock{syncResponses: responses}, nil
+		},
+	}
+	ped.clientFn = func(ctx context.Context, ps PlanetScaleSource) (psdbconnect.ConnectClient, error) {
+		return &cc, nil
+	}
+
+	stopPosition := "MySQL56/e4e20f06-e28f-11ec-8d20-8e7ac09cb64c:1-2"
+	var pids []string
+	sc, err := ped.Read(context.Background(), ReadParams{
+		Source:            PlanetScaleSource{Database: "connect-test"},
+		Table:             Stream{Name: "customers"},
+		LastKnownPosition: &psdbconnect.TableCursor{Shard: "-", Keyspace: "connect-test"},
+		StopPosition:      stopPosition,
+		OnResult: func(qr *sqltypes.Result) error {
+			pids = append(pids, qr.Rows[0][0].ToString())
+			return nil
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1", "4"}, pids, "the read should stop at the first cursor past the stop position")
+	esc, err := TableCursorToSerializedCursor(responses[1].Cursor)
+	assert.NoError(t, err)
+	assert.Equal(t, esc, sc)
+	assert.Equal(t, 1, cc.syncFnInvokedCount)
+
+	// a cursor that is already past the stop position has no rows to read.
+	pids = nil
+	_, err = ped.Read(context.Background(), ReadParams{
+		Source:            PlanetScaleSource{Database: "connect-test"},
+		Table:             Stream{Name: "customers"},
+		LastKnownPosition: responses[2].Cursor,
+		StopPosition:      stopPosition,
+		OnResult: func(qr *sqltypes.Result) error {
+			pids = append(pids, qr.Rows[0][0].ToString())
+			return nil
+		},
+	})
+	assert.NoError(t, err)
+	assert.Empty(t, pids)
+	assert.Equal(t, 1, cc.syncFnInvokedCount)
+}
+
+func TestRead_ContinuousReadDoesNotStop(t *testing.T) {
+	tma := getTestMysqlAccess()
+	tal := testSingerLogger{}
+	ped := PlanetScaleEdgeDatabase{
+		Logger: &tal,
+		Mysql:  tma,
+	}
+
+	var responses []*psdbconnect.SyncResponse
+	for i := 1; i <= 3; i++ {
+		responses = append(responses, &psdbconnect.SyncResponse{
+			Cursor: &psdbconnect.TableCursor{
+				Shard:    "-",
+				Keyspace: "connect-test",
+				Position: fmt.Sprintf("e4e20f06-e28f-11ec-8d20-8e7ac09cb64c:1-%v", i),
+			},
+		})
+	}
+
+	cc := clientConnectionMock{
+		syncFn: func(ctx context.Context, in *psdbconnect.SyncRequest, opts ...grpc.CallOption) (psdbconnect.Connect_SyncClient, error) {
+			if in.Cursor.Position == "current" {
+				// the latest position is looked up, but not read up to.
+				return &connectSyncClientMock{syncResponses: responses[1:2]}, nil
+			}
+			_, hasDeadline := ctx.Deadline()
+			assert.False(t, hasDeadline, "the stream should be kept open")
+			return &connectSyncClientMock{syncResponses: responses}, nil
+		},
+	}
+	ped.clientFn = func(ctx context.Context, ps PlanetScaleSource) (psdbconnect.ConnectClient, error) {
+		return &cc, nil
+	}
+
+	var positions []string
+	sc, err := ped.Read(context.Background(), ReadParams{
+		Source:            PlanetScaleSource{Database: "connect-test"},
+		Table:             Stream{Name: "customers"},
+		LastKnownPosition: responses[0].Cursor,
+		Continuous:        true,
+		OnCursor: func(tc *psdbconnect.TableCursor) error {
+			positions = append(positions, tc.Position)
+			return nil
+		},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, positions, 3, "should read until the stream ends")
+	esc, err := TableCursorToSerializedCursor(responses[2].Cursor)
+	assert.NoError(t, err)
+	assert.Equal(t, esc, sc)
+}
+
+func TestRead_FailsWhenLatestPositionCannotBeRead(t *testing.T) {
+	for _, continuous := range []bool{false, true} {
+		tma := getTestMysqlAccess()
+		ped := PlanetScaleEdgeDatabase{
+			Logger: &testSingerLogger{},
+			Mysql:  tma,
+		}
+		cc := clientConnectionMock{
+			syncFn: func(ctx context.Context, in *psdbconnect.SyncRequest, opts ...grpc.CallOption) (psdbconnect.Connect_SyncClient, error) {
+				assert.Equal(t, "current", in.Cursor.Position, "should not read past a failed lookup")
+				return nil, status.Error(codes.Unavailable, "no healthy tablets")
+			},
+		}
+		ped.clientFn = func(ctx context.Context, ps PlanetScaleSource) (psdbconnect.ConnectClient, error) {
+			return &cc, nil
+		}
+
+		var outcomes []ReadOutcome
+		_, err := ped.Read(context.Background(), ReadParams{
+			Source:            PlanetScaleSource{Database: "connect-test"},
+			Table:             Stream{Name: "customers"},
+			LastKnownPosition: &psdbconnect.TableCursor{Shard: "-", Keyspace: "connect-test", Position: "e4e20f06-e28f-11ec-8d20-8e7ac09cb64c:1-1"},
+			Continuous:        continuous,
+			OnOutcome: func(outcome ReadOutcome) {
+				outcomes = append(outcomes, outcome)
+			},
+		})
+		assert.Error(t, err, "continuous: %v", continuous)
+		assert.ErrorContains(t, err, "no healthy tablets")
+		assert.Equal(t, []ReadOutcome{{Status: ReadStatusFailed, Reason: "unable to get latest cursor position: rpc error: code = Unavailable desc = no healthy tablets"}}, outcomes)
+	}
+}
+
 func TestRead_CanDetectPurgedBinlogs(t *testing.T) {
 	tma := getTestMysqlAccess()
 	tal := testSingerLogger{}
@@ -649,7 +881,7 @@ func testLogRecords(t *testing.T, tabletType psdbconnect.TabletType) {
 		LastKnownPosition: tc,
 		TabletType:        tabletType,
 		OnResult: func(qr *sqltypes.Result) error {
-			printQueryResult(qr, cs, tal)
+			printQueryResult(qr, cs, cs, nil, nil, tal)
 			return nil
 		},
 	})
@@ -707,3 +939,52 @@ func getTestMysqlAccess() *mysqlAccessMock {
 	}
 	return &tma
 }
+
+func TestTableRowsQuery_CanBuildSQL(t *testing.T) {
+	query, args := TableRowsQuery{
+		Table:      "dept_emp",
+		Columns:    []string{"emp_no", "dept_no", "from_date"},
+		KeyColumns: []string{"emp_no", "dept_no"},
+	}.SQL("employees")
+	assert.Equal(t, "select `emp_no`, `dept_no`, `from_date` from `employees`.`dept_emp` order by `emp_no`, `dept_no`", query)
+	assert.Empty(t, args)
+
+	query, args = TableRowsQuery{
+		Table:      "dept_emp",
+		Columns:    []string{"emp_no", "dept_no"},
+		KeyColumns: []string{"emp_no", "dept_no"},
+		After:      []sqltypes.Value{sqltypes.NewInt64(10001), sqltypes.NewVarChar("d005")},
+		Limit:      100,
+	}.SQL("employees")
+	assert.Equal(t, "select `emp_no`, `dept_no` from `employees`.`dept_emp` where (`emp_no`, `dept_no`) > (?, ?) order by `emp_no`, `dept_no` limit 100", query)
+	assert.Equal(t, []interface{}{int64(10001), "d005"}, args)
+
+	query, args = TableRowsQuery{
+		Table:      "dept_emp",
+		Columns:    []string{"emp_no"},
+		KeyColumns: []string{"emp_no"},
+		After:      []sqltypes.Value{sqltypes.NewInt64(10001)},
+		Where:      "dept_no = 'd005'",
+	}.SQL("employees")
+	assert.Equal(t, "select `emp_no` from `employees`.`dept_emp` where (`emp_no`) > (?) and (dept_no = 'd005') order by `emp_no`", query)
+	assert.Equal(t, []interface{}{int64(10001)}, args)
+
+	query, args = TableRowsQuery{
+		Table:      "dept_emp",
+		Columns:    []string{"emp_no", "dept_no"},
+		KeyColumns: []string{"emp_no", "dept_no"},
+		After:      []sqltypes.Value{sqltypes.NewInt64(10001), sqltypes.NewVarChar("d005")},
+		From:       []sqltypes.Value{sqltypes.NewInt64(10000)},
+		Before:     []sqltypes.Value{sqltypes.NewInt64(20000)},
+		Limit:      100,
+	}.SQL("employees")
+	assert.Equal(t, "select `emp_no`, `dept_no` from `employees`.`dept_emp` where (`emp_no`, `dept_no`) > (?, ?) and (`emp_no`) >= (?) and (`emp_no`) < (?) order by `emp_no`, `dept_no` limit 100", query)
+	assert.Equal(t, []interface{}{int64(10001), "d005", int64(10000), int64(20000)}, args)
+
+	query, args = TableRowsQuery{
+		Table:   "dept_emp",
+		Columns: []string{"emp_no", "dept_no"},
+	}.SQL("employees")
+	assert.Equal(t, "select `emp_no`, `dept_no` from `employees`.`dept_emp`", query)
+	assert.Empty(t, args)
+}
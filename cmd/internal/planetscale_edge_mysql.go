@@ -4,11 +4,14 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/pkg/errors"
 	psdbconnect "github.com/planetscale/airbyte-source/proto/psdbconnect/v1alpha1"
+	"vitess.io/vitess/go/sqltypes"
+	querypb "vitess.io/vitess/go/vt/proto/query"
 )
 
 type VitessTablet struct {
@@ -22,37 +25,211 @@ type VitessTablet struct {
 	PrimaryTermStartTime string
 }
 
+// ReplicationStatus is the replication status of a tablet, from SHOW VITESS_REPLICATION_STATUS.
+type ReplicationStatus struct {
+	Keyspace   string
+	Shard      string
+	TabletType string
+	Alias      string
+	Hostname   string
+	// Lag is how many seconds the tablet is behind its primary, -1 if unknown.
+	Lag int64
+}
+
+// Cell returns the cell of the tablet, which is the part of its alias before the uid.
+func (r ReplicationStatus) Cell() string {
+	if i := strings.LastIndex(r.Alias, "-"); i >= 0 {
+		return r.Alias[:i]
+	}
+	return r.Alias
+}
+
 type PlanetScaleEdgeMysqlAccess interface {
 	PingContext(context.Context, PlanetScaleSource) error
-	GetTableNames(context.Context, PlanetScaleSource) ([]string, error)
-	GetTableSchema(context.Context, PlanetScaleSource, string, bool) (map[string]StreamProperty, error)
-	GetTablePrimaryKeys(context.Context, PlanetScaleSource, string) ([]string, error)
+	// GetSchema returns the tables and views of a database with their columns and keys,
+	// only the included tables if there are any, and leaving out the excluded tables.
+	GetSchema(ctx context.Context, psc PlanetScaleSource, includedTables, excludedTables []string) ([]TableSchema, error)
 	GetVitessShards(ctx context.Context, psc PlanetScaleSource) ([]string, error)
 	GetVitessTablets(ctx context.Context, psc PlanetScaleSource) ([]VitessTablet, error)
+	GetReplicationStatus(ctx context.Context, psc PlanetScaleSource) ([]ReplicationStatus, error)
+	// GetShardPosition returns the GTID position that a shard's tablets of the given type have executed up to,
+	// the tablet type is ignored for MySQL databases without Vitess.
+	GetShardPosition(ctx context.Context, psc PlanetScaleSource, shard string, tabletType psdbconnect.TabletType) (string, error)
+	// GetBinlogSettings returns the settings of the binlog that changes are read from, for MySQL databases without Vitess.
+	GetBinlogSettings(ctx context.Context, psc PlanetScaleSource) (BinlogSettings, error)
+	// GetTableFields returns the fields of all columns of a table, in the order of the table's columns.
+	GetTableFields(ctx context.Context, psc PlanetScaleSource, table string) ([]*querypb.Field, error)
+	GetTableRows(ctx context.Context, psc PlanetScaleSource, query TableRowsQuery) (*sqltypes.Result, error)
+	// StreamTableRows selects the rows of a query with a single query, and passes them to onRows
+	// in batches of at most batchSize rows as they are read, instead of holding all of them at once.
+	StreamTableRows(ctx context.Context, psc PlanetScaleSource, query TableRowsQuery, batchSize int, onRows func(*sqltypes.Result) error) error
+	GetKeyBoundaries(ctx context.Context, psc PlanetScaleSource, table, column string, chunks int) ([]sqltypes.Value, error)
 	Close() error
 }
 
-func NewMySQL(psc *PlanetScaleSource) (PlanetScaleEdgeMysqlAccess, error) {
-	db, err := sql.Open("mysql", psc.DSN(psdbconnect.TabletType_primary))
+// BinlogSettings are the global variables of a MySQL server that decide what its binlog holds.
+type BinlogSettings struct {
+	Format   string
+	RowImage string
+	GTIDMode string
+}
+
+// DatabaseTable is a table or view in a database.
+type DatabaseTable struct {
+	Name   string
+	IsView bool
+	// RowCount is the number of rows in the table as estimated by information_schema.
+	RowCount int64
+}
+
+// TableSchema is a table or view in a database with its columns and keys.
+type TableSchema struct {
+	DatabaseTable
+	// Columns are the columns of the table, in the order of the table's columns.
+	Columns     []TableColumn
+	PrimaryKeys []string
+	// UniqueKeys are the columns of the first unique index of the table whose columns are all not null,
+	// if it has one besides its primary key.
+	UniqueKeys []string
+}
+
+// TableColumn is a column of a table or view, as described by information_schema.columns.
+type TableColumn struct {
+	Name string
+	// Position is the position of the column in its table, starting at 1.
+	Position int
+	// ColumnType is the full type of the column, for example "varchar(255)" or "int unsigned".
+	ColumnType string
+	Nullable   bool
+	// Default is the literal default value of the column, it is nil for columns without a default
+	// and for columns whose default is an expression, like CURRENT_TIMESTAMP.
+	Default *string
+	Comment string
+	// Generated is either VIRTUAL or STORED for generated columns, and empty for other columns.
+	Generated string
+	// MaxLength is the maximum length in characters of string columns.
+	MaxLength int64
+}
+
+// TableRowsQuery describes a page of rows to select from a table, ordered by its key columns.
+type TableRowsQuery struct {
+	Table      string
+	Columns    []string
+	KeyColumns []string
+	// After, if set, only selects rows whose key columns sort after these values.
+	After []sqltypes.Value
+	// From, if set, only selects rows whose key columns sort at or after these values.
+	From []sqltypes.Value
+	// Before, if set, only selects rows whose key columns sort before these values.
+	Before []sqltypes.Value
+	// Where, if set, is an additional condition that selected rows must satisfy.
+	Where string
+	// Limit, if positive, is the maximum number of rows to select.
+	Limit int
+}
+
+// SQL returns the query and its arguments to select the rows described by this TableRowsQuery.
+func (q TableRowsQuery) SQL(database string) (string, []interface{}) {
+	var (
+		sb   strings.Builder
+		args []interface{}
+	)
+
+	columns := make([]string, 0, len(q.Columns))
+	for _, column := range q.Columns {
+		columns = append(columns, quoteIdentifier(column))
+	}
+	keyColumns := make([]string, 0, len(q.KeyColumns))
+	for _, column := range q.KeyColumns {
+		keyColumns = append(keyColumns, quoteIdentifier(column))
+	}
+
+	fmt.Fprintf(&sb, "select %s from %s.%s", strings.Join(columns, ", "), quoteIdentifier(database), quoteIdentifier(q.Table))
+
+	var conditions []string
+	for _, bound := range []struct {
+		operator string
+		values   []sqltypes.Value
+	}{{">", q.After}, {">=", q.From}, {"<", q.Before}} {
+		if len(bound.values) == 0 {
+			continue
+		}
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(bound.values)), ", ")
+		conditions = append(conditions, fmt.Sprintf("(%s) %s (%s)", strings.Join(keyColumns[:len(bound.values)], ", "), bound.operator, placeholders))
+		for _, v := range bound.values {
+			args = append(args, sqlArgument(v))
+		}
+	}
+	if len(q.Where) > 0 {
+		conditions = append(conditions, "("+q.Where+")")
+	}
+	if len(conditions) > 0 {
+		fmt.Fprintf(&sb, " where %s", strings.Join(conditions, " and "))
+	}
+	if len(keyColumns) > 0 {
+		fmt.Fprintf(&sb, " order by %s", strings.Join(keyColumns, ", "))
+	}
+	if q.Limit > 0 {
+		fmt.Fprintf(&sb, " limit %d", q.Limit)
+	}
+
+	return sb.String(), args
+}
+
+func quoteIdentifier(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+// sqlArgument converts a value to an argument for database/sql,
+// preserving the precision of integers.
+func sqlArgument(v sqltypes.Value) interface{} {
+	switch {
+	case v.IsNull():
+		return nil
+	case v.IsSigned():
+		if i, err := v.ToInt64(); err == nil {
+			return i
+		}
+	case v.IsUnsigned():
+		if u, err := v.ToUint64(); err == nil {
+			return u
+		}
+	}
+	return v.ToString()
+}
+
+// NewMySQL connects to the given type of tablet of a PlanetScale database.
+func NewMySQL(psc *PlanetScaleSource, tabletType psdbconnect.TabletType) (PlanetScaleEdgeMysqlAccess, error) {
+	dsn, err := psc.DSN(tabletType)
+	if err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("mysql", dsn)
 	if err != nil {
 		return nil, err
 	}
 
 	return planetScaleEdgeMySQLAccess{
-		db: db,
+		db:         db,
+		tabletType: tabletType,
 	}, nil
 }
 
 type planetScaleEdgeMySQLAccess struct {
-	db *sql.DB
+	db         *sql.DB
+	tabletType psdbconnect.TabletType
 }
 
 func (p planetScaleEdgeMySQLAccess) Close() error {
 	return p.db.Close()
 }
 
-func (p planetScaleEdgeMySQLAccess) GetVitessShards(ctx context.Context, psc PlanetScaleSource) ([]string, error) {
-	var shards []string
+func (p planetScaleEdgeMySQLAccess) GetVitessShards(ctx context.Context, psc PlanetScaleSource) (shards []string, err error) {
+	if psc.isMySQL() {
+		return []string{mysqlShard}, nil
+	}
+	ctx, span := startSpan(ctx, "mysql.GetVitessShards")
+	defer func() { endSpan(span, err) }()
 
 	// TODO: is there a prepared statement equivalent?
 	shardNamesQR, err := p.db.QueryContext(
@@ -78,8 +255,60 @@ func (p planetScaleEdgeMySQLAccess) GetVitessShards(ctx context.Context, psc Pla
 	return shards, nil
 }
 
-func (p planetScaleEdgeMySQLAccess) GetVitessTablets(ctx context.Context, psc PlanetScaleSource) ([]VitessTablet, error) {
-	var tablets []VitessTablet
+func (p planetScaleEdgeMySQLAccess) GetShardPosition(ctx context.Context, psc PlanetScaleSource, shard string, tabletType psdbconnect.TabletType) (position string, err error) {
+	ctx, span := startSpan(ctx, "mysql.GetShardPosition", shardAttribute.String(shard), tabletTypeAttribute.String(tabletType.String()))
+	defer func() { endSpan(span, err) }()
+
+	var gtids string
+	if psc.isMySQL() {
+		if err := p.db.QueryRowContext(ctx, "select @@global.gtid_executed").Scan(&gtids); err != nil {
+			return "", errors.Wrap(err, "unable to get the position of the database")
+		}
+		return "MySQL56/" + strings.ReplaceAll(gtids, "\n", ""), nil
+	}
+
+	// a connection is targeted at the shard for the query, and targeted back at the database before it is reused.
+	conn, err := p.db.Conn(ctx)
+	if err != nil {
+		return "", errors.Wrap(err, "unable to get a connection")
+	}
+	defer conn.Close()
+
+	target := fmt.Sprintf("%v:%v@%v", psc.Database, shard, TabletTypeToString(tabletType))
+	if _, err := conn.ExecContext(ctx, "use "+quoteIdentifier(target)); err != nil {
+		return "", errors.Wrapf(err, "unable to target shard %v", shard)
+	}
+	defer func() {
+		if _, uErr := conn.ExecContext(context.Background(), "use "+quoteIdentifier(fmt.Sprintf("%v@%v", psc.Database, TabletTypeToString(p.tabletType)))); uErr != nil && err == nil {
+			err = errors.Wrap(uErr, "unable to target database")
+		}
+	}()
+
+	if err := conn.QueryRowContext(ctx, "select @@global.gtid_executed").Scan(&gtids); err != nil {
+		return "", errors.Wrapf(err, "unable to get the position of shard %v", shard)
+	}
+	// positions are in the form that VStream takes, with the flavor of the GTIDs as a prefix.
+	return "MySQL56/" + strings.ReplaceAll(gtids, "\n", ""), nil
+}
+
+func (p planetScaleEdgeMySQLAccess) GetBinlogSettings(ctx context.Context, psc PlanetScaleSource) (settings BinlogSettings, err error) {
+	ctx, span := startSpan(ctx, "mysql.GetBinlogSettings")
+	defer func() { endSpan(span, err) }()
+
+	err = p.db.QueryRowContext(ctx, "select @@global.binlog_format, @@global.binlog_row_image, @@global.gtid_mode").
+		Scan(&settings.Format, &settings.RowImage, &settings.GTIDMode)
+	if err != nil {
+		return settings, errors.Wrap(err, "unable to get the binlog settings of the database")
+	}
+	return settings, nil
+}
+
+func (p planetScaleEdgeMySQLAccess) GetVitessTablets(ctx context.Context, psc PlanetScaleSource) (tablets []VitessTablet, err error) {
+	if psc.isMySQL() {
+		return []VitessTablet{{TabletType: "PRIMARY", State: "SERVING"}}, nil
+	}
+	ctx, span := startSpan(ctx, "mysql.GetVitessTablets")
+	defer func() { endSpan(span, err) }()
 
 	tabletsQR, err := p.db.QueryContext(ctx, "Show vitess_tablets")
 	if err != nil {
@@ -105,96 +334,525 @@ func (p planetScaleEdgeMySQLAccess) GetVitessTablets(ctx context.Context, psc Pl
 	return tablets, nil
 }
 
-func (p planetScaleEdgeMySQLAccess) PingContext(ctx context.Context, psc PlanetScaleSource) error {
+func (p planetScaleEdgeMySQLAccess) GetReplicationStatus(ctx context.Context, psc PlanetScaleSource) (statuses []ReplicationStatus, err error) {
+	if psc.isMySQL() {
+		return nil, nil
+	}
+	ctx, span := startSpan(ctx, "mysql.GetReplicationStatus")
+	defer func() { endSpan(span, err) }()
+
+	statusQR, err := p.db.QueryContext(ctx, "show vitess_replication_status")
+	if err != nil {
+		return statuses, errors.Wrap(err, "unable to query replication status")
+	}
+	defer statusQR.Close()
+
+	for statusQR.Next() {
+		// output is of the form :
+		// connect-test - REPLICA aws_useast1c_5-1559247072 10.200.178.136 10.200.131.217:3306 {"EventStreamRunning":"Yes","EventApplierRunning":"Yes","LastError":""} 0 {"state":"OK","load":0.00,"message":""}
+		var (
+			rs                                   ReplicationStatus
+			source, health, lag, throttlerStatus string
+		)
+		if err := statusQR.Scan(&rs.Keyspace, &rs.Shard, &rs.TabletType, &rs.Alias, &rs.Hostname, &source, &health, &lag, &throttlerStatus); err != nil {
+			return statuses, errors.Wrap(err, "unable to scan replication status")
+		}
+		if rs.Keyspace != psc.Database {
+			continue
+		}
+		if rs.Lag, err = strconv.ParseInt(lag, 10, 64); err != nil {
+			rs.Lag = -1
+		}
+		statuses = append(statuses, rs)
+	}
+	if err := statusQR.Err(); err != nil {
+		return statuses, errors.Wrapf(err, "unable to iterate replication status for %s", psc.Database)
+	}
+	return statuses, nil
+}
+
+func (p planetScaleEdgeMySQLAccess) PingContext(ctx context.Context, psc PlanetScaleSource) (err error) {
+	ctx, span := startSpan(ctx, "mysql.PingContext")
+	defer func() { endSpan(span, err) }()
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 	return p.db.PingContext(ctx)
 }
 
-func (p planetScaleEdgeMySQLAccess) GetTableNames(ctx context.Context, psc PlanetScaleSource) ([]string, error) {
-	var tables []string
+// GetSchema reads the tables of a database with their columns and keys in three queries, whatever the number of tables,
+// so that databases with thousands of tables are discovered in about the time it takes to discover one.
+func (p planetScaleEdgeMySQLAccess) GetSchema(ctx context.Context, psc PlanetScaleSource, includedTables, excludedTables []string) (schema []TableSchema, err error) {
+	ctx, span := startSpan(ctx, "mysql.GetSchema")
+	defer func() { endSpan(span, err) }()
 
-	tableNamesQR, err := p.db.Query(fmt.Sprintf("show tables from `%s`;", psc.Database))
+	filter, args := tablesFilter("table_name", psc.Database, includedTables, excludedTables)
+	tablesQR, err := p.db.QueryContext(
+		ctx,
+		"select table_name, table_type, table_rows from information_schema.tables where table_schema=?"+filter+" order by table_name;",
+		args...,
+	)
 	if err != nil {
-		return tables, errors.Wrap(err, "Unable to query database for schema")
+		return schema, errors.Wrap(err, "Unable to query database for schema")
 	}
+	defer tablesQR.Close()
 
-	for tableNamesQR.Next() {
-		var name string
-		if err = tableNamesQR.Scan(&name); err != nil {
-			return tables, errors.Wrap(err, "unable to get table names")
+	tables := map[string]*TableSchema{}
+	var names []string
+	for tablesQR.Next() {
+		var (
+			name, tableType string
+			rowCount        sql.NullInt64
+		)
+		if err = tablesQR.Scan(&name, &tableType, &rowCount); err != nil {
+			return schema, errors.Wrap(err, "unable to get table names")
 		}
-
-		tables = append(tables, name)
+		tables[name] = &TableSchema{DatabaseTable: DatabaseTable{
+			Name:     name,
+			IsView:   strings.Contains(strings.ToUpper(tableType), "VIEW"),
+			RowCount: rowCount.Int64,
+		}}
+		names = append(names, name)
+	}
+	if err := tablesQR.Err(); err != nil {
+		return schema, errors.Wrap(err, "unable to iterate table rows")
 	}
 
-	if err := tableNamesQR.Err(); err != nil {
-		return tables, errors.Wrap(err, "unable to iterate table rows")
+	if err := p.getSchemaColumns(ctx, psc, includedTables, excludedTables, tables); err != nil {
+		return schema, err
+	}
+	if err := p.getSchemaUniqueKeys(ctx, psc, includedTables, excludedTables, tables); err != nil {
+		return schema, err
 	}
 
-	return tables, nil
+	for _, name := range names {
+		schema = append(schema, *tables[name])
+	}
+	return schema, nil
 }
 
-func (p planetScaleEdgeMySQLAccess) GetTableSchema(ctx context.Context, psc PlanetScaleSource, tableName string, treatTinyIntAsBoolean bool) (map[string]StreamProperty, error) {
-	properties := map[string]StreamProperty{}
+// tablesFilter returns conditions on a table name column that keep only the included tables, if there are any,
+// and leave out the excluded tables, to follow a condition on the database, and the arguments of all conditions.
+func tablesFilter(column, database string, includedTables, excludedTables []string) (string, []interface{}) {
+	args := []interface{}{database}
+	var filter string
+	for _, condition := range []struct {
+		operator string
+		tables   []string
+	}{{"in", includedTables}, {"not in", excludedTables}} {
+		if len(condition.tables) == 0 {
+			continue
+		}
+		for _, table := range condition.tables {
+			args = append(args, table)
+		}
+		filter += " AND " + column + " " + condition.operator + " (" + strings.TrimSuffix(strings.Repeat("?, ", len(condition.tables)), ", ") + ")"
+	}
+	return filter, args
+}
 
-	columnNamesQR, err := p.db.QueryContext(
+// getSchemaColumns reads the columns and primary keys of all tables, in the order of each table's columns.
+func (p planetScaleEdgeMySQLAccess) getSchemaColumns(ctx context.Context, psc PlanetScaleSource, includedTables, excludedTables []string, tables map[string]*TableSchema) error {
+	filter, args := tablesFilter("table_name", psc.Database, includedTables, excludedTables)
+	columnsQR, err := p.db.QueryContext(
 		ctx,
-		"select column_name, column_type from information_schema.columns where table_name=? AND table_schema=?;",
-		tableName, psc.Database,
+		"select table_name, column_name, ordinal_position, column_type, is_nullable, column_default, column_comment, extra, character_maximum_length, column_key "+
+			"from information_schema.columns where table_schema=?"+filter+" order by table_name, ordinal_position;",
+		args...,
 	)
 	if err != nil {
-		return properties, errors.Wrapf(err, "Unable to get column names & types for table %v", tableName)
+		return errors.Wrap(err, "Unable to get columns of tables")
 	}
+	defer columnsQR.Close()
 
-	for columnNamesQR.Next() {
+	for columnsQR.Next() {
 		var (
-			name       string
-			columnType string
+			tableName    string
+			column       TableColumn
+			isNullable   string
+			defaultValue sql.NullString
+			extra        string
+			maxLength    sql.NullInt64
+			columnKey    string
 		)
-		if err = columnNamesQR.Scan(&name, &columnType); err != nil {
-			return properties, errors.Wrapf(err, "Unable to scan row for column names & types of table %v", tableName)
+		if err := columnsQR.Scan(&tableName, &column.Name, &column.Position, &column.ColumnType, &isNullable, &defaultValue, &column.Comment, &extra, &maxLength, &columnKey); err != nil {
+			return errors.Wrap(err, "Unable to scan row for columns of tables")
+		}
+
+		column.Nullable = isNullable == "YES"
+		extra = strings.ToUpper(extra)
+		// expression defaults are marked as DEFAULT_GENERATED, they have no value to describe.
+		if defaultValue.Valid && !strings.Contains(extra, "DEFAULT_GENERATED") {
+			column.Default = &defaultValue.String
+		}
+		switch {
+		case strings.Contains(extra, "VIRTUAL GENERATED"):
+			column.Generated = "VIRTUAL"
+		case strings.Contains(extra, "STORED GENERATED"):
+			column.Generated = "STORED"
+		}
+		column.MaxLength = maxLength.Int64
+
+		table, ok := tables[tableName]
+		if !ok {
+			continue
+		}
+		table.Columns = append(table.Columns, column)
+		if columnKey == "PRI" {
+			table.PrimaryKeys = append(table.PrimaryKeys, column.Name)
 		}
+	}
 
-		properties[name] = getJsonSchemaType(columnType, treatTinyIntAsBoolean)
+	if err := columnsQR.Err(); err != nil {
+		return errors.Wrap(err, "unable to iterate columns of tables")
 	}
+	return nil
+}
 
-	if err := columnNamesQR.Err(); err != nil {
-		return properties, errors.Wrapf(err, "unable to iterate columns for table %s", tableName)
+// getSchemaUniqueKeys reads the columns of the first unique index of every table whose columns are all not null.
+func (p planetScaleEdgeMySQLAccess) getSchemaUniqueKeys(ctx context.Context, psc PlanetScaleSource, includedTables, excludedTables []string, tables map[string]*TableSchema) error {
+	filter, args := tablesFilter("s.table_name", psc.Database, includedTables, excludedTables)
+	uniqueKeysQR, err := p.db.QueryContext(
+		ctx,
+		"select s.table_name, s.index_name, s.column_name, c.is_nullable from information_schema.statistics s "+
+			"join information_schema.columns c on c.table_schema=s.table_schema AND c.table_name=s.table_name AND c.column_name=s.column_name "+
+			"where s.table_schema=? AND s.non_unique=0 AND s.index_name != 'PRIMARY'"+filter+
+			" order by s.table_name, s.index_name, s.seq_in_index;",
+		args...,
+	)
+	if err != nil {
+		return errors.Wrap(err, "Unable to get unique keys of tables")
 	}
+	defer uniqueKeysQR.Close()
 
-	return properties, nil
+	type index struct {
+		table, name string
+	}
+	var (
+		indexes  []index
+		columns  = map[index][]string{}
+		nullable = map[index]bool{}
+	)
+	for uniqueKeysQR.Next() {
+		var (
+			i                  index
+			column, isNullable string
+		)
+		if err := uniqueKeysQR.Scan(&i.table, &i.name, &column, &isNullable); err != nil {
+			return errors.Wrap(err, "Unable to scan row for unique keys of tables")
+		}
+		if _, ok := columns[i]; !ok {
+			indexes = append(indexes, i)
+		}
+		columns[i] = append(columns[i], column)
+		// a unique index allows any number of rows with nulls in it, so it does not identify them.
+		if strings.EqualFold(isNullable, "YES") {
+			nullable[i] = true
+		}
+	}
+
+	if err := uniqueKeysQR.Err(); err != nil {
+		return errors.Wrap(err, "unable to iterate unique keys of tables")
+	}
+
+	for _, i := range indexes {
+		table, ok := tables[i.table]
+		if !ok || nullable[i] || len(table.UniqueKeys) > 0 {
+			continue
+		}
+		table.UniqueKeys = columns[i]
+	}
+	return nil
 }
 
-func (p planetScaleEdgeMySQLAccess) GetTablePrimaryKeys(ctx context.Context, psc PlanetScaleSource, tableName string) ([]string, error) {
-	var primaryKeys []string
+// GetTableRowCount returns the number of rows in a table as estimated by information_schema,
+// which is cheap to read but can be far from the actual number of rows.
+func (p planetScaleEdgeMySQLAccess) GetTableRowCount(ctx context.Context, psc PlanetScaleSource, tableName string) (rowCount int64, err error) {
+	ctx, span := startSpan(ctx, "mysql.GetTableRowCount", streamAttribute.String(tableName))
+	defer func() { endSpan(span, err) }()
 
-	primaryKeysQR, err := p.db.QueryContext(
+	var count sql.NullInt64
+	err = p.db.QueryRowContext(
 		ctx,
-		"select column_name from information_schema.columns where table_schema=? AND table_name=? AND column_key='PRI';",
+		"select table_rows from information_schema.tables where table_schema=? AND table_name=?;",
 		psc.Database, tableName,
-	)
+	).Scan(&count)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, errors.Wrapf(err, "Unable to get row count of table %v", tableName)
+	}
+
+	return count.Int64, nil
+}
+
+func (p planetScaleEdgeMySQLAccess) GetTableRows(ctx context.Context, psc PlanetScaleSource, q TableRowsQuery) (result *sqltypes.Result, err error) {
+	ctx, span := startSpan(ctx, "mysql.GetTableRows", streamAttribute.String(q.Table))
+	defer func() { endSpan(span, err) }()
+
+	query, args := q.SQL(psc.Database)
+	return p.queryResult(ctx, q.Table, query, args...)
+}
+
+func (p planetScaleEdgeMySQLAccess) StreamTableRows(ctx context.Context, psc PlanetScaleSource, q TableRowsQuery, batchSize int, onRows func(*sqltypes.Result) error) (err error) {
+	ctx, span := startSpan(ctx, "mysql.StreamTableRows", streamAttribute.String(q.Table))
+	defer func() { endSpan(span, err) }()
+
+	query, args := q.SQL(psc.Database)
+	return p.queryRows(ctx, q.Table, query, args, batchSize, onRows)
+}
+
+func (p planetScaleEdgeMySQLAccess) GetTableFields(ctx context.Context, psc PlanetScaleSource, table string) (fields []*querypb.Field, err error) {
+	ctx, span := startSpan(ctx, "mysql.GetTableFields", streamAttribute.String(table))
+	defer func() { endSpan(span, err) }()
+
+	result, err := p.queryResult(ctx, table, fmt.Sprintf("select * from %s.%s where 1 != 1", quoteIdentifier(psc.Database), quoteIdentifier(table)))
 	if err != nil {
-		return primaryKeys, errors.Wrapf(err, "Unable to scan row for primary keys of table %v", tableName)
+		return nil, err
 	}
+	return result.Fields, nil
+}
 
-	for primaryKeysQR.Next() {
-		var name string
-		if err = primaryKeysQR.Scan(&name); err != nil {
-			return primaryKeys, errors.Wrapf(err, "Unable to scan row for primary keys of table %v", tableName)
+// GetKeyBoundaries splits the values of a key column into at most the given number of ranges,
+// and returns the values that the second and later ranges start at, in ascending order.
+// Integer columns are split evenly between their minimum and maximum values,
+// other columns are split into ranges with about the same number of rows by seeking through the column's values in order.
+func (p planetScaleEdgeMySQLAccess) GetKeyBoundaries(ctx context.Context, psc PlanetScaleSource, table, column string, chunks int) (boundaries []sqltypes.Value, err error) {
+	ctx, span := startSpan(ctx, "mysql.GetKeyBoundaries", streamAttribute.String(table))
+	defer func() { endSpan(span, err) }()
+
+	if chunks < 2 {
+		return nil, nil
+	}
+
+	tableName := quoteIdentifier(psc.Database) + "." + quoteIdentifier(table)
+	qr, err := p.queryResult(ctx, table, fmt.Sprintf("select min(%[1]s), max(%[1]s) from %[2]s", quoteIdentifier(column), tableName))
+	if err != nil {
+		return nil, err
+	}
+	if len(qr.Rows) == 0 || qr.Rows[0][0].IsNull() {
+		// the table is empty.
+		return nil, nil
+	}
+
+	lowest, lErr := qr.Rows[0][0].ToInt64()
+	highest, hErr := qr.Rows[0][1].ToInt64()
+	if qr.Rows[0][0].IsIntegral() && lErr == nil && hErr == nil {
+		step := (highest - lowest) / int64(chunks)
+		for i := int64(1); step > 0 && i < int64(chunks); i++ {
+			boundaries = append(boundaries, sqltypes.NewInt64(lowest+i*step))
 		}
+		return boundaries, nil
+	}
 
-		primaryKeys = append(primaryKeys, name)
+	rowCount, err := p.GetTableRowCount(ctx, psc, table)
+	if err != nil {
+		return nil, err
+	}
+	step := rowCount / int64(chunks)
+	for i := int64(1); step > 0 && i < int64(chunks); i++ {
+		// every boundary is found by seeking past the previous one in the column's index,
+		// so that the rows of the table are only read once.
+		var qr *sqltypes.Result
+		if len(boundaries) == 0 {
+			qr, err = p.queryResult(ctx, table, fmt.Sprintf("select %[1]s from %[2]s order by %[1]s limit 1 offset %[3]d", quoteIdentifier(column), tableName, step))
+		} else {
+			qr, err = p.queryResult(ctx, table, fmt.Sprintf("select %[1]s from %[2]s where %[1]s > ? order by %[1]s limit 1 offset %[3]d", quoteIdentifier(column), tableName, step-1), boundaries[len(boundaries)-1].ToString())
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(qr.Rows) == 0 {
+			break
+		}
+		boundaries = append(boundaries, qr.Rows[0][0])
 	}
+	return boundaries, nil
+}
 
-	if err := primaryKeysQR.Err(); err != nil {
-		return primaryKeys, errors.Wrapf(err, "unable to iterate primary keys for table %s", tableName)
+// queryResult runs a query and returns its rows as vitess values.
+func (p planetScaleEdgeMySQLAccess) queryResult(ctx context.Context, table, query string, args ...interface{}) (*sqltypes.Result, error) {
+	result := &sqltypes.Result{}
+	err := p.queryRows(ctx, table, query, args, 0, func(batch *sqltypes.Result) error {
+		result.Fields = batch.Fields
+		result.Rows = append(result.Rows, batch.Rows...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
+	result.RowsAffected = uint64(len(result.Rows))
+	return result, nil
+}
+
+// queryRows runs a query and passes its rows as vitess values to onRows in batches of at most batchSize rows,
+// as they are read, or in a single batch if batchSize is not positive.
+func (p planetScaleEdgeMySQLAccess) queryRows(ctx context.Context, table, query string, args []interface{}, batchSize int, onRows func(*sqltypes.Result) error) error {
+	rowsQR, err := p.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to select rows from table %v", table)
+	}
+	defer rowsQR.Close()
+
+	columnTypes, err := rowsQR.ColumnTypes()
+	if err != nil {
+		return errors.Wrapf(err, "Unable to get column types for table %v", table)
+	}
+
+	var fields []*querypb.Field
+	for _, ct := range columnTypes {
+		fields = append(fields, &querypb.Field{
+			Name: ct.Name(),
+			Type: databaseTypeToSQLType(ct.DatabaseTypeName()),
+		})
+	}
+
+	batch := &sqltypes.Result{Fields: fields}
+	passed := false
+	for rowsQR.Next() {
+		raw := make([]sql.RawBytes, len(columnTypes))
+		dest := make([]interface{}, len(columnTypes))
+		for i := range raw {
+			dest[i] = &raw[i]
+		}
+		if err = rowsQR.Scan(dest...); err != nil {
+			return errors.Wrapf(err, "Unable to scan row from table %v", table)
+		}
 
-	return primaryKeys, nil
+		row := make([]sqltypes.Value, len(raw))
+		for i, b := range raw {
+			if b == nil {
+				row[i] = sqltypes.NULL
+				continue
+			}
+			// RawBytes are only valid until the next call to Next, so take a copy.
+			row[i] = sqltypes.MakeTrusted(fields[i].Type, append([]byte(nil), b...))
+		}
+		batch.Rows = append(batch.Rows, row)
+		if batchSize > 0 && len(batch.Rows) == batchSize {
+			batch.RowsAffected = uint64(len(batch.Rows))
+			if err := onRows(batch); err != nil {
+				return err
+			}
+			passed = true
+			batch = &sqltypes.Result{Fields: fields}
+		}
+	}
+
+	if err := rowsQR.Err(); err != nil {
+		return errors.Wrapf(err, "unable to iterate rows for table %s", table)
+	}
+	// a query without rows still passes on an empty batch, with the fields of the query.
+	if len(batch.Rows) == 0 && passed {
+		return nil
+	}
+	batch.RowsAffected = uint64(len(batch.Rows))
+	return onRows(batch)
+}
+
+// databaseTypeToSQLType maps the type names reported by the mysql driver to vitess types,
+// so that rows selected over mysql can be converted in the same way as rows streamed from vstream.
+func databaseTypeToSQLType(name string) querypb.Type {
+	switch strings.ToUpper(name) {
+	case "TINYINT":
+		return querypb.Type_INT8
+	case "UNSIGNED TINYINT":
+		return querypb.Type_UINT8
+	case "SMALLINT":
+		return querypb.Type_INT16
+	case "UNSIGNED SMALLINT":
+		return querypb.Type_UINT16
+	case "MEDIUMINT":
+		return querypb.Type_INT24
+	case "UNSIGNED MEDIUMINT":
+		return querypb.Type_UINT24
+	case "INT":
+		return querypb.Type_INT32
+	case "UNSIGNED INT":
+		return querypb.Type_UINT32
+	case "BIGINT":
+		return querypb.Type_INT64
+	case "UNSIGNED BIGINT":
+		return querypb.Type_UINT64
+	case "FLOAT":
+		return querypb.Type_FLOAT32
+	case "DOUBLE":
+		return querypb.Type_FLOAT64
+	case "DECIMAL":
+		return querypb.Type_DECIMAL
+	case "DATE":
+		return querypb.Type_DATE
+	case "DATETIME":
+		return querypb.Type_DATETIME
+	case "TIMESTAMP":
+		return querypb.Type_TIMESTAMP
+	case "TIME":
+		return querypb.Type_TIME
+	case "YEAR":
+		return querypb.Type_YEAR
+	case "CHAR":
+		return querypb.Type_CHAR
+	case "TEXT", "TINYTEXT", "MEDIUMTEXT", "LONGTEXT":
+		return querypb.Type_TEXT
+	case "BINARY":
+		return querypb.Type_BINARY
+	case "VARBINARY":
+		return querypb.Type_VARBINARY
+	case "BLOB", "TINYBLOB", "MEDIUMBLOB", "LONGBLOB":
+		return querypb.Type_BLOB
+	case "BIT":
+		return querypb.Type_BIT
+	case "ENUM":
+		return querypb.Type_ENUM
+	case "SET":
+		return querypb.Type_SET
+	case "JSON":
+		return querypb.Type_JSON
+	case "GEOMETRY":
+		return querypb.Type_GEOMETRY
+	default:
+		return querypb.Type_VARCHAR
+	}
 }
 
 // Convert columnType to Singer type.
+// property returns the JSON schema of the values of a column. Columns that are not null do not allow null values,
+// and literal defaults are converted to the type of the column's values.
+func (c TableColumn) property(treatTinyIntAsBoolean bool) StreamProperty {
+	property := getJsonSchemaType(c.ColumnType, treatTinyIntAsBoolean)
+	if !c.Nullable {
+		property.Types = property.Types[1:]
+	}
+	property.Description = c.Comment
+	if property.hasType("string") {
+		property.MaxLength = c.MaxLength
+	}
+	if c.Default != nil {
+		property.Default = propertyDefault(property, *c.Default)
+	}
+	return property
+}
+
+// propertyDefault converts the default value of a column to the type of the values of its property,
+// defaults that cannot be converted are left out.
+func propertyDefault(property StreamProperty, value string) interface{} {
+	switch {
+	case property.IsBoolean():
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	case property.IsInteger(), property.IsNumber():
+		if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return n
+		}
+		if property.IsNumber() {
+			if f, err := strconv.ParseFloat(value, 64); err == nil {
+				return f
+			}
+		}
+	default:
+		return value
+	}
+	return nil
+}
+
 func getJsonSchemaType(mysqlType string, treatTinyIntAsBoolean bool) StreamProperty {
 	if strings.HasPrefix(mysqlType, "int") {
 		return StreamProperty{Types: []string{
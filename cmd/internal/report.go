@@ -0,0 +1,203 @@
+package internal
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ReadStatus describes how a Read of a stream from a shard ended.
+type ReadStatus string
+
+const (
+	// ReadStatusFinished means all rows up to the latest known position were read.
+	ReadStatusFinished ReadStatus = "finished"
+	// ReadStatusInterrupted means the read returned early, before reaching the latest known position,
+	// for example because of a timeout.
+	ReadStatusInterrupted ReadStatus = "interrupted"
+	// ReadStatusFailed means the read returned an error.
+	ReadStatusFailed ReadStatus = "failed"
+)
+
+// ReadOutcome is reported by a PlanetScaleDatabase when a Read ends without an error.
+type ReadOutcome struct {
+	Status ReadStatus
+	// Reason explains why a read was interrupted.
+	Reason string
+}
+
+// SyncReport is a machine-readable summary of a sync operation
+// example:
+//
+//	{
+//	 "started_at": "2023-11-20T16:45:33Z",
+//	 "finished_at": "2023-11-20T16:46:03Z",
+//	 "duration_seconds": 30,
+//	 "streams": [
+//	   {
+//	     "stream": "departments",
+//	     "rows_emitted": 9,
+//	     "rows_dropped": 0,
+//	     "shards": [
+//	       {
+//	         "shard": "-",
+//	         "status": "finished",
+//	         "rows_emitted": 9,
+//	         "rows_dropped": 0,
+//	         "checkpoints": 0,
+//	         "started_at": "2023-11-20T16:45:34Z",
+//	         "finished_at": "2023-11-20T16:46:02Z",
+//	         "duration_seconds": 28,
+//	         "start_position": "",
+//	         "end_position": "MySQL56/e42292e8-e28f-11ec-9c5b-d680f5d655b3:1-717"
+//	       }
+//	     ]
+//	   }
+//	 ]
+//	}
+type SyncReport struct {
+	StartedAt       time.Time       `json:"started_at"`
+	FinishedAt      time.Time       `json:"finished_at"`
+	DurationSeconds float64         `json:"duration_seconds"`
+	Snapshot        *Snapshot       `json:"snapshot,omitempty"`
+	Streams         []*StreamReport `json:"streams"`
+	Error           string          `json:"error,omitempty"`
+}
+
+type StreamReport struct {
+	Stream      string            `json:"stream"`
+	RowsEmitted int               `json:"rows_emitted"`
+	RowsDropped int               `json:"rows_dropped"`
+	Copy        *CopyReport       `json:"copy,omitempty"`
+	Resnapshot  *ResnapshotReport `json:"resnapshot,omitempty"`
+	Select      *SelectReport     `json:"select,omitempty"`
+	Shards      []*ShardReport    `json:"shards"`
+}
+
+// CopyReport is the outcome of copying a table in chunks.
+type CopyReport struct {
+	Chunks          int     `json:"chunks"`
+	ChunksCopied    int     `json:"chunks_copied"`
+	RowsEmitted     int     `json:"rows_emitted"`
+	RowsDropped     int     `json:"rows_dropped"`
+	Checkpoints     int     `json:"checkpoints"`
+	DurationSeconds float64 `json:"duration_seconds"`
+}
+
+// ResnapshotReport is the outcome of copying a table again while its changes are read.
+type ResnapshotReport struct {
+	Chunks      int `json:"chunks"`
+	RowsEmitted int `json:"rows_emitted"`
+	// RowsSuperseded is the number of selected rows that were left out because a change to them was emitted instead.
+	RowsSuperseded  int     `json:"rows_superseded"`
+	ChangesEmitted  int     `json:"changes_emitted"`
+	DurationSeconds float64 `json:"duration_seconds"`
+}
+
+type ShardReport struct {
+	Shard      string     `json:"shard"`
+	Status     ReadStatus `json:"status"`
+	Reason     string     `json:"reason,omitempty"`
+	TabletType string     `json:"tablet_type,omitempty"`
+	// ReplicaLagSeconds is how far behind their primary the tablets that were read from were, when they were checked.
+	ReplicaLagSeconds *int64    `json:"replica_lag_seconds,omitempty"`
+	RowsEmitted       int       `json:"rows_emitted"`
+	RowsDropped       int       `json:"rows_dropped"`
+	Checkpoints       int       `json:"checkpoints"`
+	StartedAt         time.Time `json:"started_at"`
+	FinishedAt        time.Time `json:"finished_at"`
+	DurationSeconds   float64   `json:"duration_seconds"`
+	StartPosition     string    `json:"start_position"`
+	EndPosition       string    `json:"end_position"`
+	Errors            []string  `json:"errors,omitempty"`
+}
+
+func NewSyncReport() *SyncReport {
+	return &SyncReport{
+		StartedAt: time.Now().UTC(),
+		Streams:   []*StreamReport{},
+	}
+}
+
+// AddStream starts tracking the outcome of a stream.
+func (r *SyncReport) AddStream(name string) *StreamReport {
+	sr := &StreamReport{
+		Stream: name,
+		Shards: []*ShardReport{},
+	}
+	r.Streams = append(r.Streams, sr)
+	return sr
+}
+
+// stream returns the report of a stream, and starts tracking the stream if it is not tracked yet.
+func (r *SyncReport) stream(name string) *StreamReport {
+	for _, sr := range r.Streams {
+		if sr.Stream == name {
+			return sr
+		}
+	}
+	return r.AddStream(name)
+}
+
+// Finish records the end of a sync operation, along with the error it failed with, if any.
+func (r *SyncReport) Finish(err error) {
+	r.FinishedAt = time.Now().UTC()
+	r.DurationSeconds = r.FinishedAt.Sub(r.StartedAt).Seconds()
+	if err != nil {
+		r.Error = err.Error()
+	}
+}
+
+// AddShard starts tracking the outcome of reading a stream from a shard.
+func (sr *StreamReport) AddShard(shard, startPosition string) *ShardReport {
+	shr := &ShardReport{
+		Shard:         shard,
+		StartedAt:     time.Now().UTC(),
+		StartPosition: startPosition,
+	}
+	sr.Shards = append(sr.Shards, shr)
+	return shr
+}
+
+// AddRows records rows emitted and dropped while reading from a shard.
+func (sr *StreamReport) AddRows(shr *ShardReport, emitted, dropped int) {
+	shr.RowsEmitted += emitted
+	shr.RowsDropped += dropped
+	sr.RowsEmitted += emitted
+	sr.RowsDropped += dropped
+}
+
+// Finish records the end of a read from a shard.
+// A shard that has not reported an outcome is considered finished unless it failed with err.
+func (shr *ShardReport) Finish(endPosition string, err error) {
+	shr.FinishedAt = time.Now().UTC()
+	shr.DurationSeconds = shr.FinishedAt.Sub(shr.StartedAt).Seconds()
+	shr.EndPosition = endPosition
+	if err != nil {
+		shr.Status = ReadStatusFailed
+		shr.Errors = append(shr.Errors, err.Error())
+	} else if shr.Status == "" {
+		shr.Status = ReadStatusFinished
+	}
+}
+
+// WriteReport writes the report as a single line of JSON.
+func WriteReport(w io.Writer, report *SyncReport) error {
+	return json.NewEncoder(w).Encode(report)
+}
+
+// WriteReportFile writes the report as JSON to the file at the given path.
+func WriteReportFile(path string, report *SyncReport) error {
+	b, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "unable to serialize sync report")
+	}
+
+	if err := os.WriteFile(path, b, 0o644); err != nil {
+		return errors.Wrapf(err, "unable to write sync report to path %v", path)
+	}
+	return nil
+}
@@ -0,0 +1,233 @@
+package internal
+
+import (
+	"context"
+	"encoding/binary"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"vitess.io/vitess/go/sqltypes"
+)
+
+// Resnapshot is the progress of copying the rows of an incrementally synced table again,
+// while changes to it continue to be read.
+type Resnapshot struct {
+	// After is the key of the last row copied, empty if no rows were copied yet.
+	After string `json:"after,omitempty"`
+}
+
+// requestResnapshots records that the given streams should be copied again,
+// streams that are already being copied again continue where they left off.
+func requestResnapshots(state *State, streams []Stream, names []string) error {
+	for _, name := range names {
+		var found *Stream
+		for i := range streams {
+			if streams[i].Name == name {
+				found = &streams[i]
+				break
+			}
+		}
+		if found == nil {
+			return errors.Errorf("unable to re-snapshot stream %v, it is not selected", name)
+		}
+		if !found.IncrementalSyncRequested() {
+			return errors.Errorf("unable to re-snapshot stream %v, it is not synced incrementally", name)
+		}
+		if len(found.KeyProperties) == 0 {
+			return errors.Errorf("unable to re-snapshot stream %v, it has no key properties", name)
+		}
+		if state.Resnapshots == nil {
+			state.Resnapshots = map[string]*Resnapshot{}
+		}
+		if state.Resnapshots[name] == nil {
+			state.Resnapshots[name] = &Resnapshot{}
+		}
+	}
+	return nil
+}
+
+// resnapshotTable copies all rows of a stream's table again, in key order, while reading changes to it.
+// Every chunk of rows is selected between two watermarks: the position every shard was read up to before the select,
+// and the position of every shard after it. Changes up to the second watermark are read and emitted first,
+// and rows of the chunk that were changed are left out of it, since the change is at least as new as the selected row.
+// Progress is saved in the state after every chunk, so an interrupted re-snapshot continues from the last chunk.
+func resnapshotTable(ctx context.Context, mysqlDatabase PlanetScaleEdgeMysqlAccess, edgeDatabase PlanetScaleDatabase, logger Logger, source PlanetScaleSource, stream Stream, filter *RowFilter, transformer *RecordTransformer, state *State, recordWriter RecordWriter, streamReport *StreamReport, throttle *Throttle, lagGuard *replicaLagGuard) error {
+	progress := state.Resnapshots[stream.Name]
+	emittedStream := transformer.Schema(stream)
+	shards := state.Streams[stream.Name].Shards
+	for shard, cursor := range shards {
+		tc, err := cursor.SerializedCursorToTableCursor()
+		if err != nil {
+			return err
+		}
+		if tc.LastKnownPk != nil {
+			return errors.Errorf("unable to re-snapshot stream %v, shard %v is still being copied", stream.Name, shard)
+		}
+		if len(tc.Position) == 0 {
+			// the stream has not been read yet, so it is copied in full anyway.
+			logger.Info("stream has not been copied yet, skipping re-snapshot", slog.String(StreamKey, stream.Name))
+			return finishResnapshot(state, emittedStream, recordWriter)
+		}
+	}
+
+	started := time.Now()
+	report := &ResnapshotReport{}
+	streamReport.Resnapshot = report
+	logger.Info("copying stream again while reading its changes", slog.String(StreamKey, stream.Name))
+
+	after, err := decodeKey(progress.After)
+	if err != nil {
+		return err
+	}
+	columns := readColumns(stream, filter)
+	for _, key := range stream.KeyProperties {
+		if !contains(columns, key) {
+			columns = append(columns, key)
+		}
+	}
+	var where string
+	if filter != nil {
+		where = filter.SQL()
+	}
+
+	for {
+		// changes up to the position every shard was read up to have already been emitted,
+		// so the selected rows are at least as new as them.
+		chunk, err := mysqlDatabase.GetTableRows(ctx, source, TableRowsQuery{
+			Table:      stream.tableName(),
+			Columns:    columns,
+			KeyColumns: stream.KeyProperties,
+			After:      after,
+			Where:      where,
+			Limit:      copyBatchSize,
+		})
+		if err != nil {
+			return errors.Wrapf(err, "unable to re-snapshot stream %v", stream.Name)
+		}
+		if err := throttle.wait(ctx, stream, chunk); err != nil {
+			return err
+		}
+
+		changed, err := readToWatermark(ctx, edgeDatabase, source, stream, emittedStream, filter, transformer, state, recordWriter, streamReport, report, lagGuard)
+		if err != nil {
+			return err
+		}
+
+		unchanged := &sqltypes.Result{Fields: chunk.Fields}
+		for i, row := range chunk.Rows {
+			if !changed[rowKey(keyValues(chunk, i, stream.KeyProperties))] {
+				unchanged.Rows = append(unchanged.Rows, row)
+			}
+		}
+		emitted, err := printQueryResult(unchanged, stream, emittedStream, filter, transformer, recordWriter)
+		if err != nil {
+			return err
+		}
+		report.Chunks++
+		report.RowsEmitted += emitted
+		report.RowsSuperseded += len(chunk.Rows) - len(unchanged.Rows)
+		streamReport.RowsEmitted += emitted
+		streamReport.RowsDropped += len(unchanged.Rows) - emitted
+
+		if len(chunk.Rows) < copyBatchSize {
+			report.DurationSeconds = time.Since(started).Seconds()
+			logger.Info("copied stream again", slog.String(StreamKey, stream.Name), slog.Int("rows", report.RowsEmitted))
+			return finishResnapshot(state, emittedStream, recordWriter)
+		}
+
+		after = keyValues(chunk, len(chunk.Rows)-1, stream.KeyProperties)
+		if progress.After, err = encodeKey(after); err != nil {
+			return err
+		}
+		if err := recordWriter.Flush(emittedStream); err != nil {
+			return errors.Wrap(err, "unable to flush records")
+		}
+		if err := recordWriter.State(*state); err != nil {
+			return errors.Wrap(err, "unable to serialize state")
+		}
+		report.DurationSeconds = time.Since(started).Seconds()
+	}
+}
+
+// readToWatermark reads and emits changes to a stream from every shard, up to the position each shard is at now,
+// and returns the keys of the rows that changed.
+func readToWatermark(ctx context.Context, edgeDatabase PlanetScaleDatabase, source PlanetScaleSource, stream, emittedStream Stream, filter *RowFilter, transformer *RecordTransformer, state *State, recordWriter RecordWriter, streamReport *StreamReport, report *ResnapshotReport, lagGuard *replicaLagGuard) (map[string]bool, error) {
+	changed := map[string]bool{}
+	shards := state.Streams[stream.Name].Shards
+	for shard, cursor := range shards {
+		tc, err := cursor.SerializedCursorToTableCursor()
+		if err != nil {
+			return nil, err
+		}
+		route, _, err := lagGuard.check(ctx, shard)
+		if err != nil {
+			return nil, err
+		}
+		watermark, err := edgeDatabase.LatestPosition(ctx, ReadParams{
+			Source:            source,
+			Table:             stream,
+			LastKnownPosition: tc,
+			TabletType:        route.TabletType,
+			Cells:             route.Cells,
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to get position of shard %v to re-snapshot stream %v", shard, stream.Name)
+		}
+
+		newCursor, err := edgeDatabase.Read(ctx, ReadParams{
+			Source:            source,
+			Table:             stream,
+			LastKnownPosition: tc,
+			Columns:           readColumns(stream, filter),
+			OnResult: func(sqlResult *sqltypes.Result) error {
+				for i := range sqlResult.Rows {
+					changed[rowKey(keyValues(sqlResult, i, stream.KeyProperties))] = true
+				}
+				emitted, err := printQueryResult(sqlResult, stream, emittedStream, filter, transformer, recordWriter)
+				report.ChangesEmitted += emitted
+				streamReport.RowsEmitted += emitted
+				streamReport.RowsDropped += len(sqlResult.Rows) - emitted
+				return err
+			},
+			TabletType:   route.TabletType,
+			Cells:        route.Cells,
+			StopPosition: watermark,
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to read changes to stream %v from shard %v", stream.Name, shard)
+		}
+		if newCursor == nil {
+			return nil, errors.New("should return valid cursor, got nil")
+		}
+		shards[shard] = newCursor
+	}
+	return changed, nil
+}
+
+func finishResnapshot(state *State, stream Stream, recordWriter RecordWriter) error {
+	delete(state.Resnapshots, stream.Name)
+	if len(state.Resnapshots) == 0 {
+		state.Resnapshots = nil
+	}
+	if err := recordWriter.Flush(stream); err != nil {
+		return errors.Wrap(err, "unable to flush records")
+	}
+	if err := recordWriter.State(*state); err != nil {
+		return errors.Wrap(err, "unable to serialize state")
+	}
+	return nil
+}
+
+// rowKey identifies a row by the raw bytes of its key values,
+// which are the same whether the row was selected or read from a change.
+func rowKey(values []sqltypes.Value) string {
+	var sb strings.Builder
+	for _, v := range values {
+		raw := v.Raw()
+		sb.Write(binary.AppendUvarint(nil, uint64(len(raw))))
+		sb.Write(raw)
+	}
+	return sb.String()
+}
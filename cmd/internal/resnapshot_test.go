@@ -0,0 +1,132 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"vitess.io/vitess/go/sqltypes"
+)
+
+// getResnapshotEdgeDatabase returns an edge database whose position moves forward every time it is asked for it,
+// and which reads the given changes from the first position.
+func getResnapshotEdgeDatabase(t *testing.T, changes *sqltypes.Result) *testPlanetScaleEdgeDatabase {
+	positions := 1
+	return &testPlanetScaleEdgeDatabase{
+		LatestPositionFn: func(ctx context.Context, params ReadParams) (string, error) {
+			positions++
+			return fmt.Sprintf("pos%v", positions), nil
+		},
+		ReadParamsFn: func(ctx context.Context, params ReadParams) (*SerializedCursor, error) {
+			if params.LastKnownPosition.Position == "pos1" && changes != nil {
+				require.NoError(t, params.OnResult(changes))
+			}
+			if len(params.StopPosition) > 0 {
+				return TableCursorToSerializedCursor(getContinuousCursor(params.StopPosition))
+			}
+			return TableCursorToSerializedCursor(params.LastKnownPosition)
+		},
+	}
+}
+
+func getResnapshotState(t *testing.T, resnapshots map[string]*Resnapshot) *State {
+	cursor, err := TableCursorToSerializedCursor(getContinuousCursor("pos1"))
+	require.NoError(t, err)
+	return &State{
+		Streams:     map[string]ShardStates{"employees": {Shards: map[string]*SerializedCursor{"-": cursor}}},
+		Resnapshots: resnapshots,
+	}
+}
+
+func firstNames(records []Record) []interface{} {
+	var names []interface{}
+	for _, r := range records {
+		names = append(names, r.Data["first_name"])
+	}
+	return names
+}
+
+func TestSync_ResnapshotLeavesOutRowsChangedBetweenWatermarks(t *testing.T) {
+	copyBatchSize = 2
+	defer func() { copyBatchSize = 10000 }()
+
+	tma, queries := getCopyMysqlAccess(t, nil, "1|a", "2|b", "3|c")
+	ped := getResnapshotEdgeDatabase(t, getVerifyResult("2|b2"))
+	logger := &testSingerLogger{}
+
+	report, err := Sync(context.Background(), tma, ped, logger, PlanetScaleSource{Database: "employees"}, getContinuousCatalog(), getResnapshotState(t, nil), logger, SyncSettings{Resnapshot: []string{"employees"}})
+	require.NoError(t, err)
+
+	// the change to row 2 is emitted instead of the selected row, rows after the watermark are not affected.
+	assert.Equal(t, []interface{}{"b2", "a", "c"}, firstNames(logger.records["employees"]))
+	require.Len(t, *queries, 2)
+	assert.Empty(t, (*queries)[0].After)
+
+	resnapshot := report.stream("employees").Resnapshot
+	require.NotNil(t, resnapshot)
+	assert.Equal(t, 2, resnapshot.Chunks)
+	assert.Equal(t, 2, resnapshot.RowsEmitted)
+	assert.Equal(t, 1, resnapshot.RowsSuperseded)
+	assert.Equal(t, 1, resnapshot.ChangesEmitted)
+	assert.Equal(t, 3, report.stream("employees").RowsEmitted)
+
+	// the re-snapshot is removed from the state once it is done.
+	require.NotEmpty(t, logger.state)
+	last := logger.state[len(logger.state)-1]
+	assert.Empty(t, last.Resnapshots)
+	tc, err := last.Streams["employees"].Shards["-"].SerializedCursorToTableCursor()
+	require.NoError(t, err)
+	assert.Equal(t, "pos3", tc.Position)
+}
+
+func TestSync_ResumesInterruptedResnapshot(t *testing.T) {
+	tma, queries := getCopyMysqlAccess(t, nil, "1|a", "2|b", "3|c")
+	ped := getResnapshotEdgeDatabase(t, nil)
+	logger := &testSingerLogger{}
+
+	two, err := encodeKey([]sqltypes.Value{sqltypes.NewInt64(2)})
+	require.NoError(t, err)
+	state := getResnapshotState(t, map[string]*Resnapshot{"employees": {After: two}})
+
+	_, err = Sync(context.Background(), tma, ped, logger, PlanetScaleSource{Database: "employees"}, getContinuousCatalog(), state, logger, SyncSettings{})
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"c"}, firstNames(logger.records["employees"]))
+	require.Len(t, *queries, 1)
+	after, err := (*queries)[0].After[0].ToInt64()
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), after)
+}
+
+func TestSync_ResnapshotSkipsStreamsThatWereNotCopied(t *testing.T) {
+	tma, queries := getCopyMysqlAccess(t, nil, "1|a")
+	ped := getResnapshotEdgeDatabase(t, nil)
+	logger := &testSingerLogger{}
+
+	_, err := Sync(context.Background(), tma, ped, logger, PlanetScaleSource{Database: "employees"}, getContinuousCatalog(), nil, logger, SyncSettings{Resnapshot: []string{"employees"}})
+	require.NoError(t, err)
+	assert.Empty(t, *queries)
+	require.NotEmpty(t, logger.state)
+	assert.Empty(t, logger.state[len(logger.state)-1].Resnapshots)
+}
+
+func TestSync_RejectsInvalidResnapshots(t *testing.T) {
+	fullTable := getVerifyCatalog()
+	tests := []struct {
+		catalog  Catalog
+		settings SyncSettings
+		err      string
+	}{
+		{getContinuousCatalog(), SyncSettings{Resnapshot: []string{"departments"}}, "unable to re-snapshot stream departments, it is not selected"},
+		{fullTable, SyncSettings{Resnapshot: []string{"employees"}}, "unable to re-snapshot stream employees, it is not synced incrementally"},
+		{getContinuousCatalog(), SyncSettings{Resnapshot: []string{"employees"}, ConsistentSnapshot: true}, "cannot be re-snapshotted in a sync with a consistent snapshot"},
+	}
+	for _, tt := range tests {
+		tma, _ := getCopyMysqlAccess(t, nil)
+		ped := getResnapshotEdgeDatabase(t, nil)
+		logger := &testSingerLogger{}
+		_, err := Sync(context.Background(), tma, ped, logger, PlanetScaleSource{Database: "employees"}, tt.catalog, getResnapshotState(t, nil), logger, tt.settings)
+		assert.ErrorContains(t, err, tt.err)
+	}
+}
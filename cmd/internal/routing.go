@@ -0,0 +1,122 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	psdbconnect "github.com/planetscale/airbyte-source/proto/psdbconnect/v1alpha1"
+)
+
+// TabletRoute is the type of tablet and the cells that rows are read from.
+type TabletRoute struct {
+	TabletType psdbconnect.TabletType
+	Cells      []string
+}
+
+// ParseTabletType returns the tablet type for one of primary, replica or rdonly.
+func ParseTabletType(s string) (psdbconnect.TabletType, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "primary", "master":
+		return psdbconnect.TabletType_primary, nil
+	case "replica":
+		return psdbconnect.TabletType_replica, nil
+	case "rdonly", "read_only", "readonly":
+		return psdbconnect.TabletType_read_only, nil
+	}
+	return psdbconnect.TabletType_primary, errors.Errorf("unsupported tablet type %q, must be one of primary, replica, rdonly", s)
+}
+
+// RouteTablets lists the tablets of a database and picks the ones to read rows from,
+// see routeTablets.
+func RouteTablets(ctx context.Context, mysqlDatabase PlanetScaleEdgeMysqlAccess, psc PlanetScaleSource, defaultTabletType psdbconnect.TabletType) (TabletRoute, error) {
+	tablets, err := mysqlDatabase.GetVitessTablets(ctx, psc)
+	if err != nil {
+		return TabletRoute{}, err
+	}
+	return routeTablets(psc, defaultTabletType, tablets)
+}
+
+// routeTablets picks the first of the source's tablet types, in order of preference, that has a serving tablet
+// in one of the source's cells, or in any cell if it has none. Of the cells with a serving tablet of that type,
+// the source's preferred cells are used if there are any, otherwise all of them.
+// defaultTabletType is the only tablet type tried if the source has none.
+func routeTablets(psc PlanetScaleSource, defaultTabletType psdbconnect.TabletType, tablets []VitessTablet) (TabletRoute, error) {
+	tabletTypes := []psdbconnect.TabletType{defaultTabletType}
+	if len(psc.TabletTypes) > 0 {
+		tabletTypes = tabletTypes[:0]
+		for _, s := range psc.TabletTypes {
+			tabletType, err := ParseTabletType(s)
+			if err != nil {
+				return TabletRoute{}, err
+			}
+			tabletTypes = append(tabletTypes, tabletType)
+		}
+	}
+
+	var tried []string
+	for _, tabletType := range tabletTypes {
+		cells := servingCells(tabletType, tablets, psc.Cells)
+		tried = append(tried, TabletTypeToString(tabletType))
+		if len(cells) == 0 {
+			continue
+		}
+
+		var preferred []string
+		for _, cell := range cells {
+			if matchesCell(cell, psc.PreferredCells) {
+				preferred = append(preferred, cell)
+			}
+		}
+		if len(preferred) > 0 {
+			cells = preferred
+		}
+		return TabletRoute{TabletType: tabletType, Cells: cells}, nil
+	}
+
+	message := fmt.Sprintf("unable to find any serving tablets of type %v", strings.Join(tried, ", "))
+	if len(psc.Cells) > 0 {
+		message += fmt.Sprintf(" in cells %v", strings.Join(psc.Cells, ", "))
+	}
+	return TabletRoute{}, errors.New(message)
+}
+
+// servingCells returns the cells that have a serving tablet of a type, limited to the allowed cells if there are any.
+func servingCells(tabletType psdbconnect.TabletType, tablets []VitessTablet, allowed []string) []string {
+	var cells []string
+	for _, tablet := range tablets {
+		if !strings.EqualFold(tablet.TabletType, vitessTabletType(tabletType)) || !strings.EqualFold(tablet.State, "SERVING") {
+			continue
+		}
+		if len(allowed) > 0 && !matchesCell(tablet.Cell, allowed) {
+			continue
+		}
+		if !contains(cells, tablet.Cell) {
+			cells = append(cells, tablet.Cell)
+		}
+	}
+	return cells
+}
+
+// matchesCell reports whether a cell is one of the given cells or regions,
+// where a region such as aws_useast1 matches every cell whose name starts with it.
+func matchesCell(cell string, cellsOrRegions []string) bool {
+	for _, c := range cellsOrRegions {
+		if strings.HasPrefix(cell, c) {
+			return true
+		}
+	}
+	return false
+}
+
+// vitessTabletType is the name of a tablet type in the output of SHOW VITESS_TABLETS.
+func vitessTabletType(tabletType psdbconnect.TabletType) string {
+	switch tabletType {
+	case psdbconnect.TabletType_replica:
+		return "REPLICA"
+	case psdbconnect.TabletType_read_only:
+		return "RDONLY"
+	}
+	return "PRIMARY"
+}
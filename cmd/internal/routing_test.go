@@ -0,0 +1,112 @@
+package internal
+
+import (
+	"context"
+	"testing"
+
+	psdbconnect "github.com/planetscale/airbyte-source/proto/psdbconnect/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func getRoutingTablets() []VitessTablet {
+	return []VitessTablet{
+		{Cell: "aws_useast1a_1", TabletType: "PRIMARY", State: "SERVING"},
+		{Cell: "aws_useast1b_2", TabletType: "REPLICA", State: "SERVING"},
+		{Cell: "aws_useast1c_3", TabletType: "REPLICA", State: "SERVING"},
+		{Cell: "aws_uswest2a_4", TabletType: "REPLICA", State: "SERVING"},
+		{Cell: "aws_useast1c_3", TabletType: "RDONLY", State: "NOT_SERVING"},
+	}
+}
+
+func TestRouteTablets(t *testing.T) {
+	tests := []struct {
+		name   string
+		source PlanetScaleSource
+		route  TabletRoute
+		err    string
+	}{
+		{
+			name:   "uses the default tablet type without tablet types",
+			source: PlanetScaleSource{},
+			route:  TabletRoute{TabletType: psdbconnect.TabletType_primary, Cells: []string{"aws_useast1a_1"}},
+		},
+		{
+			name:   "falls back when no tablet of a type is serving",
+			source: PlanetScaleSource{TabletTypes: []string{"rdonly", "replica", "primary"}},
+			route:  TabletRoute{TabletType: psdbconnect.TabletType_replica, Cells: []string{"aws_useast1b_2", "aws_useast1c_3", "aws_uswest2a_4"}},
+		},
+		{
+			name:   "uses preferred cells that have a tablet of the type",
+			source: PlanetScaleSource{TabletTypes: []string{"replica"}, PreferredCells: []string{"aws_uswest2", "aws_euwest1"}},
+			route:  TabletRoute{TabletType: psdbconnect.TabletType_replica, Cells: []string{"aws_uswest2a_4"}},
+		},
+		{
+			name:   "uses all cells if no preferred cell has a tablet of the type",
+			source: PlanetScaleSource{TabletTypes: []string{"primary"}, PreferredCells: []string{"aws_uswest2"}},
+			route:  TabletRoute{TabletType: psdbconnect.TabletType_primary, Cells: []string{"aws_useast1a_1"}},
+		},
+		{
+			name:   "falls back when no tablet of a type is in the allowed cells",
+			source: PlanetScaleSource{TabletTypes: []string{"primary", "replica"}, Cells: []string{"aws_useast1c"}},
+			route:  TabletRoute{TabletType: psdbconnect.TabletType_replica, Cells: []string{"aws_useast1c_3"}},
+		},
+		{
+			name:   "fails without any serving tablet",
+			source: PlanetScaleSource{TabletTypes: []string{"rdonly", "primary"}, Cells: []string{"aws_uswest2"}},
+			err:    "unable to find any serving tablets of type rdonly, primary in cells aws_uswest2",
+		},
+		{
+			name:   "fails with an unknown tablet type",
+			source: PlanetScaleSource{TabletTypes: []string{"spare"}},
+			err:    `unsupported tablet type "spare"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			route, err := routeTablets(tt.source, psdbconnect.TabletType_primary, getRoutingTablets())
+			if len(tt.err) > 0 {
+				assert.ErrorContains(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.route, route)
+		})
+	}
+}
+
+func TestTabletTypeToString_RoundTrips(t *testing.T) {
+	for _, tabletType := range []psdbconnect.TabletType{psdbconnect.TabletType_primary, psdbconnect.TabletType_replica, psdbconnect.TabletType_read_only} {
+		parsed, err := ParseTabletType(TabletTypeToString(tabletType))
+		require.NoError(t, err)
+		assert.Equal(t, tabletType, parsed)
+	}
+}
+
+func TestSync_ReadsFromRoutedTablets(t *testing.T) {
+	tma := getTestMysqlAccess()
+	tma.GetVitessTabletsFn = func(ctx context.Context, psc PlanetScaleSource) ([]VitessTablet, error) {
+		return getRoutingTablets(), nil
+	}
+	var read []TabletRoute
+	ped := &testPlanetScaleEdgeDatabase{
+		ReadParamsFn: func(ctx context.Context, params ReadParams) (*SerializedCursor, error) {
+			read = append(read, TabletRoute{TabletType: params.TabletType, Cells: params.Cells})
+			return TableCursorToSerializedCursor(params.LastKnownPosition)
+		},
+	}
+	source := PlanetScaleSource{Database: "employees", TabletTypes: []string{"rdonly", "replica"}, PreferredCells: []string{"aws_useast1c"}}
+
+	_, err := Sync(context.Background(), tma, ped, &testSingerLogger{}, source, getOrderedCatalog(NodeMetadata{}), nil, &eventRecordWriter{}, SyncSettings{})
+	require.NoError(t, err)
+	assert.Equal(t, []TabletRoute{{TabletType: psdbconnect.TabletType_replica, Cells: []string{"aws_useast1c_3"}}}, read)
+
+	// a route that was already picked is used as is.
+	tma.GetVitessTabletsFnInvoked = false
+	read = nil
+	route := &TabletRoute{TabletType: psdbconnect.TabletType_read_only, Cells: []string{"aws_useast1a_1"}}
+	_, err = Sync(context.Background(), tma, ped, &testSingerLogger{}, source, getOrderedCatalog(NodeMetadata{}), nil, &eventRecordWriter{}, SyncSettings{Route: route})
+	require.NoError(t, err)
+	assert.Equal(t, []TabletRoute{*route}, read)
+	assert.False(t, tma.GetVitessTabletsFnInvoked)
+}
@@ -0,0 +1,137 @@
+package internal
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/pkg/errors"
+	"vitess.io/vitess/go/sqltypes"
+)
+
+// SampleSettings configures how many rows are previewed from each selected stream.
+type SampleSettings struct {
+	Rows int
+}
+
+// StreamSample summarizes the rows previewed from a stream.
+type StreamSample struct {
+	Stream   string
+	Rows     int
+	Failures []ConversionFailure
+}
+
+// ConversionFailure describes a value that could not be converted to the type in the stream's schema.
+type ConversionFailure struct {
+	Row      int
+	Property string
+	Value    string
+	Types    []string
+	Error    string
+}
+
+// Sample reads the first rows of every selected stream in the catalog and writes them as records,
+// without reading or writing any state. Rows with values that cannot be converted are not written,
+// instead every such value is reported as a ConversionFailure.
+func Sample(ctx context.Context, mysqlDatabase PlanetScaleEdgeMysqlAccess, logger Logger, source PlanetScaleSource, catalog Catalog, settings SampleSettings) ([]StreamSample, error) {
+	filters, err := newRowFilters(catalog)
+	if err != nil {
+		return nil, err
+	}
+
+	filteredSchema, err := filterSchema(catalog)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to filter schema")
+	}
+
+	transformers, err := newRecordTransformers(filteredSchema)
+	if err != nil {
+		return nil, err
+	}
+
+	var samples []StreamSample
+	for _, stream := range filteredSchema.Streams {
+		sample := StreamSample{Stream: stream.Name}
+		columns := stream.Metadata.GetSelectedProperties()
+		if len(columns) == 0 {
+			logger.Warn("stream has no selected properties, skipping", slog.String(StreamKey, stream.Name))
+			samples = append(samples, sample)
+			continue
+		}
+
+		query := TableRowsQuery{
+			Table:      stream.tableName(),
+			Columns:    columns,
+			KeyColumns: stream.KeyProperties,
+			Limit:      settings.Rows,
+		}
+		if filter, ok := filters[stream.Name]; ok {
+			query.Where = filter.SQL()
+		}
+		qr, err := mysqlDatabase.GetTableRows(ctx, source, query)
+		if err != nil {
+			return samples, errors.Wrapf(err, "unable to read rows for stream %q", stream.Name)
+		}
+
+		transformer := transformers[stream.Name]
+		if err := logger.StreamSchema(transformer.Schema(stream)); err != nil {
+			return samples, err
+		}
+		for i, datum := range QueryResultToRecords(qr) {
+			data, failures := sampleRecordData(i, datum, stream)
+			sample.Rows++
+			if len(failures) > 0 {
+				for _, failure := range failures {
+					logger.Warn("unable to convert value",
+						slog.String(StreamKey, stream.Name),
+						slog.Int("row", failure.Row),
+						slog.String("property", failure.Property),
+						slog.String("value", failure.Value),
+						slog.Any("types", failure.Types),
+						slog.String(ErrorKey, failure.Error),
+					)
+				}
+				sample.Failures = append(sample.Failures, failures...)
+				continue
+			}
+
+			record := NewRecord()
+			record.Stream = stream.Name
+			record.Data = transformer.Transform(data)
+			if err := logger.Record(record, stream); err != nil {
+				return samples, err
+			}
+		}
+		if err := logger.Flush(stream); err != nil {
+			return samples, err
+		}
+
+		logger.Info("sampled rows", slog.String(StreamKey, stream.Name), slog.Int("rows", sample.Rows), slog.Int("failures", len(sample.Failures)))
+		samples = append(samples, sample)
+	}
+
+	return samples, nil
+}
+
+// sampleRecordData converts every selected property of a row,
+// unlike recordData it does not stop at the first value that fails to convert.
+func sampleRecordData(row int, datum map[string]interface{}, s Stream) (map[string]interface{}, []ConversionFailure) {
+	var failures []ConversionFailure
+	data := map[string]interface{}{}
+	for _, selectedProperty := range s.Metadata.GetSelectedProperties() {
+		streamProperty := s.Schema.Properties[selectedProperty]
+		value, _ := datum[selectedProperty].(sqltypes.Value)
+		converted, err := Convert(streamProperty, value)
+		if err != nil {
+			failures = append(failures, ConversionFailure{
+				Row:      row,
+				Property: selectedProperty,
+				Value:    value.ToString(),
+				Types:    streamProperty.Types,
+				Error:    err.Error(),
+			})
+			continue
+		}
+		data[selectedProperty] = converted
+	}
+	return data, failures
+}
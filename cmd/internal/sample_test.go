@@ -0,0 +1,47 @@
+package internal
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"vitess.io/vitess/go/sqltypes"
+)
+
+func TestSample_CanPreviewRecords(t *testing.T) {
+	tma := getTestMysqlAccess()
+	tma.GetTableRowsFn = func(ctx context.Context, psc PlanetScaleSource, query TableRowsQuery) (*sqltypes.Result, error) {
+		assert.Equal(t, 2, query.Limit)
+		assert.Equal(t, []string{"emp_no"}, query.KeyColumns)
+		return sqltypes.MakeTestResult(sqltypes.MakeTestFields("emp_no|first_name", "int64|varchar"), "10001|Georgi", "10002|Bezalel"), nil
+	}
+	logger := &testSingerLogger{}
+
+	samples, err := Sample(context.Background(), tma, logger, PlanetScaleSource{Database: "employees"}, getVerifyCatalog(), SampleSettings{Rows: 2})
+	require.NoError(t, err)
+	require.Len(t, samples, 1)
+	assert.Equal(t, 2, samples[0].Rows)
+	assert.Empty(t, samples[0].Failures)
+	require.Len(t, logger.records["employees"], 2)
+	assert.Equal(t, map[string]interface{}{"emp_no": int64(10001), "first_name": "Georgi"}, logger.records["employees"][0].Data)
+	assert.Empty(t, logger.state, "sample mode should not write state")
+}
+
+func TestSample_CanReportConversionFailures(t *testing.T) {
+	tma := getTestMysqlAccess()
+	tma.GetTableRowsFn = func(ctx context.Context, psc PlanetScaleSource, query TableRowsQuery) (*sqltypes.Result, error) {
+		return sqltypes.MakeTestResult(sqltypes.MakeTestFields("emp_no|first_name", "int64|varchar"), "10001|Georgi", "not-a-number|Bezalel"), nil
+	}
+	logger := &testSingerLogger{}
+
+	samples, err := Sample(context.Background(), tma, logger, PlanetScaleSource{Database: "employees"}, getVerifyCatalog(), SampleSettings{Rows: 2})
+	require.NoError(t, err)
+	require.Len(t, samples[0].Failures, 1)
+	failure := samples[0].Failures[0]
+	assert.Equal(t, 1, failure.Row)
+	assert.Equal(t, "emp_no", failure.Property)
+	assert.Equal(t, "not-a-number", failure.Value)
+	assert.Len(t, logger.records["employees"], 1, "rows that fail to convert should not be written")
+	assert.Contains(t, logger.logMessages, "unable to convert value")
+}
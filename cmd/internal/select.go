@@ -0,0 +1,105 @@
+package internal
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/pkg/errors"
+	"vitess.io/vitess/go/sqltypes"
+)
+
+// selectBatchSize is the number of rows selected at a time from streams that are read with SELECT queries.
+var selectBatchSize = 10000
+
+// SelectReport is the outcome of reading a stream with SELECT queries.
+type SelectReport struct {
+	Pages           int     `json:"pages"`
+	RowsEmitted     int     `json:"rows_emitted"`
+	RowsDropped     int     `json:"rows_dropped"`
+	DurationSeconds float64 `json:"duration_seconds"`
+}
+
+// selectRequired reports whether a stream is read with SELECT queries rather than streamed.
+// Views cannot be streamed, and neither can tables without a key to resume streaming them from,
+// so discovery forces both to be synced in full.
+func (s Stream) selectRequired() bool {
+	tm := streamMetadata(s)
+	return tm.IsView || tm.ForcedReplicationMethod == "FULL_TABLE"
+}
+
+// selectTable reads all rows of a stream with SELECT queries. A stream with a key is read in pages that follow its key,
+// while a stream without one is read with a single query whose rows are emitted as they arrive,
+// since it has no order to resume a page from without reading every row before it again.
+// A stream that is read this way has no state, it is read in full every time it is synced.
+func selectTable(ctx context.Context, mysqlDatabase PlanetScaleEdgeMysqlAccess, logger Logger, source PlanetScaleSource, stream Stream, filter *RowFilter, transformer *RecordTransformer, recordWriter RecordWriter, streamReport *StreamReport, throttle *Throttle) (err error) {
+	ctx, span := startSpan(ctx, "Sync.select", streamAttribute.String(stream.Name))
+	defer func() { endSpan(span, err) }()
+
+	started := time.Now()
+	report := &SelectReport{}
+	streamReport.Select = report
+	defer func() { report.DurationSeconds = time.Since(started).Seconds() }()
+
+	emittedStream := transformer.Schema(stream)
+	logger.Info("selecting all rows of stream", slog.String(StreamKey, stream.Name))
+	columns := readColumns(stream, filter)
+	keys := stream.KeyProperties
+	for _, key := range keys {
+		if !contains(columns, key) {
+			columns = append(columns, key)
+		}
+	}
+	query := TableRowsQuery{
+		Table:      stream.tableName(),
+		Columns:    columns,
+		KeyColumns: keys,
+	}
+	if filter != nil {
+		query.Where = filter.SQL()
+	}
+
+	emitPage := func(qr *sqltypes.Result) error {
+		if err := throttle.wait(ctx, stream, qr); err != nil {
+			return err
+		}
+		report.Pages++
+
+		emitted, err := printQueryResult(qr, stream, emittedStream, filter, transformer, recordWriter)
+		report.RowsEmitted += emitted
+		report.RowsDropped += len(qr.Rows) - emitted
+		streamReport.RowsEmitted += emitted
+		streamReport.RowsDropped += len(qr.Rows) - emitted
+		if err != nil {
+			return err
+		}
+		if err := recordWriter.Flush(emittedStream); err != nil {
+			return errors.Wrap(err, "unable to flush records")
+		}
+		return nil
+	}
+
+	if len(keys) == 0 {
+		if err := mysqlDatabase.StreamTableRows(ctx, source, query, selectBatchSize, emitPage); err != nil {
+			return errors.Wrapf(err, "unable to select rows for stream %q", stream.Name)
+		}
+		logger.Info("selected all rows of stream", slog.String(StreamKey, stream.Name), slog.Int("rows", report.RowsEmitted))
+		return nil
+	}
+
+	query.Limit = selectBatchSize
+	for {
+		qr, err := mysqlDatabase.GetTableRows(ctx, source, query)
+		if err != nil {
+			return errors.Wrapf(err, "unable to select rows for stream %q", stream.Name)
+		}
+		if err := emitPage(qr); err != nil {
+			return err
+		}
+		if len(qr.Rows) < selectBatchSize {
+			logger.Info("selected all rows of stream", slog.String(StreamKey, stream.Name), slog.Int("rows", report.RowsEmitted))
+			return nil
+		}
+		query.After = keyValues(qr, len(qr.Rows)-1, keys)
+	}
+}
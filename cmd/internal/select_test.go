@@ -0,0 +1,148 @@
+package internal
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	psdbconnect "github.com/planetscale/airbyte-source/proto/psdbconnect/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"vitess.io/vitess/go/sqltypes"
+)
+
+// getSelectMysqlAccess returns a mysql mock that pages through the given rows, ordered by emp_no,
+// after the last key of the previous page, or streams all of them in batches.
+func getSelectMysqlAccess(t *testing.T, rows ...string) (*mysqlAccessMock, *[]TableRowsQuery) {
+	all := getVerifyResult(rows...)
+	var queries []TableRowsQuery
+	tma := getTestMysqlAccess()
+	tma.StreamTableRowsFn = func(ctx context.Context, psc PlanetScaleSource, query TableRowsQuery, batchSize int, onRows func(*sqltypes.Result) error) error {
+		queries = append(queries, query)
+		for start := 0; start < len(all.Rows); start += batchSize {
+			end := start + batchSize
+			if end > len(all.Rows) {
+				end = len(all.Rows)
+			}
+			if err := onRows(&sqltypes.Result{Fields: all.Fields, Rows: all.Rows[start:end]}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	tma.GetTableRowsFn = func(ctx context.Context, psc PlanetScaleSource, query TableRowsQuery) (*sqltypes.Result, error) {
+		queries = append(queries, query)
+		qr := &sqltypes.Result{Fields: all.Fields}
+		for _, row := range all.Rows {
+			if len(query.After) > 0 {
+				after, err := query.After[0].ToInt64()
+				require.NoError(t, err)
+				if current, _ := row[0].ToInt64(); current <= after {
+					continue
+				}
+			}
+			if len(qr.Rows) == query.Limit {
+				break
+			}
+			qr.Rows = append(qr.Rows, row)
+		}
+		return qr, nil
+	}
+	return tma, &queries
+}
+
+func getSelectCatalog(keyed bool) Catalog {
+	catalog := getVerifyCatalog()
+	catalog.Streams[0].Metadata[0].Metadata.ReplicationMethod = "FULL_TABLE"
+	catalog.Streams[0].Metadata[0].Metadata.ForcedReplicationMethod = "FULL_TABLE"
+	if !keyed {
+		catalog.Streams[0].KeyProperties = nil
+		catalog.Streams[0].Metadata[1].Metadata.Inclusion = "available"
+	}
+	return catalog
+}
+
+func TestSync_SelectsKeylessTableInOneQuery(t *testing.T) {
+	selectBatchSize = 2
+	defer func() { selectBatchSize = 10000 }()
+
+	tma, queries := getSelectMysqlAccess(t, "1|a", "2|b", "3|c", "4|d", "5|e")
+	ped := &testPlanetScaleEdgeDatabase{
+		ReadFn: func(ctx context.Context, ps PlanetScaleSource, s Stream, tc *psdbconnect.TableCursor) (*SerializedCursor, error) {
+			t.Error("a table without a key should not be streamed")
+			return nil, nil
+		},
+	}
+
+	rw := &eventRecordWriter{}
+	report, err := Sync(context.Background(), tma, ped, &testSingerLogger{}, PlanetScaleSource{Database: "employees"}, getSelectCatalog(false), nil, rw, SyncSettings{})
+	require.NoError(t, err)
+
+	require.Len(t, *queries, 1)
+	query := (*queries)[0]
+	assert.Equal(t, "employees", query.Table)
+	assert.Empty(t, query.KeyColumns, "rows should not be ordered")
+	assert.Zero(t, query.Limit)
+	assert.Equal(t, []string{"flush 2", "flush 2", "flush 1"}, rw.events[:3])
+
+	require.NotNil(t, report.stream("employees").Select)
+	assert.Equal(t, 3, report.stream("employees").Select.Pages)
+	assert.Equal(t, 5, report.stream("employees").Select.RowsEmitted)
+	assert.Equal(t, 5, report.stream("employees").RowsEmitted)
+	assert.NotEmpty(t, rw.states, "state should be written after the stream was selected")
+}
+
+func TestSync_SelectsViewByKey(t *testing.T) {
+	selectBatchSize = 2
+	defer func() { selectBatchSize = 10000 }()
+
+	tma, queries := getSelectMysqlAccess(t, "1|a", "2|b", "3|c", "4|d")
+	ped := &testPlanetScaleEdgeDatabase{
+		ReadFn: func(ctx context.Context, ps PlanetScaleSource, s Stream, tc *psdbconnect.TableCursor) (*SerializedCursor, error) {
+			t.Error("a view should not be streamed")
+			return nil, nil
+		},
+	}
+	catalog := getSelectCatalog(true)
+	catalog.Streams[0].Metadata[0].Metadata.IsView = true
+	catalog.Streams[0].Metadata[0].Metadata.ForcedReplicationMethod = ""
+
+	report, err := Sync(context.Background(), tma, ped, &testSingerLogger{}, PlanetScaleSource{Database: "employees"}, catalog, nil, &eventRecordWriter{}, SyncSettings{})
+	require.NoError(t, err)
+
+	require.Len(t, *queries, 3)
+	assert.Empty(t, (*queries)[0].After)
+	assert.Equal(t, []sqltypes.Value{sqltypes.NewInt64(2)}, (*queries)[1].After)
+	assert.Equal(t, []sqltypes.Value{sqltypes.NewInt64(4)}, (*queries)[2].After)
+	for _, query := range *queries {
+		assert.Equal(t, []string{"emp_no"}, query.KeyColumns)
+	}
+	assert.Equal(t, 4, report.stream("employees").Select.RowsEmitted)
+}
+
+func TestStreamTableRows_PassesRowsInBatches(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery("select `emp_no`, `first_name` from `employees`.`employees`").
+		WillReturnRows(sqlmock.NewRows([]string{"emp_no", "first_name"}).
+			AddRow(1, "Georgi").AddRow(2, "Bezalel").AddRow(3, "Parto").AddRow(4, "Chirstian"))
+
+	access := planetScaleEdgeMySQLAccess{db: db}
+	var batches [][]string
+	err = access.StreamTableRows(context.Background(), PlanetScaleSource{Database: "employees"}, TableRowsQuery{
+		Table:   "employees",
+		Columns: []string{"emp_no", "first_name"},
+	}, 2, func(qr *sqltypes.Result) error {
+		var names []string
+		for _, row := range qr.Rows {
+			names = append(names, row[1].ToString())
+		}
+		batches = append(batches, names)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{"Georgi", "Bezalel"}, {"Parto", "Chirstian"}}, batches, "a full last batch should not be followed by an empty one")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
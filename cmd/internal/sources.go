@@ -0,0 +1,159 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// NamedSource is a source in a config with several sources, the name of the source
+// namespaces the streams that are read from it.
+// example:
+//
+//	{
+//	 "sources": [
+//	   {"name": "orders", "host": "aws.connect.psdb.cloud", "database": "orders", "username": "...", "password": "..."},
+//	   {"name": "billing", "host": "billing.internal:3306", "database": "billing", "flavor": "mysql", "username": "...", "password": "..."}
+//	 ]
+//	}
+type NamedSource struct {
+	Name string `json:"name"`
+	PlanetScaleSource
+}
+
+type sourcesConfig struct {
+	Sources []NamedSource `json:"sources"`
+}
+
+// ParseSources reads the sources in a config file. A config without a list of sources
+// is a single source without a name, whose streams are not namespaced.
+func ParseSources(path string) ([]NamedSource, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to read file at path %v", path)
+	}
+	return parseSourcesContents(b)
+}
+
+func parseSourcesContents(contents []byte) ([]NamedSource, error) {
+	var config sourcesConfig
+	if err := json.Unmarshal(contents, &config); err != nil {
+		return nil, err
+	}
+
+	if len(config.Sources) == 0 {
+		var source PlanetScaleSource
+		if err := json.Unmarshal(contents, &source); err != nil {
+			return nil, err
+		}
+		return []NamedSource{{PlanetScaleSource: source}}, nil
+	}
+
+	names := map[string]bool{}
+	for i, source := range config.Sources {
+		if len(source.Name) == 0 {
+			return nil, fmt.Errorf("source %v has no name", i)
+		}
+		if names[source.Name] {
+			return nil, fmt.Errorf("source name %q is used more than once", source.Name)
+		}
+		names[source.Name] = true
+	}
+	return config.Sources, nil
+}
+
+// IsMultiSource reports whether sources were listed by name in the config,
+// in which case their streams are namespaced and their state is kept apart.
+func IsMultiSource(sources []NamedSource) bool {
+	return len(sources) > 1 || (len(sources) == 1 && len(sources[0].Name) > 0)
+}
+
+// NamespaceCatalog prefixes the names and IDs of the streams of a source with the name of the source,
+// so that streams of tables with the same name in different sources can be selected in a single catalog.
+// The table that a stream is read from is kept in its table name.
+func NamespaceCatalog(source string, catalog Catalog) Catalog {
+	namespaced := Catalog{Streams: make([]Stream, 0, len(catalog.Streams))}
+	for _, stream := range catalog.Streams {
+		stream.TableName = stream.tableName()
+		stream.Name = source + "_" + stream.Name
+		stream.ID = source + ":" + stream.ID
+		metadata := make(MetadataCollection, len(stream.Metadata))
+		copy(metadata, stream.Metadata)
+		for i := range metadata {
+			if len(metadata[i].Metadata.BreadCrumb) == 0 {
+				metadata[i].Metadata.SourceName = source
+			}
+		}
+		stream.Metadata = metadata
+		namespaced.Streams = append(namespaced.Streams, stream)
+	}
+	return namespaced
+}
+
+// MergeCatalogs joins the namespaced catalogs of several sources into one catalog.
+// A namespaced name joins the names of a source and a table with an underscore, which either of them may hold,
+// so streams of different sources can end up with the same name, which is rejected.
+func MergeCatalogs(catalogs ...Catalog) (Catalog, error) {
+	var merged Catalog
+	sources := map[string]string{}
+	for _, catalog := range catalogs {
+		for _, stream := range catalog.Streams {
+			source := streamMetadata(stream).SourceName
+			if other, ok := sources[stream.Name]; ok {
+				return Catalog{}, fmt.Errorf("stream name %q is used by tables of sources %q and %q, rename one of the sources", stream.Name, other, source)
+			}
+			sources[stream.Name] = source
+			merged.Streams = append(merged.Streams, stream)
+		}
+	}
+	return merged, nil
+}
+
+// SplitCatalog returns the streams of a catalog by the name of the source they are read from.
+// Every selected stream must name one of the sources in its source-name metadata.
+func SplitCatalog(catalog Catalog, sources []NamedSource) (map[string]Catalog, error) {
+	catalogs := make(map[string]Catalog, len(sources))
+	for _, source := range sources {
+		catalogs[source.Name] = Catalog{}
+	}
+
+	for _, stream := range catalog.Streams {
+		tm := streamMetadata(stream)
+		c, ok := catalogs[tm.SourceName]
+		if !ok {
+			// streams that are not selected are left out, whichever source they came from.
+			if !tm.Selected {
+				continue
+			}
+			if len(tm.SourceName) == 0 {
+				return nil, fmt.Errorf("stream %q has no source-name metadata", stream.Name)
+			}
+			return nil, fmt.Errorf("stream %q is read from source %q, which is not in the config", stream.Name, tm.SourceName)
+		}
+		c.Streams = append(c.Streams, stream)
+		catalogs[tm.SourceName] = c
+	}
+	return catalogs, nil
+}
+
+// NewSourceStateWriter returns a RecordWriter for syncing a source in a config with several sources.
+// The state that a sync of the source emits is written as the source's part of the state of all sources.
+func NewSourceStateWriter(recordWriter RecordWriter, state *State, source string) RecordWriter {
+	return &sourceStateWriter{RecordWriter: recordWriter, state: state, source: source}
+}
+
+type sourceStateWriter struct {
+	RecordWriter
+	state  *State
+	source string
+}
+
+func (w *sourceStateWriter) State(state State) error {
+	if w.state.Sources == nil {
+		w.state.Sources = map[string]*State{}
+	}
+	w.state.Sources[w.source] = &state
+	return w.RecordWriter.State(*w.state)
+}
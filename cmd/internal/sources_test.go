@@ -0,0 +1,148 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	psdbconnect "github.com/planetscale/airbyte-source/proto/psdbconnect/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSources_ReadsSingleOrNamedSources(t *testing.T) {
+	sources, err := parseSourcesContents([]byte(`{"host": "aws.connect.psdb.cloud", "database": "employees"}`))
+	require.NoError(t, err)
+	require.Len(t, sources, 1)
+	assert.Empty(t, sources[0].Name)
+	assert.Equal(t, "employees", sources[0].Database)
+	assert.False(t, IsMultiSource(sources))
+
+	sources, err = parseSourcesContents([]byte(`{"sources": [
+		{"name": "hr", "host": "aws.connect.psdb.cloud", "database": "employees"},
+		{"name": "billing", "host": "billing.internal:3306", "database": "billing", "flavor": "mysql"}
+	]}`))
+	require.NoError(t, err)
+	require.Len(t, sources, 2)
+	assert.Equal(t, "hr", sources[0].Name)
+	assert.Equal(t, "billing.internal:3306", sources[1].Host)
+	assert.Equal(t, FlavorMySQL, sources[1].Flavor)
+	assert.True(t, IsMultiSource(sources))
+
+	_, err = parseSourcesContents([]byte(`{"sources": [{"database": "employees"}]}`))
+	assert.EqualError(t, err, "source 0 has no name")
+
+	_, err = parseSourcesContents([]byte(`{"sources": [{"name": "hr"}, {"name": "hr"}]}`))
+	assert.EqualError(t, err, `source name "hr" is used more than once`)
+}
+
+func getSourceStream(name string, selected bool) Stream {
+	return Stream{
+		Name:      name,
+		ID:        "employees:" + name,
+		TableName: name,
+		Metadata: MetadataCollection{
+			{Metadata: NodeMetadata{Selected: selected, ReplicationMethod: "INCREMENTAL", BreadCrumb: []string{}}},
+			{Metadata: NodeMetadata{Selected: true, BreadCrumb: []string{"properties", "emp_no"}}},
+		},
+	}
+}
+
+func TestNamespaceCatalog_PrefixesStreamsWithSource(t *testing.T) {
+	catalog := Catalog{Streams: []Stream{getSourceStream("employees", true), {Name: "titles", ID: "employees:titles"}}}
+	namespaced := NamespaceCatalog("hr", catalog)
+
+	require.Len(t, namespaced.Streams, 2)
+	employees := namespaced.Streams[0]
+	assert.Equal(t, "hr_employees", employees.Name)
+	assert.Equal(t, "hr:employees:employees", employees.ID)
+	assert.Equal(t, "employees", employees.TableName)
+	assert.Equal(t, "hr", streamMetadata(employees).SourceName)
+	assert.Empty(t, employees.Metadata[1].Metadata.SourceName)
+	// a stream without a table name is read from the table it was named after.
+	assert.Equal(t, "titles", namespaced.Streams[1].tableName())
+
+	// the catalog that was namespaced is left as it was.
+	assert.Equal(t, "employees", catalog.Streams[0].Name)
+	assert.Empty(t, streamMetadata(catalog.Streams[0]).SourceName)
+}
+
+func TestMergeCatalogs_RejectsStreamsWithTheSameName(t *testing.T) {
+	hr := NamespaceCatalog("hr", Catalog{Streams: []Stream{getSourceStream("employees", true)}})
+	billing := NamespaceCatalog("billing", Catalog{Streams: []Stream{getSourceStream("employees", true)}})
+	merged, err := MergeCatalogs(hr, billing)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"hr_employees", "billing_employees"}, streamNames(merged.Streams))
+
+	// the table employees of source hr_a and the table a_employees of source hr are both named hr_a_employees.
+	first := NamespaceCatalog("hr_a", Catalog{Streams: []Stream{getSourceStream("employees", true)}})
+	second := NamespaceCatalog("hr", Catalog{Streams: []Stream{getSourceStream("a_employees", true)}})
+	_, err = MergeCatalogs(first, second)
+	assert.EqualError(t, err, `stream name "hr_a_employees" is used by tables of sources "hr_a" and "hr", rename one of the sources`)
+}
+
+func TestSplitCatalog_GroupsStreamsBySource(t *testing.T) {
+	sources := []NamedSource{{Name: "hr"}, {Name: "billing"}}
+	catalog := Catalog{}
+	catalog.Streams = append(catalog.Streams, NamespaceCatalog("hr", Catalog{Streams: []Stream{getSourceStream("employees", true)}}).Streams...)
+	catalog.Streams = append(catalog.Streams, NamespaceCatalog("billing", Catalog{Streams: []Stream{getSourceStream("invoices", true)}}).Streams...)
+	catalog.Streams = append(catalog.Streams, NamespaceCatalog("payroll", Catalog{Streams: []Stream{getSourceStream("salaries", false)}}).Streams...)
+
+	catalogs, err := SplitCatalog(catalog, sources)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"hr_employees"}, streamNames(catalogs["hr"].Streams))
+	assert.Equal(t, []string{"billing_invoices"}, streamNames(catalogs["billing"].Streams))
+
+	catalog.Streams = append(catalog.Streams, getSourceStream("departments", true))
+	_, err = SplitCatalog(catalog, sources)
+	assert.EqualError(t, err, `stream "departments" has no source-name metadata`)
+
+	catalog.Streams = NamespaceCatalog("payroll", Catalog{Streams: []Stream{getSourceStream("salaries", true)}}).Streams
+	_, err = SplitCatalog(catalog, sources)
+	assert.EqualError(t, err, `stream "payroll_salaries" is read from source "payroll", which is not in the config`)
+}
+
+func TestSync_KeysStateBySource(t *testing.T) {
+	tma := getTestMysqlAccess()
+	var tables []string
+	ped := &testPlanetScaleEdgeDatabase{
+		ReadFn: func(ctx context.Context, ps PlanetScaleSource, s Stream, tc *psdbconnect.TableCursor) (*SerializedCursor, error) {
+			tables = append(tables, ps.Database+"."+s.tableName())
+			tc.Position = "MySQL56/3e11fa47-71ca-11e1-9e33-c80aa9429562:1-" + ps.Database
+			return TableCursorToSerializedCursor(tc)
+		},
+	}
+	logger := &testSingerLogger{}
+	state := &State{Streams: map[string]ShardStates{}}
+	sources := []NamedSource{
+		{Name: "hr", PlanetScaleSource: PlanetScaleSource{Database: "employees"}},
+		{Name: "billing", PlanetScaleSource: PlanetScaleSource{Database: "billing"}},
+	}
+	catalogs := map[string]Catalog{
+		"hr":      NamespaceCatalog("hr", Catalog{Streams: []Stream{getSourceStream("users", true)}}),
+		"billing": NamespaceCatalog("billing", Catalog{Streams: []Stream{getSourceStream("users", true)}}),
+	}
+
+	for _, source := range sources {
+		_, err := Sync(context.Background(), tma, ped, logger, source.PlanetScaleSource, catalogs[source.Name], state.Sources[source.Name],
+			NewSourceStateWriter(logger, state, source.Name), SyncSettings{})
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, []string{"employees.users", "billing.users"}, tables)
+	lastState := logger.state[len(logger.state)-1]
+	require.Len(t, lastState.Sources, 2)
+	assert.Contains(t, lastState.Sources["hr"].Streams, "hr_users")
+	assert.Contains(t, lastState.Sources["billing"].Streams, "billing_users")
+
+	cursor, err := lastState.Sources["billing"].Streams["billing_users"].Shards["-"].SerializedCursorToTableCursor()
+	require.NoError(t, err)
+	assert.Equal(t, "billing", cursor.Keyspace)
+
+	// the state of all sources can be resumed from.
+	b, err := json.Marshal(lastState)
+	require.NoError(t, err)
+	resumed, err := parseSavedStateContents(b)
+	require.NoError(t, err)
+	assert.Len(t, resumed.Sources, 2)
+}
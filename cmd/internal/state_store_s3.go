@@ -0,0 +1,278 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/pkg/errors"
+)
+
+// S3StateSettings configures where an S3StateStore keeps checkpoints.
+// Credentials are read from the AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment variables.
+type S3StateSettings struct {
+	Bucket string
+	// Prefix is prepended to the keys of all objects written by the store.
+	Prefix string
+	// Endpoint is the URL of an S3-compatible service, defaults to AWS S3 in Region.
+	Endpoint string
+	// Region defaults to the AWS_REGION environment variable, or us-east-1 if that is not set.
+	Region      string
+	Credentials aws.Credentials
+}
+
+// S3StateStore keeps checkpoints as state-<id>.json objects in an S3-compatible bucket.
+// Locks are taken with conditional writes, which the service must support.
+type S3StateStore struct {
+	settings S3StateSettings
+	endpoint *url.URL
+	client   *http.Client
+	signer   *v4.Signer
+	ids      checkpointIDs
+}
+
+func NewS3StateStore(settings S3StateSettings) (*S3StateStore, error) {
+	if len(settings.Bucket) == 0 {
+		return nil, errors.New("s3 state location requires a bucket")
+	}
+	if len(settings.Region) == 0 {
+		settings.Region = os.Getenv("AWS_REGION")
+	}
+	if len(settings.Region) == 0 {
+		settings.Region = "us-east-1"
+	}
+	if len(settings.Endpoint) == 0 {
+		settings.Endpoint = fmt.Sprintf("https://s3.%v.amazonaws.com", settings.Region)
+	}
+	if len(settings.Credentials.AccessKeyID) == 0 {
+		settings.Credentials = aws.Credentials{
+			AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		}
+	}
+
+	endpoint, err := url.Parse(settings.Endpoint)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid s3 endpoint")
+	}
+
+	return &S3StateStore{
+		settings: settings,
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: time.Minute},
+		signer:   v4.NewSigner(),
+	}, nil
+}
+
+func (s *S3StateStore) String() string {
+	return fmt.Sprintf("s3://%v/%v", s.settings.Bucket, s.settings.Prefix)
+}
+
+func (s *S3StateStore) key(name string) string {
+	return path.Join(s.settings.Prefix, name)
+}
+
+func (s *S3StateStore) checkpointKey(id string) string {
+	return s.key(fmt.Sprintf("state-%v.json", id))
+}
+
+func (s *S3StateStore) Lock(ctx context.Context) error {
+	contents, err := json.Marshal(newStateLock())
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.do(ctx, http.MethodPut, s.key(".lock"), nil, contents, map[string]string{"If-None-Match": "*"})
+	if err != nil {
+		return errors.Wrap(err, "unable to lock state")
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusPreconditionFailed, http.StatusConflict:
+		holder, _ := s.get(ctx, s.key(".lock"))
+		return lockedError(s.String(), holder, fmt.Sprintf("delete %v", s.key(".lock")))
+	default:
+		return s.responseError(resp, "unable to lock state")
+	}
+}
+
+func (s *S3StateStore) Unlock(ctx context.Context) error {
+	return s.delete(ctx, s.key(".lock"))
+}
+
+func (s *S3StateStore) Close() error {
+	return nil
+}
+
+func (s *S3StateStore) Save(ctx context.Context, state State) (Checkpoint, error) {
+	contents, err := json.Marshal(state)
+	if err != nil {
+		return Checkpoint{}, err
+	}
+
+	checkpoints, err := s.Checkpoints(ctx)
+	if err != nil {
+		return Checkpoint{}, err
+	}
+	cp := s.ids.next(latestCheckpointMillis(checkpoints))
+
+	// objects are only visible once they are completely written.
+	resp, err := s.do(ctx, http.MethodPut, s.checkpointKey(cp.ID), nil, contents, map[string]string{"Content-Type": "application/json"})
+	if err != nil {
+		return Checkpoint{}, errors.Wrap(err, "unable to save state")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Checkpoint{}, s.responseError(resp, "unable to save state")
+	}
+	return cp, nil
+}
+
+func (s *S3StateStore) Load(ctx context.Context, id string) (*State, error) {
+	key := s.checkpointKey(id)
+	contents, err := s.get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if contents == nil {
+		return nil, errors.Wrapf(ErrCheckpointNotFound, "no checkpoint %v in %v", id, s)
+	}
+	return decodeState(contents, key)
+}
+
+func (s *S3StateStore) Checkpoints(ctx context.Context) ([]Checkpoint, error) {
+	prefix := s.key("state-")
+	var (
+		checkpoints       []Checkpoint
+		continuationToken string
+	)
+	for {
+		query := url.Values{}
+		query.Set("list-type", "2")
+		query.Set("prefix", prefix)
+		if len(continuationToken) > 0 {
+			query.Set("continuation-token", continuationToken)
+		}
+
+		resp, err := s.do(ctx, http.MethodGet, "", query, nil, nil)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to list checkpoints")
+		}
+		if resp.StatusCode != http.StatusOK {
+			err := s.responseError(resp, "unable to list checkpoints")
+			resp.Body.Close()
+			return nil, err
+		}
+
+		var result struct {
+			Contents []struct {
+				Key string `xml:"Key"`
+			} `xml:"Contents"`
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to parse checkpoints")
+		}
+
+		for _, object := range result.Contents {
+			id := strings.TrimSuffix(strings.TrimPrefix(object.Key, prefix), ".json")
+			if cp, ok := parseCheckpointID(id); ok && strings.HasSuffix(object.Key, ".json") {
+				checkpoints = append(checkpoints, cp)
+			}
+		}
+		if !result.IsTruncated {
+			break
+		}
+		continuationToken = result.NextContinuationToken
+	}
+
+	sortCheckpoints(checkpoints)
+	return checkpoints, nil
+}
+
+func (s *S3StateStore) Delete(ctx context.Context, id string) error {
+	return s.delete(ctx, s.checkpointKey(id))
+}
+
+// get returns the contents of an object, or nil if it does not exist.
+func (s *S3StateStore) get(ctx context.Context, key string) ([]byte, error) {
+	resp, err := s.do(ctx, http.MethodGet, key, nil, nil, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to read %v", key)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return io.ReadAll(resp.Body)
+	case http.StatusNotFound:
+		return nil, nil
+	default:
+		return nil, s.responseError(resp, fmt.Sprintf("unable to read %v", key))
+	}
+}
+
+func (s *S3StateStore) delete(ctx context.Context, key string) error {
+	resp, err := s.do(ctx, http.MethodDelete, key, nil, nil, nil)
+	if err != nil {
+		return errors.Wrapf(err, "unable to delete %v", key)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return s.responseError(resp, fmt.Sprintf("unable to delete %v", key))
+	}
+	return nil
+}
+
+// do sends a signed request for an object in the bucket, or for the bucket itself if key is empty.
+func (s *S3StateStore) do(ctx context.Context, method, key string, query url.Values, body []byte, headers map[string]string) (*http.Response, error) {
+	u := *s.endpoint
+	u.Path = "/" + s.settings.Bucket
+	if len(key) > 0 {
+		u.Path += "/" + key
+	}
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	sum := sha256.Sum256(body)
+	payloadHash := hex.EncodeToString(sum[:])
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if err := s.signer.SignHTTP(ctx, s.settings.Credentials, req, payloadHash, "s3", s.settings.Region, time.Now()); err != nil {
+		return nil, errors.Wrap(err, "unable to sign request")
+	}
+
+	return s.client.Do(req)
+}
+
+func (s *S3StateStore) responseError(resp *http.Response, message string) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	return fmt.Errorf("%v: server responded with %v: %s", message, resp.Status, body)
+}
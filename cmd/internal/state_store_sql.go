@@ -0,0 +1,182 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/pkg/errors"
+)
+
+const DefaultStateTable = "singer_tap_state"
+
+// SQLStateStore keeps checkpoints as rows of a table in a MySQL compatible database,
+// which is created when the store is locked if it does not exist. Locks are taken with GET_LOCK,
+// so they are released automatically if the run holding them exits.
+type SQLStateStore struct {
+	db    *sql.DB
+	table string
+	// lockConn is the connection that holds the lock, the lock is released when it is closed.
+	lockConn *sql.Conn
+	ids      checkpointIDs
+}
+
+// NewSQLStateStore opens a state store for a go-sql-driver/mysql DSN,
+// the table to use is set with a table parameter, for example user:password@tcp(host:3306)/database?table=orders_state.
+func NewSQLStateStore(dsn string) (*SQLStateStore, error) {
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid mysql state location")
+	}
+
+	table := DefaultStateTable
+	if t, ok := cfg.Params["table"]; ok {
+		table = t
+		delete(cfg.Params, "table")
+	}
+
+	db, err := sql.Open("mysql", cfg.FormatDSN())
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to open mysql state location")
+	}
+	return &SQLStateStore{db: db, table: table}, nil
+}
+
+func (s *SQLStateStore) String() string {
+	return fmt.Sprintf("mysql table %v", s.table)
+}
+
+func (s *SQLStateStore) lockName() string {
+	return "singer-tap-state:" + s.table
+}
+
+func (s *SQLStateStore) createTable(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf("create table if not exists %v ("+
+		"id bigint not null primary key, "+
+		"state longtext not null, "+
+		"saved_at timestamp(3) not null)", quoteIdentifier(s.table)))
+	if err != nil {
+		return errors.Wrapf(err, "unable to create state table %v", s.table)
+	}
+	return nil
+}
+
+func (s *SQLStateStore) Lock(ctx context.Context) error {
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return errors.Wrap(err, "unable to lock state")
+	}
+
+	var acquired sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "select get_lock(?, 0)", s.lockName()).Scan(&acquired); err != nil {
+		conn.Close()
+		return errors.Wrap(err, "unable to lock state")
+	}
+	if acquired.Int64 != 1 {
+		var holder sql.NullInt64
+		_ = conn.QueryRowContext(ctx, "select is_used_lock(?)", s.lockName()).Scan(&holder)
+		conn.Close()
+		return errors.Wrapf(ErrStateLocked, "state in %v is locked by mysql connection %v", s, holder.Int64)
+	}
+
+	s.lockConn = conn
+	// every run locks the store before it is used, so the table only needs to be created here.
+	if err := s.createTable(ctx); err != nil {
+		s.Unlock(ctx)
+		return err
+	}
+	return nil
+}
+
+func (s *SQLStateStore) Unlock(ctx context.Context) error {
+	if s.lockConn == nil {
+		return nil
+	}
+	defer func() {
+		s.lockConn.Close()
+		s.lockConn = nil
+	}()
+	if _, err := s.lockConn.ExecContext(ctx, "select release_lock(?)", s.lockName()); err != nil {
+		return errors.Wrap(err, "unable to unlock state")
+	}
+	return nil
+}
+
+// Close releases the lock, if it is held, and closes the connections to the database.
+func (s *SQLStateStore) Close() error {
+	if s.lockConn != nil {
+		s.lockConn.Close()
+		s.lockConn = nil
+	}
+	return s.db.Close()
+}
+
+func (s *SQLStateStore) Save(ctx context.Context, state State) (Checkpoint, error) {
+	contents, err := json.Marshal(state)
+	if err != nil {
+		return Checkpoint{}, err
+	}
+
+	var latest sql.NullInt64
+	if err := s.db.QueryRowContext(ctx, fmt.Sprintf("select max(id) from %v", quoteIdentifier(s.table))).Scan(&latest); err != nil {
+		return Checkpoint{}, errors.Wrap(err, "unable to save state")
+	}
+	cp := s.ids.next(latest.Int64)
+
+	if _, err := s.db.ExecContext(ctx, fmt.Sprintf("insert into %v (id, state, saved_at) values (?, ?, ?)", quoteIdentifier(s.table)),
+		cp.SavedAt.UnixMilli(), string(contents), cp.SavedAt.UTC()); err != nil {
+		return Checkpoint{}, errors.Wrap(err, "unable to save state")
+	}
+	return cp, nil
+}
+
+func (s *SQLStateStore) Load(ctx context.Context, id string) (*State, error) {
+	cp, ok := parseCheckpointID(id)
+	if !ok {
+		return nil, errors.Wrapf(ErrCheckpointNotFound, "no checkpoint %v in %v", id, s)
+	}
+
+	var contents string
+	err := s.db.QueryRowContext(ctx, fmt.Sprintf("select state from %v where id = ?", quoteIdentifier(s.table)), cp.SavedAt.UnixMilli()).Scan(&contents)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errors.Wrapf(ErrCheckpointNotFound, "no checkpoint %v in %v", id, s)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to read checkpoint %v", id)
+	}
+	return decodeState([]byte(contents), fmt.Sprintf("%v, checkpoint %v", s, id))
+}
+
+func (s *SQLStateStore) Checkpoints(ctx context.Context) ([]Checkpoint, error) {
+
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf("select id from %v order by id", quoteIdentifier(s.table)))
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to list checkpoints")
+	}
+	defer rows.Close()
+
+	var checkpoints []Checkpoint
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, errors.Wrap(err, "unable to list checkpoints")
+		}
+		if cp, ok := parseCheckpointID(id); ok {
+			checkpoints = append(checkpoints, cp)
+		}
+	}
+	return checkpoints, rows.Err()
+}
+
+func (s *SQLStateStore) Delete(ctx context.Context, id string) error {
+	cp, ok := parseCheckpointID(id)
+	if !ok {
+		return nil
+	}
+	if _, err := s.db.ExecContext(ctx, fmt.Sprintf("delete from %v where id = ?", quoteIdentifier(s.table)), cp.SavedAt.UnixMilli()); err != nil {
+		return errors.Wrapf(err, "unable to delete checkpoint %v", id)
+	}
+	return nil
+}
@@ -3,36 +3,143 @@ package internal
 import (
 	"context"
 	"fmt"
+	"log/slog"
+	"sort"
 	"strings"
+	"time"
 
 	psdbconnect "github.com/planetscale/airbyte-source/proto/psdbconnect/v1alpha1"
 
+	"vitess.io/vitess/go/mysql"
 	"vitess.io/vitess/go/sqltypes"
 
 	"github.com/pkg/errors"
 )
 
-func Sync(ctx context.Context, mysqlDatabase PlanetScaleEdgeMysqlAccess, edgeDatabase PlanetScaleDatabase, logger Logger, source PlanetScaleSource, catalog Catalog, state *State, recordWriter RecordWriter, tabletType psdbconnect.TabletType) error {
+// SyncSettings configures how streams are read during a sync operation.
+type SyncSettings struct {
+	// TabletType is the type of tablet to read rows from, if the source has no tablet types.
+	TabletType psdbconnect.TabletType
+	// Route is the tablets to read rows from, they are picked with RouteTablets if nil.
+	Route *TabletRoute
+	// MaxReplicaLag is the most that replica and rdonly tablets may be behind their primary
+	// for a shard to be read from them, replication lag is not checked if zero.
+	MaxReplicaLag time.Duration
+	// ReplicaLagWait is how long to wait for replication lag to drop below MaxReplicaLag before giving up on a shard.
+	ReplicaLagWait time.Duration
+	// ReplicaLagFallback reads a shard from its primary tablet if the replication lag does not drop in time,
+	// instead of failing.
+	ReplicaLagFallback bool
+	// CheckpointRows is the number of rows after which the state of an incrementally synced stream
+	// is emitted while it is being read, state is only emitted after every shard if zero.
+	CheckpointRows int
+	// CheckpointInterval is how often the state of an incrementally synced stream
+	// is emitted while it is being read, state is only emitted after every shard if zero.
+	CheckpointInterval time.Duration
+	// StreamOrder is the order in which selected streams are synced, after the stream that was
+	// being synced when the previous run stopped, and by sync-priority. It is one of
+	// StreamOrderCatalog, StreamOrderSmallestFirst or a comma separated list of stream names.
+	StreamOrder string
+	// ConsistentSnapshot reads every stream up to the position the shards were at when the sync started,
+	// instead of the latest position when the stream is read.
+	ConsistentSnapshot bool
+	// Continuous keeps reading changes to incrementally synced streams once they have caught up,
+	// until the context is canceled.
+	Continuous bool
+	// HeartbeatInterval is how often state is emitted while reading continuously and no state was emitted otherwise.
+	HeartbeatInterval time.Duration
+	// Health is updated with the progress of the sync, if set.
+	Health *Health
+	// StartFrom is where incrementally synced streams without state start reading from,
+	// unless set in the stream's metadata. Defaults to StartFromBeginning.
+	StartFrom string
+	// CopyChunks is the number of key ranges the initial copy of incrementally synced tables is split into,
+	// unless set in the stream's metadata. Tables are copied in one piece if less than 2.
+	CopyChunks int
+	// Resnapshot is the names of incrementally synced streams whose rows are copied again,
+	// interleaved with reading their changes.
+	Resnapshot []string
+	// PrimaryMysql selects rows from the primary tablet once replication lag made a shard fall back to it,
+	// rows are selected with the connection Sync is given if nil.
+	PrimaryMysql PlanetScaleEdgeMysqlAccess
+	// Throttle limits how fast rows that are selected with SQL are read, as it does for rows that are streamed.
+	// Selected rows are not limited if nil.
+	Throttle *Throttle
+}
+
+const (
+	// StreamOrderCatalog syncs streams in the order they appear in the catalog.
+	StreamOrderCatalog = "catalog"
+	// StreamOrderSmallestFirst syncs streams with the smallest row-count first,
+	// streams without a row-count are synced last.
+	StreamOrderSmallestFirst = "smallest-first"
+)
+
+const (
+	// StartFromBeginning copies all rows in a table before reading changes to it.
+	StartFromBeginning = "beginning"
+	// StartFromNow only reads changes made after the sync starts.
+	StartFromNow = "now"
+	// StartFromPosition only reads changes made after the positions in start-positions.
+	StartFromPosition = "position"
+)
+
+// checkpointDue reports whether the state of a stream should be emitted,
+// given the rows read and time passed since it was last emitted.
+func (s SyncSettings) checkpointDue(rows int, since time.Duration) bool {
+	return (s.CheckpointRows > 0 && rows >= s.CheckpointRows) ||
+		(s.CheckpointInterval > 0 && rows > 0 && since >= s.CheckpointInterval)
+}
+
+// Sync reads all selected streams in the catalog, starting at the given state,
+// and returns a report of what was read from every stream, even if the sync failed.
+func Sync(ctx context.Context, mysqlDatabase PlanetScaleEdgeMysqlAccess, edgeDatabase PlanetScaleDatabase, logger Logger, source PlanetScaleSource, catalog Catalog, state *State, recordWriter RecordWriter, settings SyncSettings) (*SyncReport, error) {
+	report := NewSyncReport()
+	err := syncStreams(ctx, mysqlDatabase, edgeDatabase, logger, source, catalog, state, recordWriter, settings, report)
+	report.Finish(err)
+	settings.Health.stop(err)
+	return report, err
+}
+
+func syncStreams(ctx context.Context, mysqlDatabase PlanetScaleEdgeMysqlAccess, edgeDatabase PlanetScaleDatabase, logger Logger, source PlanetScaleSource, catalog Catalog, state *State, recordWriter RecordWriter, settings SyncSettings, report *SyncReport) error {
+	// Validate filter expressions before reading any rows, so that a bad expression fails fast.
+	filters, err := newRowFilters(catalog)
+	if err != nil {
+		return err
+	}
+
 	// The schema as its stored by Stitch needs to be filtered before it can be synced by the tap.
 	filteredSchema, err := filterSchema(catalog)
 	if err != nil {
 		return errors.Wrap(err, "unable to filter schema")
 	}
 
-	// get the list of vitess shards so we can generate the empty state for a sync operation.
-	shards, err := mysqlDatabase.GetVitessShards(ctx, source)
+	transformers, err := newRecordTransformers(filteredSchema)
 	if err != nil {
 		return err
 	}
 
-	tablets, err := mysqlDatabase.GetVitessTablets(ctx, source)
+	// get the list of vitess shards so we can generate the empty state for a sync operation.
+	shards, err := mysqlDatabase.GetVitessShards(ctx, source)
 	if err != nil {
 		return err
 	}
 
-	cells, err := findSuitableCells(tabletType, tablets)
-	if err != nil {
-		return err
+	route := settings.Route
+	if route == nil {
+		r, err := RouteTablets(ctx, mysqlDatabase, source, settings.TabletType)
+		if err != nil {
+			return err
+		}
+		route = &r
+	}
+	lagGuard := &replicaLagGuard{
+		mysqlDatabase: mysqlDatabase,
+		primaryMysql:  settings.PrimaryMysql,
+		logger:        logger,
+		source:        source,
+		settings:      settings,
+		route:         *route,
 	}
 
 	// not all streams in a schema might need to be incrementally synced,
@@ -43,6 +150,23 @@ func Sync(ctx context.Context, mysqlDatabase PlanetScaleEdgeMysqlAccess, edgeDat
 		return errors.New("unable to generate empty state")
 	}
 
+	// incrementally synced streams without state might not start at the beginning.
+	for _, stream := range filteredSchema.Streams {
+		if !stream.IncrementalSyncRequested() {
+			continue
+		}
+		if state != nil {
+			if _, ok := state.Streams[stream.Name]; ok {
+				continue
+			}
+		}
+		initialState, err := startState(ctx, edgeDatabase, source, stream, beginningState.Streams[stream.Name], settings.StartFrom, lagGuard)
+		if err != nil {
+			return err
+		}
+		beginningState.Streams[stream.Name] = initialState
+	}
+
 	// if there is existing state, ensure that all selected tables
 	// have valid state.
 	if state != nil && len(state.Streams) > 0 {
@@ -56,17 +180,72 @@ func Sync(ctx context.Context, mysqlDatabase PlanetScaleEdgeMysqlAccess, edgeDat
 		// if there is no last known state, start from the beginning.
 		state = beginningState
 	}
+
+	streams, err := orderStreams(filteredSchema.Streams, settings.StreamOrder, state.CurrentlySyncing)
+	if err != nil {
+		return err
+	}
+
+	if err := requestResnapshots(state, streams, settings.Resnapshot); err != nil {
+		return err
+	}
+	// re-snapshots read changes past the position of a consistent snapshot.
+	if settings.ConsistentSnapshot && len(state.Resnapshots) > 0 {
+		return errors.New("streams cannot be re-snapshotted in a sync with a consistent snapshot")
+	}
+	// chunked copies read changes up to the current position of every shard once all chunks are copied.
+	if settings.ConsistentSnapshot {
+		for _, stream := range streams {
+			if stream.IncrementalSyncRequested() && (state.Copies[stream.Name] != nil || shouldCopyInChunks(stream, state.Streams[stream.Name].Shards, settings)) {
+				return errors.Errorf("stream %v cannot be copied in chunks in a sync with a consistent snapshot", stream.Name)
+			}
+		}
+	}
+
+	if settings.ConsistentSnapshot && len(streams) > 0 {
+		// an interrupted sync finishes at the snapshot it started with.
+		if state.Snapshot == nil || len(state.CurrentlySyncing) == 0 {
+			state.Snapshot, err = takeSnapshot(ctx, edgeDatabase, source, streams[0], shards, lagGuard)
+			if err != nil {
+				return err
+			}
+		}
+		logger.Info("reading all streams up to a consistent snapshot", slog.Any("snapshot", state.Snapshot.Shards))
+		report.Snapshot = state.Snapshot
+	} else {
+		state.Snapshot = nil
+	}
+
 	// For every stream processed by this loop, across all selected shards, we output the following messages
 	// ONE message of type SCHEMA with the schema of the stream that is being synced.
 	// MANY messages of type RECORD, one per row in the database for this stream.
 	// ONE-MANY messages of type STATE, which record the current state of the stream.
-	for _, stream := range filteredSchema.Streams {
+	for _, stream := range streams {
+		// Record the stream being synced, so that an interrupted sync resumes from it.
+		state.CurrentlySyncing = stream.Name
 		// The first message before outputting any records for a stream
 		// should always be a SCHEMA message with the schema of the stream.
-		logger.StreamSchema(stream)
+		transformer := transformers[stream.Name]
+		emittedStream := transformer.Schema(stream)
+		logger.StreamSchema(emittedStream)
+		streamReport := report.AddStream(stream.Name)
+		filter := filters[stream.Name]
+		if stream.selectRequired() {
+			selectMysql, err := lagGuard.selectDatabase(ctx, shards)
+			if err != nil {
+				return err
+			}
+			if err := selectTable(ctx, selectMysql, logger, source, stream, filter, transformer, recordWriter, streamReport, settings.Throttle); err != nil {
+				return err
+			}
+			if err := recordWriter.State(*state); err != nil {
+				return errors.Wrap(err, "unable to serialize state")
+			}
+			continue
+		}
 		var streamShardStates map[string]*SerializedCursor
 		if stream.IncrementalSyncRequested() {
-			logger.Info(fmt.Sprintf("Stream %q will be synced incrementally", stream.Name))
+			logger.Info("stream will be synced incrementally", slog.String(StreamKey, stream.Name))
 			// Use the last known state of the stream if it exists.
 			if existingState, ok := state.Streams[stream.Name]; ok {
 				streamShardStates = existingState.Shards
@@ -82,21 +261,62 @@ func Sync(ctx context.Context, mysqlDatabase PlanetScaleEdgeMysqlAccess, edgeDat
 			streamShardStates = beginningState.Streams[stream.Name].Shards
 		}
 
+		if stream.IncrementalSyncRequested() && (state.Copies[stream.Name] != nil || shouldCopyInChunks(stream, streamShardStates, settings)) {
+			selectMysql, err := lagGuard.selectDatabase(ctx, shards)
+			if err != nil {
+				return err
+			}
+			if err := copyTable(ctx, selectMysql, edgeDatabase, logger, source, stream, filter, transformer, state, recordWriter, settings, streamReport, lagGuard); err != nil {
+				return err
+			}
+			streamShardStates = state.Streams[stream.Name].Shards
+		}
+
+		if stream.IncrementalSyncRequested() && state.Resnapshots[stream.Name] != nil {
+			selectMysql, err := lagGuard.selectDatabase(ctx, shards)
+			if err != nil {
+				return err
+			}
+			if err := resnapshotTable(ctx, selectMysql, edgeDatabase, logger, source, stream, filter, transformer, state, recordWriter, streamReport, settings.Throttle, lagGuard); err != nil {
+				return err
+			}
+			streamShardStates = state.Streams[stream.Name].Shards
+		}
+
 		for shard, cursor := range streamShardStates {
 			tc, err := cursor.SerializedCursorToTableCursor()
 			if err != nil {
 				return err
 			}
 
-			logger.Info(fmt.Sprintf("syncing rows from stream %q from shard %q at position [%v]", stream.Name, shard, tc.Position))
-			if len(tc.Position) > 0 {
-				logger.Info(fmt.Sprintf("stream's known position is %q", tc.Position))
-			}
+			shardRoute, lag, lagErr := lagGuard.check(ctx, shard)
+
+			logger.Info("syncing rows from stream",
+				slog.String(StreamKey, stream.Name),
+				slog.String(ShardKey, shard),
+				slog.String(TabletTypeKey, shardRoute.TabletType.String()),
+				slog.String(PositionKey, tc.Position),
+			)
 
+			shardReport := streamReport.AddShard(shard, tc.Position)
+			shardReport.TabletType = TabletTypeToString(shardRoute.TabletType)
+			if lag >= 0 {
+				shardReport.ReplicaLagSeconds = &lag
+			}
+			if lagErr != nil {
+				shardReport.Finish(tc.Position, lagErr)
+				return lagErr
+			}
+			lastPosition := tc.Position
 			needsFlush := true
+			rowsSinceCheckpoint := 0
+			lastCheckpoint := time.Now()
 			onResult := func(sqlResult *sqltypes.Result) error {
 				needsFlush = true
-				return printQueryResult(sqlResult, stream, recordWriter)
+				rowsSinceCheckpoint += len(sqlResult.Rows)
+				emitted, err := printQueryResult(sqlResult, stream, emittedStream, filter, transformer, recordWriter)
+				streamReport.AddRows(shardReport, emitted, len(sqlResult.Rows)-emitted)
+				return err
 			}
 
 			onCursor := func(cursor *psdbconnect.TableCursor) error {
@@ -104,36 +324,78 @@ func Sync(ctx context.Context, mysqlDatabase PlanetScaleEdgeMysqlAccess, edgeDat
 				if err != nil {
 					return err
 				}
+				lastPosition = cursor.Position
 				state.Streams[stream.Name].Shards[shard] = sc
 
+				// the state of streams that are not synced incrementally is never resumed from.
+				if stream.IncrementalSyncRequested() && settings.checkpointDue(rowsSinceCheckpoint, time.Since(lastCheckpoint)) {
+					// records must be flushed before the state that includes them is emitted,
+					// so that a sync that resumes from this state does not skip any rows.
+					if err := recordWriter.Flush(emittedStream); err != nil {
+						return errors.Wrap(err, "unable to flush records")
+					}
+					if err := recordWriter.State(*state); err != nil {
+						return errors.Wrap(err, "unable to serialize state")
+					}
+					logger.Debug("emitted state checkpoint",
+						slog.String(StreamKey, stream.Name),
+						slog.String(ShardKey, shard),
+						slog.Int("rows", rowsSinceCheckpoint),
+					)
+					shardReport.Checkpoints++
+					rowsSinceCheckpoint = 0
+					lastCheckpoint = time.Now()
+					return nil
+				}
+
 				if needsFlush {
-					return recordWriter.Flush(stream)
+					return recordWriter.Flush(emittedStream)
 				}
 
 				return nil
 			}
 
-			newCursor, err := edgeDatabase.Read(ctx, ReadParams{
+			readCtx, span := startSpan(ctx, "Sync.stream",
+				streamAttribute.String(stream.Name),
+				shardAttribute.String(shard),
+				tabletTypeAttribute.String(shardRoute.TabletType.String()),
+			)
+			newCursor, err := edgeDatabase.Read(readCtx, ReadParams{
 				Source:            source,
 				Table:             stream,
 				LastKnownPosition: tc,
-				Columns:           stream.Metadata.GetSelectedProperties(),
+				Columns:           readColumns(stream, filter),
 				OnCursor:          onCursor,
 				OnResult:          onResult,
-				TabletType:        tabletType,
-				Cells:             cells,
+				OnOutcome: func(outcome ReadOutcome) {
+					shardReport.Status = outcome.Status
+					shardReport.Reason = outcome.Reason
+				},
+				TabletType:   shardRoute.TabletType,
+				Cells:        shardRoute.Cells,
+				StopPosition: state.Snapshot.position(shard),
 			})
+			endSpan(span, err)
 			if err != nil {
+				shardReport.Finish(lastPosition, err)
 				return err
 			}
 
-			if err := recordWriter.Flush(stream); err != nil {
+			if err := recordWriter.Flush(emittedStream); err != nil {
+				shardReport.Finish(lastPosition, err)
 				return errors.Wrap(err, "unable to flush records")
 			}
 
 			if newCursor == nil {
-				return errors.New("should return valid cursor, got nil")
+				err := errors.New("should return valid cursor, got nil")
+				shardReport.Finish(lastPosition, err)
+				return err
+			}
+
+			if ntc, err := newCursor.SerializedCursorToTableCursor(); err == nil {
+				lastPosition = ntc.Position
 			}
+			shardReport.Finish(lastPosition, nil)
 
 			state.Streams[stream.Name].Shards[shard] = newCursor
 
@@ -143,32 +405,255 @@ func Sync(ctx context.Context, mysqlDatabase PlanetScaleEdgeMysqlAccess, edgeDat
 		}
 	}
 
+	if settings.Continuous {
+		tail := &streamTail{
+			edgeDatabase: edgeDatabase,
+			logger:       logger,
+			source:       source,
+			filters:      filters,
+			transformers: transformers,
+			recordWriter: recordWriter,
+			settings:     settings,
+			lagGuard:     lagGuard,
+			state:        state,
+			report:       report,
+		}
+		if err := tail.run(ctx, streams); err != nil {
+			return err
+		}
+	}
+
+	state.CurrentlySyncing = ""
 	return recordWriter.State(*state)
 }
 
-func printQueryResult(qr *sqltypes.Result, s Stream, recordWriter RecordWriter) error {
-	data := QueryResultToRecords(qr)
-	for _, datum := range data {
-		subset := map[string]interface{}{}
-		for _, selectedProperty := range s.Metadata.GetSelectedProperties() {
-			streamProperty := s.Schema.Properties[selectedProperty]
-			subset[selectedProperty] = datum[selectedProperty]
-			val, err := Convert(streamProperty, datum[selectedProperty].(sqltypes.Value))
+// startState returns the state a stream without state starts reading from,
+// given its state when starting at the beginning.
+func startState(ctx context.Context, edgeDatabase PlanetScaleDatabase, source PlanetScaleSource, stream Stream, beginning ShardStates, defaultStartFrom string, lagGuard *replicaLagGuard) (ShardStates, error) {
+	tm := streamMetadata(stream)
+	startFrom := tm.StartFrom
+	if len(startFrom) == 0 {
+		startFrom = defaultStartFrom
+	}
+
+	var positionOf func(shard string) (string, error)
+	switch startFrom {
+	case "", StartFromBeginning:
+		return beginning, nil
+	case StartFromNow:
+		positionOf = func(shard string) (string, error) {
+			route, _, err := lagGuard.check(ctx, shard)
 			if err != nil {
-				return errors.Wrapf(err, "unable to serialize [%v] as [%v]", datum[selectedProperty], s.Schema.Properties[selectedProperty].Types)
+				return "", err
+			}
+			position, err := edgeDatabase.LatestPosition(ctx, ReadParams{
+				Source:            source,
+				Table:             stream,
+				LastKnownPosition: &psdbconnect.TableCursor{Shard: shard, Keyspace: source.Database},
+				TabletType:        route.TabletType,
+				Cells:             route.Cells,
+			})
+			if err != nil {
+				return "", errors.Wrapf(err, "unable to get current position of shard %v for stream %v", shard, stream.Name)
+			}
+			if len(position) == 0 {
+				return "", errors.Errorf("unable to get current position of shard %v for stream %v", shard, stream.Name)
+			}
+			return position, nil
+		}
+	case StartFromPosition:
+		positionOf = func(shard string) (string, error) {
+			position, ok := tm.StartPositions[shard]
+			if !ok {
+				return "", errors.Errorf("stream %v starts from a position, but start-positions has no position for shard %v", stream.Name, shard)
+			}
+			if _, err := mysql.DecodePosition(position); err != nil {
+				return "", errors.Wrapf(err, "invalid start position %q for shard %v of stream %v", position, shard, stream.Name)
+			}
+			return position, nil
+		}
+	case "timestamp":
+		// Vitess cannot look up the GTID set of a shard at a given time.
+		return ShardStates{}, errors.Errorf("stream %v cannot start from a timestamp, use start-from %v with the positions recorded in a STATE message from around that time instead",
+			stream.Name, StartFromPosition)
+	default:
+		return ShardStates{}, errors.Errorf("unsupported start-from %q for stream %v, must be one of %v, %v or %v",
+			startFrom, stream.Name, StartFromBeginning, StartFromNow, StartFromPosition)
+	}
+
+	initialState := ShardStates{Shards: make(map[string]*SerializedCursor, len(beginning.Shards))}
+	for shard := range beginning.Shards {
+		position, err := positionOf(shard)
+		if err != nil {
+			return ShardStates{}, err
+		}
+		cursor, err := TableCursorToSerializedCursor(&psdbconnect.TableCursor{
+			Shard:    shard,
+			Keyspace: source.Database,
+			Position: position,
+		})
+		if err != nil {
+			return ShardStates{}, err
+		}
+		initialState.Shards[shard] = cursor
+	}
+	return initialState, nil
+}
+
+// takeSnapshot returns the current position of every shard, read through the given stream.
+func takeSnapshot(ctx context.Context, edgeDatabase PlanetScaleDatabase, source PlanetScaleSource, stream Stream, shards []string, lagGuard *replicaLagGuard) (*Snapshot, error) {
+	snapshot := &Snapshot{
+		Keyspace: source.Database,
+		Shards:   make(map[string]string, len(shards)),
+	}
+	for _, shard := range shards {
+		route, _, err := lagGuard.check(ctx, shard)
+		if err != nil {
+			return nil, err
+		}
+		position, err := edgeDatabase.LatestPosition(ctx, ReadParams{
+			Source:            source,
+			Table:             stream,
+			LastKnownPosition: &psdbconnect.TableCursor{Shard: shard, Keyspace: source.Database},
+			TabletType:        route.TabletType,
+			Cells:             route.Cells,
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to get position of shard %v for snapshot", shard)
+		}
+		if len(position) == 0 {
+			return nil, errors.Errorf("unable to get position of shard %v for snapshot", shard)
+		}
+		snapshot.Shards[shard] = position
+	}
+	return snapshot, nil
+}
+
+// position returns the position of a shard in the snapshot, or an empty string if there is no snapshot.
+func (s *Snapshot) position(shard string) string {
+	if s == nil {
+		return ""
+	}
+	return s.Shards[shard]
+}
+
+// orderStreams returns the streams in the order they should be synced:
+// the stream that was being synced when the previous run stopped,
+// then streams by descending sync-priority, then by the given order.
+func orderStreams(streams []Stream, order, currentlySyncing string) ([]Stream, error) {
+	rank := func(s Stream) int { return 0 }
+	switch order {
+	case "", StreamOrderCatalog:
+	case StreamOrderSmallestFirst:
+		rank = func(s Stream) int {
+			if rowCount := streamMetadata(s).RowCount; rowCount > 0 {
+				return 0
+			}
+			return 1
+		}
+	default:
+		positions := map[string]int{}
+		for i, name := range strings.Split(order, ",") {
+			positions[strings.TrimSpace(name)] = i
+		}
+		for name := range positions {
+			if !containsStream(streams, name) {
+				return nil, fmt.Errorf("stream %q in stream order is not a selected stream", name)
+			}
+		}
+		// streams that are not listed are synced after those that are.
+		rank = func(s Stream) int {
+			if position, ok := positions[s.Name]; ok {
+				return position
 			}
-			subset[selectedProperty] = val
+			return len(positions)
+		}
+	}
+
+	ordered := make([]Stream, len(streams))
+	copy(ordered, streams)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		a, b := ordered[i], ordered[j]
+		if (a.Name == currentlySyncing) != (b.Name == currentlySyncing) {
+			return a.Name == currentlySyncing
+		}
+		am, bm := streamMetadata(a), streamMetadata(b)
+		if am.SyncPriority != bm.SyncPriority {
+			return am.SyncPriority > bm.SyncPriority
+		}
+		if ra, rb := rank(a), rank(b); ra != rb {
+			return ra < rb
+		}
+		if order == StreamOrderSmallestFirst {
+			return am.RowCount < bm.RowCount
+		}
+		return false
+	})
+	return ordered, nil
+}
+
+func streamMetadata(s Stream) NodeMetadata {
+	tm, err := s.GetTableMetadata()
+	if err != nil {
+		return NodeMetadata{}
+	}
+	return tm.Metadata
+}
+
+func containsStream(streams []Stream, name string) bool {
+	for _, s := range streams {
+		if s.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// printQueryResult writes every row in the result that matches the filter as a transformed record
+// and returns the number of records that were written. Records are written with the emitted stream,
+// the stream as transformed by the transformer, so that their schema and keys match their data.
+func printQueryResult(qr *sqltypes.Result, s, emitted Stream, filter *RowFilter, transformer *RecordTransformer, recordWriter RecordWriter) (int, error) {
+	data := QueryResultToRecords(qr)
+	written := 0
+	for i, datum := range data {
+		match, err := filter.Match(qr.Fields, qr.Rows[i])
+		if err != nil {
+			return written, err
+		}
+		if !match {
+			continue
+		}
+
+		subset, err := recordData(datum, s)
+		if err != nil {
+			return written, err
 		}
 
 		record := NewRecord()
 		record.Stream = s.Name
-		record.Data = subset
-		if err := recordWriter.Record(record, s); err != nil {
-			return err
+		record.Data = transformer.Transform(subset)
+		if err := recordWriter.Record(record, emitted); err != nil {
+			return written, err
 		}
+		written++
 	}
 
-	return nil
+	return written, nil
+}
+
+// recordData converts the selected properties of a row
+// into their JSONSchema compatible representation.
+func recordData(datum map[string]interface{}, s Stream) (map[string]interface{}, error) {
+	subset := map[string]interface{}{}
+	for _, selectedProperty := range s.Metadata.GetSelectedProperties() {
+		streamProperty := s.Schema.Properties[selectedProperty]
+		val, err := Convert(streamProperty, datum[selectedProperty].(sqltypes.Value))
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to serialize [%v] as [%v]", datum[selectedProperty], s.Schema.Properties[selectedProperty].Types)
+		}
+		subset[selectedProperty] = val
+	}
+	return subset, nil
 }
 
 func generateEmptyState(source PlanetScaleSource, catalog Catalog, shards []string) *State {
@@ -233,23 +718,3 @@ func filterSchema(catalog Catalog) (Catalog, error) {
 	}
 	return filteredCatalog, nil
 }
-
-func findSuitableCells(tabletType psdbconnect.TabletType, tablets []VitessTablet) ([]string, error) {
-	s := "PRIMARY"
-	if tabletType == psdbconnect.TabletType_replica {
-		s = "REPLICA"
-	} else if tabletType == psdbconnect.TabletType_read_only {
-		s = "RDONLY"
-	}
-	var cells []string
-	for _, tablet := range tablets {
-		if strings.ToUpper(tablet.TabletType) == s {
-			cells = append(cells, tablet.Cell)
-		}
-	}
-
-	if len(cells) == 0 {
-		return nil, fmt.Errorf("unable to find any suitable tablets of type %q", s)
-	}
-	return cells, nil
-}
@@ -2,10 +2,15 @@ package internal
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"testing"
 
 	psdbconnect "github.com/planetscale/airbyte-source/proto/psdbconnect/v1alpha1"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"vitess.io/vitess/go/sqltypes"
 )
 
 func TestSync_CanFilterSchema(t *testing.T) {
@@ -47,7 +52,7 @@ func TestSync_CanFilterSchema(t *testing.T) {
 			},
 		},
 	}
-	err := Sync(context.Background(), tma, ped, logger, source, catalog, nil, logger, 0)
+	_, err := Sync(context.Background(), tma, ped, logger, source, catalog, nil, logger, SyncSettings{})
 	assert.Nil(t, err)
 	assert.Equal(t, []string{"employees"}, streamsRead, "should filter schema down to only selected tables.")
 }
@@ -98,7 +103,7 @@ func TestSync_CanStartFromEmptyState(t *testing.T) {
 		},
 	}
 
-	err := Sync(context.Background(), tma, ped, logger, source, catalog, nil, logger, 0)
+	_, err := Sync(context.Background(), tma, ped, logger, source, catalog, nil, logger, SyncSettings{})
 	assert.Nil(t, err)
 	assert.Equal(t, source.Database, cursor.Keyspace)
 	assert.Equal(t, "-", cursor.Shard)
@@ -157,7 +162,7 @@ func TestSync_PrintsStreamSchema(t *testing.T) {
 		},
 	}
 
-	err := Sync(context.Background(), tma, ped, logger, source, catalog, nil, logger, 0)
+	_, err := Sync(context.Background(), tma, ped, logger, source, catalog, nil, logger, SyncSettings{})
 	assert.Nil(t, err)
 	printedSchema := logger.streamSchemas["employees"]
 	assert.NotNil(t, printedSchema)
@@ -219,7 +224,7 @@ func TestSync_PrintsStreamState(t *testing.T) {
 		},
 	}
 
-	err := Sync(context.Background(), tma, ped, logger, source, catalog, nil, logger, 0)
+	_, err := Sync(context.Background(), tma, ped, logger, source, catalog, nil, logger, SyncSettings{})
 	assert.Nil(t, err)
 	assert.Len(t, logger.state, 2)
 	lastState := logger.state[1]
@@ -273,12 +278,12 @@ func TestSync_UsesStateIfIncrementalSyncRequested(t *testing.T) {
 		},
 	}
 
-	err = Sync(context.Background(), tma, ped, logger, source, catalog, &lastKnownState, logger, 0)
+	_, err = Sync(context.Background(), tma, ped, logger, source, catalog, &lastKnownState, logger, SyncSettings{})
 	assert.Nil(t, err)
 	assert.Equal(t, source.Database, cursor.Keyspace)
 	assert.Equal(t, "-", cursor.Shard)
 	assert.Equal(t, "i-know-what-you-synced-last-summer", cursor.Position)
-	assert.Equal(t, `Stream "employees" will be synced incrementally`, logger.logMessages[0])
+	assert.Equal(t, "stream will be synced incrementally", logger.logMessages[0])
 }
 
 func TestSync_UseOrCreateState(t *testing.T) {
@@ -341,12 +346,12 @@ func TestSync_UseOrCreateState(t *testing.T) {
 		},
 	}
 
-	err = Sync(context.Background(), tma, ped, logger, source, catalog, &lastKnownState, logger, 0)
+	_, err = Sync(context.Background(), tma, ped, logger, source, catalog, &lastKnownState, logger, SyncSettings{})
 	assert.Nil(t, err)
 	assert.Equal(t, source.Database, cursor.Keyspace)
 	assert.Equal(t, "-", cursor.Shard)
 	assert.Equal(t, "i-know-what-you-synced-last-summer", cursor.Position)
-	assert.Equal(t, `Stream "employees" will be synced incrementally`, logger.logMessages[0])
+	assert.Equal(t, "stream will be synced incrementally", logger.logMessages[0])
 }
 
 func TestSync_PrintsOldStateIfNoNewStateFound(t *testing.T) {
@@ -397,7 +402,7 @@ func TestSync_PrintsOldStateIfNoNewStateFound(t *testing.T) {
 		},
 	}
 
-	err = Sync(context.Background(), tma, ped, logger, source, catalog, &lastKnownState, logger, 0)
+	_, err = Sync(context.Background(), tma, ped, logger, source, catalog, &lastKnownState, logger, SyncSettings{})
 	assert.Nil(t, err)
 	assert.Equal(t, source.Database, cursor.Keyspace)
 	assert.Equal(t, "-", cursor.Shard)
@@ -467,7 +472,7 @@ func TestSync_PrintsNewStateIfFound(t *testing.T) {
 		},
 	}
 
-	err = Sync(context.Background(), tma, ped, logger, source, catalog, &lastKnownState, logger, 0)
+	_, err = Sync(context.Background(), tma, ped, logger, source, catalog, &lastKnownState, logger, SyncSettings{})
 	assert.Nil(t, err)
 	assert.Equal(t, source.Database, cursor.Keyspace)
 	assert.Equal(t, "-", cursor.Shard)
@@ -479,3 +484,389 @@ func TestSync_PrintsNewStateIfFound(t *testing.T) {
 
 	assert.Equal(t, newSC, lastState.Streams["employees"].Shards["-"])
 }
+
+func TestSync_ReportsRowsAndOutcomePerShard(t *testing.T) {
+	tma := getTestMysqlAccess()
+	ped := &testPlanetScaleEdgeDatabase{
+		ReadParamsFn: func(ctx context.Context, params ReadParams) (*SerializedCursor, error) {
+			qr := sqltypes.MakeTestResult(sqltypes.MakeTestFields("emp_no", "varchar"), "10001", "10002")
+			if err := params.OnResult(qr); err != nil {
+				return nil, err
+			}
+			params.OnOutcome(ReadOutcome{Status: ReadStatusInterrupted, Reason: "Canceled"})
+			return TableCursorToSerializedCursor(&psdbconnect.TableCursor{
+				Shard:    params.LastKnownPosition.Shard,
+				Keyspace: params.LastKnownPosition.Keyspace,
+				Position: "MySQL56/e42292e8-e28f-11ec-9c5b-d680f5d655b3:1-717",
+			})
+		},
+	}
+	logger := &testSingerLogger{}
+	source := PlanetScaleSource{
+		Database: "sync-test",
+	}
+	catalog := Catalog{
+		Streams: []Stream{
+			{
+				Name:      "employees",
+				TableName: "employees",
+				Schema: StreamSchema{
+					Properties: map[string]StreamProperty{
+						"emp_no": {Types: []string{"null", "string"}},
+					},
+				},
+				Metadata: MetadataCollection{
+					{
+						Metadata: NodeMetadata{
+							Selected:   true,
+							BreadCrumb: []string{},
+						},
+					},
+					{
+						Metadata: NodeMetadata{
+							Selected:   true,
+							BreadCrumb: []string{"properties", "emp_no"},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	report, err := Sync(context.Background(), tma, ped, logger, source, catalog, nil, logger, SyncSettings{})
+	assert.NoError(t, err)
+	assert.Empty(t, report.Error)
+	assert.Len(t, report.Streams, 1)
+	sr := report.Streams[0]
+	assert.Equal(t, "employees", sr.Stream)
+	assert.Equal(t, 2, sr.RowsEmitted)
+	assert.Len(t, sr.Shards, 1)
+	shr := sr.Shards[0]
+	assert.Equal(t, "-", shr.Shard)
+	assert.Equal(t, 2, shr.RowsEmitted)
+	assert.Equal(t, 0, shr.RowsDropped)
+	assert.Equal(t, ReadStatusInterrupted, shr.Status)
+	assert.Equal(t, "Canceled", shr.Reason)
+	assert.Equal(t, "", shr.StartPosition)
+	assert.Equal(t, "MySQL56/e42292e8-e28f-11ec-9c5b-d680f5d655b3:1-717", shr.EndPosition)
+}
+
+func TestSync_ReportsFailedShards(t *testing.T) {
+	tma := getTestMysqlAccess()
+	ped := &testPlanetScaleEdgeDatabase{
+		ReadFn: func(ctx context.Context, ps PlanetScaleSource, s Stream, tc *psdbconnect.TableCursor) (*SerializedCursor, error) {
+			return nil, errors.New("connection reset by peer")
+		},
+	}
+	logger := &testSingerLogger{}
+	source := PlanetScaleSource{
+		Database: "sync-test",
+	}
+	catalog := Catalog{
+		Streams: []Stream{
+			{
+				Name:      "employees",
+				TableName: "employees",
+				Metadata: MetadataCollection{
+					{
+						Metadata: NodeMetadata{
+							Selected:   true,
+							BreadCrumb: []string{},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	report, err := Sync(context.Background(), tma, ped, logger, source, catalog, nil, logger, SyncSettings{})
+	assert.ErrorContains(t, err, "connection reset by peer")
+	assert.Equal(t, "connection reset by peer", report.Error)
+	shr := report.Streams[0].Shards[0]
+	assert.Equal(t, ReadStatusFailed, shr.Status)
+	assert.Equal(t, []string{"connection reset by peer"}, shr.Errors)
+}
+
+// eventRecordWriter records the order in which a RecordWriter is called.
+type eventRecordWriter struct {
+	pending int
+	events  []string
+	states  []State
+}
+
+func (e *eventRecordWriter) Record(record Record, stream Stream) error {
+	e.pending++
+	return nil
+}
+
+func (e *eventRecordWriter) Flush(stream Stream) error {
+	if e.pending > 0 {
+		e.events = append(e.events, fmt.Sprintf("flush %v", e.pending))
+		e.pending = 0
+	}
+	return nil
+}
+
+func (e *eventRecordWriter) State(state State) error {
+	b, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	var copied State
+	if err := json.Unmarshal(b, &copied); err != nil {
+		return err
+	}
+	e.events = append(e.events, "state")
+	e.states = append(e.states, copied)
+	return nil
+}
+
+func TestSync_EmitsStateCheckpointsAfterFlushingRecords(t *testing.T) {
+	catalog := getVerifyCatalog()
+	catalog.Streams[0].Metadata[0].Metadata.ReplicationMethod = "INCREMENTAL"
+
+	lastKnownPK := sqltypes.ResultToProto3(sqltypes.MakeTestResult(sqltypes.MakeTestFields("emp_no", "int64"), "10002"))
+	ped := &testPlanetScaleEdgeDatabase{
+		ReadParamsFn: func(ctx context.Context, params ReadParams) (*SerializedCursor, error) {
+			for _, rows := range [][]string{{"10001|Georgi", "10002|Bezalel"}, {"10003|Parto"}, {"10004|Chirstian", "10005|Kyoichi"}} {
+				if err := params.OnResult(getVerifyResult(rows...)); err != nil {
+					return nil, err
+				}
+				if err := params.OnCursor(&psdbconnect.TableCursor{
+					Shard:       "-",
+					Keyspace:    "employees",
+					LastKnownPk: lastKnownPK,
+				}); err != nil {
+					return nil, err
+				}
+			}
+			return TableCursorToSerializedCursor(&psdbconnect.TableCursor{
+				Shard:    "-",
+				Keyspace: "employees",
+				Position: "MySQL56/e42292e8-e28f-11ec-9c5b-d680f5d655b3:1-717",
+			})
+		},
+	}
+	logger := &testSingerLogger{}
+	writer := &eventRecordWriter{}
+
+	report, err := Sync(context.Background(), getTestMysqlAccess(), ped, logger, PlanetScaleSource{Database: "employees"}, catalog, nil, writer, SyncSettings{CheckpointRows: 3})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"flush 2", "flush 1", "state", "flush 2", "state", "state"}, writer.events)
+	assert.Equal(t, 1, report.Streams[0].Shards[0].Checkpoints)
+
+	checkpoint, err := writer.states[0].Streams["employees"].Shards["-"].SerializedCursorToTableCursor()
+	require.NoError(t, err)
+	assert.NotNil(t, checkpoint.LastKnownPk, "checkpoints should resume the copy from the last primary key")
+}
+
+func TestSync_EmitsNoCheckpointsForFullTableStreams(t *testing.T) {
+	ped := &testPlanetScaleEdgeDatabase{
+		ReadParamsFn: func(ctx context.Context, params ReadParams) (*SerializedCursor, error) {
+			for i := 0; i < 3; i++ {
+				if err := params.OnResult(getVerifyResult("10001|Georgi")); err != nil {
+					return nil, err
+				}
+				if err := params.OnCursor(params.LastKnownPosition); err != nil {
+					return nil, err
+				}
+			}
+			return TableCursorToSerializedCursor(params.LastKnownPosition)
+		},
+	}
+	writer := &eventRecordWriter{}
+
+	_, err := Sync(context.Background(), getTestMysqlAccess(), ped, &testSingerLogger{}, PlanetScaleSource{Database: "employees"}, getVerifyCatalog(), nil, writer, SyncSettings{CheckpointRows: 1})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"flush 1", "flush 1", "flush 1", "state", "state"}, writer.events)
+}
+
+func getOrderedCatalog(streams ...NodeMetadata) Catalog {
+	var catalog Catalog
+	for i, m := range streams {
+		name := fmt.Sprintf("stream%v", i)
+		m.Selected = true
+		m.BreadCrumb = []string{}
+		catalog.Streams = append(catalog.Streams, Stream{
+			Name:      name,
+			TableName: name,
+			Metadata:  MetadataCollection{{Metadata: m}},
+		})
+	}
+	return catalog
+}
+
+func streamNames(streams []Stream) []string {
+	var names []string
+	for _, s := range streams {
+		names = append(names, s.Name)
+	}
+	return names
+}
+
+func TestOrderStreams(t *testing.T) {
+	streams := getOrderedCatalog(
+		NodeMetadata{RowCount: 300},
+		NodeMetadata{},
+		NodeMetadata{RowCount: 100},
+		NodeMetadata{RowCount: 200, SyncPriority: 1},
+	).Streams
+
+	tests := []struct {
+		order            string
+		currentlySyncing string
+		expected         []string
+	}{
+		{order: StreamOrderCatalog, expected: []string{"stream3", "stream0", "stream1", "stream2"}},
+		{order: StreamOrderSmallestFirst, expected: []string{"stream3", "stream2", "stream0", "stream1"}},
+		{order: "stream1, stream0", expected: []string{"stream3", "stream1", "stream0", "stream2"}},
+		{order: StreamOrderSmallestFirst, currentlySyncing: "stream0", expected: []string{"stream0", "stream3", "stream2", "stream1"}},
+		{order: StreamOrderCatalog, currentlySyncing: "deleted", expected: []string{"stream3", "stream0", "stream1", "stream2"}},
+	}
+	for _, tt := range tests {
+		ordered, err := orderStreams(streams, tt.order, tt.currentlySyncing)
+		require.NoError(t, err)
+		assert.Equal(t, tt.expected, streamNames(ordered), "order %q, currently syncing %q", tt.order, tt.currentlySyncing)
+	}
+
+	_, err := orderStreams(streams, "stream0,customers", "")
+	assert.ErrorContains(t, err, `stream "customers" in stream order is not a selected stream`)
+}
+
+func TestSync_ResumesFromCurrentlySyncingStream(t *testing.T) {
+	var streamsRead []string
+	ped := &testPlanetScaleEdgeDatabase{
+		ReadFn: func(ctx context.Context, ps PlanetScaleSource, s Stream, tc *psdbconnect.TableCursor) (*SerializedCursor, error) {
+			streamsRead = append(streamsRead, s.Name)
+			return TableCursorToSerializedCursor(tc)
+		},
+	}
+	catalog := getOrderedCatalog(NodeMetadata{}, NodeMetadata{}, NodeMetadata{})
+	state := &State{
+		CurrentlySyncing: "stream1",
+		Streams: map[string]ShardStates{
+			"stream0": {Shards: map[string]*SerializedCursor{"-": {Cursor: ""}}},
+		},
+	}
+	writer := &eventRecordWriter{}
+
+	_, err := Sync(context.Background(), getTestMysqlAccess(), ped, &testSingerLogger{}, PlanetScaleSource{}, catalog, state, writer, SyncSettings{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"stream1", "stream0", "stream2"}, streamsRead)
+
+	var currentlySyncing []string
+	for _, s := range writer.states {
+		currentlySyncing = append(currentlySyncing, s.CurrentlySyncing)
+	}
+	assert.Equal(t, []string{"stream1", "stream0", "stream2", ""}, currentlySyncing,
+		"state should record the stream being synced until all streams are synced")
+}
+
+func TestSync_ReadsAllStreamsUpToSnapshot(t *testing.T) {
+	tma := getTestMysqlAccess()
+	tma.GetVitessShardsFn = func(ctx context.Context, psc PlanetScaleSource) ([]string, error) {
+		return []string{"-80", "80-"}, nil
+	}
+	var stopPositions []string
+	ped := &testPlanetScaleEdgeDatabase{
+		LatestPositionFn: func(ctx context.Context, params ReadParams) (string, error) {
+			return "MySQL56/" + params.LastKnownPosition.Shard, nil
+		},
+		ReadParamsFn: func(ctx context.Context, params ReadParams) (*SerializedCursor, error) {
+			stopPositions = append(stopPositions, params.StopPosition)
+			return TableCursorToSerializedCursor(params.LastKnownPosition)
+		},
+	}
+	catalog := getOrderedCatalog(NodeMetadata{}, NodeMetadata{})
+	writer := &eventRecordWriter{}
+
+	report, err := Sync(context.Background(), tma, ped, &testSingerLogger{}, PlanetScaleSource{Database: "employees"}, catalog, nil, writer, SyncSettings{ConsistentSnapshot: true})
+	require.NoError(t, err)
+	expected := &Snapshot{
+		Keyspace: "employees",
+		Shards:   map[string]string{"-80": "MySQL56/-80", "80-": "MySQL56/80-"},
+	}
+	assert.Equal(t, expected, report.Snapshot)
+	assert.ElementsMatch(t, []string{"MySQL56/-80", "MySQL56/80-", "MySQL56/-80", "MySQL56/80-"}, stopPositions)
+	assert.Equal(t, expected, writer.states[len(writer.states)-1].Snapshot)
+}
+
+func TestSync_ResumesInterruptedSnapshot(t *testing.T) {
+	ped := &testPlanetScaleEdgeDatabase{
+		LatestPositionFn: func(ctx context.Context, params ReadParams) (string, error) {
+			t.Error("should not take a new snapshot when resuming an interrupted one")
+			return "", nil
+		},
+		ReadParamsFn: func(ctx context.Context, params ReadParams) (*SerializedCursor, error) {
+			assert.Equal(t, "MySQL56/1-10", params.StopPosition)
+			return TableCursorToSerializedCursor(params.LastKnownPosition)
+		},
+	}
+	state := &State{
+		CurrentlySyncing: "stream0",
+		Snapshot:         &Snapshot{Keyspace: "employees", Shards: map[string]string{"-": "MySQL56/1-10"}},
+		Streams: map[string]ShardStates{
+			"stream0": {Shards: map[string]*SerializedCursor{"-": {Cursor: ""}}},
+		},
+	}
+
+	_, err := Sync(context.Background(), getTestMysqlAccess(), ped, &testSingerLogger{}, PlanetScaleSource{Database: "employees"}, getOrderedCatalog(NodeMetadata{}), state, &eventRecordWriter{}, SyncSettings{ConsistentSnapshot: true})
+	require.NoError(t, err)
+}
+
+func TestSync_StartsNewStreamsFromConfiguredPosition(t *testing.T) {
+	catalog := getOrderedCatalog(
+		NodeMetadata{ReplicationMethod: "INCREMENTAL"},
+		NodeMetadata{ReplicationMethod: "INCREMENTAL", StartFrom: StartFromNow},
+		NodeMetadata{ReplicationMethod: "INCREMENTAL", StartFrom: StartFromPosition, StartPositions: map[string]string{"-": "MySQL56/e42292e8-e28f-11ec-9c5b-d680f5d655b3:1-5"}},
+		NodeMetadata{ReplicationMethod: "INCREMENTAL", StartFrom: StartFromNow},
+	)
+	state := &State{
+		Streams: map[string]ShardStates{
+			// streams with state resume from it.
+			"stream3": {Shards: map[string]*SerializedCursor{"-": {Cursor: ""}}},
+		},
+	}
+	startPositions := map[string]string{}
+	ped := &testPlanetScaleEdgeDatabase{
+		LatestPositionFn: func(ctx context.Context, params ReadParams) (string, error) {
+			return "MySQL56/e42292e8-e28f-11ec-9c5b-d680f5d655b3:1-10", nil
+		},
+		ReadParamsFn: func(ctx context.Context, params ReadParams) (*SerializedCursor, error) {
+			startPositions[params.Table.Name] = params.LastKnownPosition.Position
+			return TableCursorToSerializedCursor(params.LastKnownPosition)
+		},
+	}
+
+	_, err := Sync(context.Background(), getTestMysqlAccess(), ped, &testSingerLogger{}, PlanetScaleSource{Database: "employees"}, catalog, state, &eventRecordWriter{}, SyncSettings{})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"stream0": "",
+		"stream1": "MySQL56/e42292e8-e28f-11ec-9c5b-d680f5d655b3:1-10",
+		"stream2": "MySQL56/e42292e8-e28f-11ec-9c5b-d680f5d655b3:1-5",
+		"stream3": "",
+	}, startPositions)
+}
+
+func TestSync_RejectsInvalidStartPositions(t *testing.T) {
+	tests := []struct {
+		metadata NodeMetadata
+		err      string
+	}{
+		{NodeMetadata{StartFrom: StartFromPosition}, "start-positions has no position for shard -"},
+		{NodeMetadata{StartFrom: StartFromPosition, StartPositions: map[string]string{"-": "1-5"}}, `invalid start position "1-5"`},
+		{NodeMetadata{StartFrom: "yesterday"}, `unsupported start-from "yesterday"`},
+		{NodeMetadata{StartFrom: "timestamp"}, "cannot start from a timestamp"},
+	}
+	for _, tt := range tests {
+		tt.metadata.ReplicationMethod = "INCREMENTAL"
+		ped := &testPlanetScaleEdgeDatabase{
+			ReadParamsFn: func(ctx context.Context, params ReadParams) (*SerializedCursor, error) {
+				t.Error("should not read streams with an invalid start position")
+				return nil, nil
+			},
+		}
+		_, err := Sync(context.Background(), getTestMysqlAccess(), ped, &testSingerLogger{}, PlanetScaleSource{Database: "employees"}, getOrderedCatalog(tt.metadata), nil, &eventRecordWriter{}, SyncSettings{})
+		assert.ErrorContains(t, err, tt.err)
+	}
+}
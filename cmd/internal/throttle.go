@@ -0,0 +1,206 @@
+package internal
+
+import (
+	"context"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"vitess.io/vitess/go/sqltypes"
+)
+
+var (
+	// throttleBackoffDelay is how long to wait before reading again the first time a tablet is overloaded,
+	// it doubles for every consecutive time, up to throttleMaxBackoffDelay.
+	throttleBackoffDelay    = time.Second
+	throttleMaxBackoffDelay = time.Minute
+	// throttleRecoveryInterval is how long reads must go without overloading a tablet
+	// before the limits that were lowered because of it are doubled again.
+	throttleRecoveryInterval = time.Minute
+)
+
+// throttleMinFactor is the lowest fraction that limits are lowered to when tablets are overloaded.
+const throttleMinFactor = 1.0 / 64
+
+// ThrottleSettings limits how fast rows are read, to protect the tablets they are read from.
+type ThrottleSettings struct {
+	// RowsPerSecond limits the rows read across all streams, unlimited if zero.
+	RowsPerSecond float64
+	// BytesPerSecond limits the bytes of row values read across all streams, unlimited if zero.
+	BytesPerSecond float64
+	// Adaptive halves all limits and retries reading when a tablet reports that it is overloaded,
+	// the limits are raised again while reads succeed.
+	Adaptive bool
+}
+
+// Throttle limits how fast rows are read, across all streams and per stream,
+// with per stream limits taken from the rows-per-second and bytes-per-second metadata of a stream.
+// A nil *Throttle does not limit reads.
+type Throttle struct {
+	settings ThrottleSettings
+
+	mu      sync.Mutex
+	global  throttleLimits
+	streams map[string]*throttleLimits
+	// factor is the fraction of the configured limits that reads are limited to,
+	// it is lowered when tablets are overloaded.
+	factor      float64
+	backoffs    int
+	lastBackoff time.Time
+}
+
+// throttleLimits are the limiters for a set of configured limits, a nil limiter is unlimited.
+type throttleLimits struct {
+	rowsPerSecond  float64
+	bytesPerSecond float64
+	rows           *rate.Limiter
+	bytes          *rate.Limiter
+}
+
+func NewThrottle(settings ThrottleSettings) *Throttle {
+	return &Throttle{
+		settings: settings,
+		global:   newThrottleLimits(settings.RowsPerSecond, settings.BytesPerSecond),
+		streams:  map[string]*throttleLimits{},
+		factor:   1,
+	}
+}
+
+func newThrottleLimits(rowsPerSecond, bytesPerSecond float64) throttleLimits {
+	return throttleLimits{
+		rowsPerSecond:  rowsPerSecond,
+		bytesPerSecond: bytesPerSecond,
+		rows:           newLimiter(rowsPerSecond),
+		bytes:          newLimiter(bytesPerSecond),
+	}
+}
+
+// newLimiter returns a limiter that allows up to a second's worth of events at once, or nil if unlimited.
+func newLimiter(perSecond float64) *rate.Limiter {
+	if perSecond <= 0 {
+		return nil
+	}
+	return rate.NewLimiter(rate.Limit(perSecond), int(math.Max(1, math.Ceil(perSecond))))
+}
+
+// scale sets the limiters to a fraction of the configured limits.
+func (l throttleLimits) scale(factor float64) {
+	if l.rows != nil {
+		l.rows.SetLimit(rate.Limit(l.rowsPerSecond * factor))
+	}
+	if l.bytes != nil {
+		l.bytes.SetLimit(rate.Limit(l.bytesPerSecond * factor))
+	}
+}
+
+// wait blocks until the rows in a result may be read from a stream, or ctx is done.
+func (t *Throttle) wait(ctx context.Context, stream Stream, result *sqltypes.Result) error {
+	if t == nil {
+		return nil
+	}
+
+	t.mu.Lock()
+	t.recover()
+	limits, ok := t.streams[stream.Name]
+	if !ok {
+		metadata := streamMetadata(stream)
+		l := newThrottleLimits(metadata.RowsPerSecond, metadata.BytesPerSecond)
+		l.scale(t.factor)
+		limits = &l
+		t.streams[stream.Name] = limits
+	}
+	limiters := []*rate.Limiter{t.global.rows, t.global.bytes, limits.rows, limits.bytes}
+	t.mu.Unlock()
+
+	rows := len(result.Rows)
+	bytes := 0
+	for _, row := range result.Rows {
+		for _, v := range row {
+			bytes += len(v.Raw())
+		}
+	}
+	for i, limiter := range limiters {
+		n := rows
+		if i%2 == 1 {
+			n = bytes
+		}
+		if err := waitN(ctx, limiter, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// waitN waits for n events, in steps of at most the limiter's burst.
+func waitN(ctx context.Context, limiter *rate.Limiter, n int) error {
+	if limiter == nil {
+		return nil
+	}
+	for n > 0 {
+		step := n
+		if burst := limiter.Burst(); step > burst {
+			step = burst
+		}
+		if err := limiter.WaitN(ctx, step); err != nil {
+			return err
+		}
+		n -= step
+	}
+	return nil
+}
+
+// backoff lowers all limits after a tablet reported that it is overloaded, and returns how long to wait
+// before reading again. It returns false if the throttle is not adaptive, in which case the read should not be retried.
+func (t *Throttle) backoff() (time.Duration, bool) {
+	if t == nil || !t.settings.Adaptive {
+		return 0, false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.setFactor(math.Max(t.factor/2, throttleMinFactor))
+	t.lastBackoff = time.Now()
+	delay := throttleBackoffDelay << t.backoffs
+	if delay > throttleMaxBackoffDelay || delay <= 0 {
+		delay = throttleMaxBackoffDelay
+	} else {
+		t.backoffs++
+	}
+	return delay, true
+}
+
+// recover doubles lowered limits once reads have not overloaded a tablet for a while, t.mu must be held.
+func (t *Throttle) recover() {
+	if t.factor >= 1 || time.Since(t.lastBackoff) < throttleRecoveryInterval {
+		return
+	}
+	t.setFactor(math.Min(t.factor*2, 1))
+	t.lastBackoff = time.Now()
+	t.backoffs = 0
+}
+
+// setFactor scales all limits to a fraction of their configured values, t.mu must be held.
+func (t *Throttle) setFactor(factor float64) {
+	t.factor = factor
+	t.global.scale(factor)
+	for _, limits := range t.streams {
+		limits.scale(factor)
+	}
+}
+
+// isOverloaded reports whether an error means that a tablet is overloaded or is throttling reads.
+func isOverloaded(err error) bool {
+	s, ok := status.FromError(err)
+	if !ok {
+		return false
+	}
+	if s.Code() == codes.ResourceExhausted {
+		return true
+	}
+	message := strings.ToLower(s.Message())
+	return strings.Contains(message, "throttl") || strings.Contains(message, "too many requests")
+}
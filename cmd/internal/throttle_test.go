@@ -0,0 +1,141 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	psdbconnect "github.com/planetscale/airbyte-source/proto/psdbconnect/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/proto/query"
+)
+
+func TestThrottle_LimitsRowsAcrossStreams(t *testing.T) {
+	throttle := NewThrottle(ThrottleSettings{RowsPerSecond: 1000})
+	rows := getVerifyResult("1|a")
+	for i := 1; i < 1000; i++ {
+		rows.Rows = append(rows.Rows, rows.Rows[0])
+	}
+
+	started := time.Now()
+	require.NoError(t, throttle.wait(context.Background(), Stream{Name: "employees"}, rows))
+	rows.Rows = rows.Rows[:200]
+	require.NoError(t, throttle.wait(context.Background(), Stream{Name: "departments"}, rows))
+	assert.GreaterOrEqual(t, time.Since(started), 150*time.Millisecond, "rows past the first second's worth should wait")
+}
+
+func TestSync_ThrottlesSelectedRows(t *testing.T) {
+	var rows []string
+	for i := 1; i <= 120; i++ {
+		rows = append(rows, fmt.Sprintf("%d|a", i))
+	}
+	tma, _ := getSelectMysqlAccess(t, rows...)
+	catalog := getSelectCatalog(true)
+	catalog.Streams[0].Metadata[0].Metadata.RowsPerSecond = 100
+
+	started := time.Now()
+	report, err := Sync(context.Background(), tma, &testPlanetScaleEdgeDatabase{}, &testSingerLogger{}, PlanetScaleSource{Database: "employees"}, catalog, nil, &eventRecordWriter{}, SyncSettings{Throttle: NewThrottle(ThrottleSettings{})})
+	require.NoError(t, err)
+	assert.Equal(t, 120, report.stream("employees").Select.RowsEmitted)
+	assert.GreaterOrEqual(t, time.Since(started), 150*time.Millisecond, "rows past the first second's worth should wait")
+}
+
+func TestThrottle_UsesStreamLimitsFromMetadata(t *testing.T) {
+	throttle := NewThrottle(ThrottleSettings{})
+	stream := getOrderedCatalog(NodeMetadata{RowsPerSecond: 10, BytesPerSecond: 2000}).Streams[0]
+	require.NoError(t, throttle.wait(context.Background(), stream, getVerifyResult("1|a")))
+
+	limits := throttle.streams[stream.Name]
+	require.NotNil(t, limits)
+	assert.Equal(t, rate.Limit(10), limits.rows.Limit())
+	assert.Equal(t, rate.Limit(2000), limits.bytes.Limit())
+	assert.Nil(t, throttle.global.rows)
+
+	var unlimited *Throttle
+	assert.NoError(t, unlimited.wait(context.Background(), stream, getVerifyResult("1|a")))
+}
+
+func TestThrottle_AdaptiveBackoffLowersLimits(t *testing.T) {
+	throttle := NewThrottle(ThrottleSettings{RowsPerSecond: 1000, Adaptive: true})
+	stream := getOrderedCatalog(NodeMetadata{RowsPerSecond: 100}).Streams[0]
+	require.NoError(t, throttle.wait(context.Background(), stream, getVerifyResult("1|a")))
+
+	delay, ok := throttle.backoff()
+	assert.True(t, ok)
+	assert.Equal(t, throttleBackoffDelay, delay)
+	delay, _ = throttle.backoff()
+	assert.Equal(t, 2*throttleBackoffDelay, delay)
+	assert.Equal(t, rate.Limit(250), throttle.global.rows.Limit())
+	assert.Equal(t, rate.Limit(25), throttle.streams[stream.Name].rows.Limit())
+
+	// limits are raised again once reads stop overloading tablets.
+	throttle.lastBackoff = time.Now().Add(-throttleRecoveryInterval)
+	require.NoError(t, throttle.wait(context.Background(), stream, getVerifyResult("1|a")))
+	assert.Equal(t, rate.Limit(500), throttle.global.rows.Limit())
+	delay, _ = throttle.backoff()
+	assert.Equal(t, throttleBackoffDelay, delay)
+
+	_, ok = NewThrottle(ThrottleSettings{RowsPerSecond: 1000}).backoff()
+	assert.False(t, ok, "only adaptive throttles back off")
+}
+
+func TestIsOverloaded(t *testing.T) {
+	assert.True(t, isOverloaded(status.Error(codes.ResourceExhausted, "resource exhausted")))
+	assert.True(t, isOverloaded(status.Error(codes.Unknown, "vstreamer: Throttled by tablet throttler")))
+	assert.False(t, isOverloaded(status.Error(codes.Unknown, "Cannot replicate because the master purged required binary logs")))
+	assert.False(t, isOverloaded(errors.New("too many requests")))
+}
+
+func TestRead_AdaptiveThrottleRetriesOverloadedTablet(t *testing.T) {
+	throttleBackoffDelay = time.Millisecond
+	defer func() { throttleBackoffDelay = time.Second }()
+
+	b := bytes.NewBufferString("")
+	ped := PlanetScaleEdgeDatabase{
+		Logger:   NewLogger("test", b, b),
+		Mysql:    getTestMysqlAccess(),
+		Throttle: NewThrottle(ThrottleSettings{Adaptive: true}),
+	}
+	stop := &psdbconnect.TableCursor{Shard: "-", Keyspace: "connect-test", Position: "e4e20f06-e28f-11ec-8d20-8e7ac09cb64c:1-1"}
+	cc := clientConnectionMock{}
+	cc.syncFn = func(ctx context.Context, in *psdbconnect.SyncRequest, opts ...grpc.CallOption) (psdbconnect.Connect_SyncClient, error) {
+		if cc.syncFnInvokedCount == 1 {
+			return &connectSyncClientMock{syncError: status.Error(codes.ResourceExhausted, "too many rows")}, nil
+		}
+		return &connectSyncClientMock{syncResponses: []*psdbconnect.SyncResponse{{
+			Cursor: stop,
+			Result: []*query.QueryResult{sqltypes.ResultToProto3(getVerifyResult("1|a"))},
+		}}}, nil
+	}
+	ped.clientFn = func(ctx context.Context, ps PlanetScaleSource) (psdbconnect.ConnectClient, error) {
+		return &cc, nil
+	}
+
+	rows := 0
+	sc, err := ped.Read(context.Background(), ReadParams{
+		Source:            PlanetScaleSource{Database: "connect-test"},
+		Table:             Stream{Name: "employees"},
+		LastKnownPosition: &psdbconnect.TableCursor{Shard: "-", Keyspace: "connect-test"},
+		StopPosition:      stop.Position,
+		OnResult: func(qr *sqltypes.Result) error {
+			rows += len(qr.Rows)
+			return nil
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, rows)
+	assert.Equal(t, 2, cc.syncFnInvokedCount)
+	esc, err := TableCursorToSerializedCursor(stop)
+	require.NoError(t, err)
+	assert.Equal(t, esc, sc)
+	assert.Contains(t, b.String(), "tablet is overloaded")
+}
@@ -0,0 +1,133 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/pkg/errors"
+	clientoptions "github.com/planetscale/psdb/core/pool/options"
+)
+
+const (
+	// TLSModeVerify encrypts connections and verifies the server's certificate, this is the default.
+	TLSModeVerify = "verify"
+	// TLSModeSkipVerify encrypts connections without verifying the server's certificate.
+	TLSModeSkipVerify = "skip-verify"
+	// TLSModeDisabled does not encrypt connections, for local test clusters such as vttestserver.
+	TLSModeDisabled = "disabled"
+)
+
+// TLSSettings configures how connections to a database, over both MySQL and gRPC, are secured.
+type TLSSettings struct {
+	// Mode is one of verify, skip-verify or disabled, verify if empty.
+	Mode string `json:"mode,omitempty"`
+	// CAFile is a PEM bundle of certificate authorities to verify the server's certificate with,
+	// instead of the system's.
+	CAFile string `json:"ca_file,omitempty"`
+	// CertFile and KeyFile are a PEM client certificate and its key, for servers that authenticate clients.
+	CertFile string `json:"cert_file,omitempty"`
+	KeyFile  string `json:"key_file,omitempty"`
+	// ServerName is the name the server's certificate is verified against, instead of the host.
+	ServerName string `json:"server_name,omitempty"`
+}
+
+// tlsSettings returns the source's TLS settings. Without any, connections are verified
+// unless PS_END_TO_END_TEST_RUN is set, which skips verification as it did before TLS could be configured.
+func (psc PlanetScaleSource) tlsSettings() TLSSettings {
+	if psc.TLS != nil {
+		return *psc.TLS
+	}
+	if !useSecureConnection() {
+		return TLSSettings{Mode: TLSModeSkipVerify}
+	}
+	return TLSSettings{Mode: TLSModeVerify}
+}
+
+// TLSConfig returns the TLS configuration to connect to the source with, or nil if connections are not encrypted.
+func (psc PlanetScaleSource) TLSConfig() (*tls.Config, error) {
+	settings := psc.tlsSettings()
+
+	var config *tls.Config
+	switch strings.ToLower(strings.TrimSpace(settings.Mode)) {
+	case TLSModeDisabled:
+		return nil, nil
+	case TLSModeVerify, "":
+		config = clientoptions.DefaultTLSConfig()
+	case TLSModeSkipVerify:
+		config = &tls.Config{MinVersion: tls.VersionTLS12, InsecureSkipVerify: true}
+	default:
+		return nil, errors.Errorf("unsupported TLS mode %q, must be one of %v, %v, %v", settings.Mode, TLSModeVerify, TLSModeSkipVerify, TLSModeDisabled)
+	}
+
+	if len(settings.CAFile) > 0 {
+		pem, err := os.ReadFile(settings.CAFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to read TLS certificate authorities")
+		}
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, errors.Errorf("no certificates found in %v", settings.CAFile)
+		}
+		config.RootCAs = roots
+	}
+
+	if len(settings.CertFile) > 0 || len(settings.KeyFile) > 0 {
+		if len(settings.CertFile) == 0 || len(settings.KeyFile) == 0 {
+			return nil, errors.New("a TLS client certificate needs both cert_file and key_file")
+		}
+		cert, err := tls.LoadX509KeyPair(settings.CertFile, settings.KeyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to load TLS client certificate")
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	config.ServerName = settings.ServerName
+	return config, nil
+}
+
+// mysqlTLSConfig returns the value of the tls parameter of a DSN for the source's TLS settings,
+// registering a TLS configuration with the MySQL driver if it needs one.
+func (psc PlanetScaleSource) mysqlTLSConfig() (string, error) {
+	config, err := psc.TLSConfig()
+	if err != nil {
+		return "", err
+	}
+	if config == nil {
+		return "false", nil
+	}
+
+	settings := psc.tlsSettings()
+	// configurations are registered under a name derived from their settings,
+	// so that connecting again with the same settings replaces rather than adds one.
+	b, err := json.Marshal(settings)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	name := "singer-tap-" + hex.EncodeToString(sum[:8])
+	if err := mysql.RegisterTLSConfig(name, config); err != nil {
+		return "", errors.Wrap(err, "unable to register TLS configuration")
+	}
+	return name, nil
+}
+
+// grpcOptions returns the options to dial the source's gRPC endpoint with.
+func (psc PlanetScaleSource) grpcOptions() ([]clientoptions.ClientOption, error) {
+	config, err := psc.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	var opts []clientoptions.ClientOption
+	// without a TLS configuration, connections are plaintext.
+	if config != nil {
+		opts = append(opts, clientoptions.WithTLSConfig(config))
+	}
+	return opts, nil
+}
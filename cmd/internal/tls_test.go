@@ -0,0 +1,118 @@
+package internal
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	psdbconnect "github.com/planetscale/airbyte-source/proto/psdbconnect/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestCertificate writes a self-signed certificate and its key to PEM files in a temporary directory.
+func writeTestCertificate(t *testing.T) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "vttestserver"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0o600))
+	return certFile, keyFile
+}
+
+func TestTLSConfig_Modes(t *testing.T) {
+	config, err := PlanetScaleSource{}.TLSConfig()
+	require.NoError(t, err)
+	require.NotNil(t, config)
+	assert.False(t, config.InsecureSkipVerify)
+
+	config, err = PlanetScaleSource{TLS: &TLSSettings{Mode: "skip-verify", ServerName: "vtgate.internal"}}.TLSConfig()
+	require.NoError(t, err)
+	assert.True(t, config.InsecureSkipVerify)
+	assert.Equal(t, "vtgate.internal", config.ServerName)
+
+	config, err = PlanetScaleSource{TLS: &TLSSettings{Mode: "disabled"}}.TLSConfig()
+	require.NoError(t, err)
+	assert.Nil(t, config)
+
+	_, err = PlanetScaleSource{TLS: &TLSSettings{Mode: "required"}}.TLSConfig()
+	assert.EqualError(t, err, `unsupported TLS mode "required", must be one of verify, skip-verify, disabled`)
+}
+
+func TestTLSConfig_FallsBackToEndToEndTestVariable(t *testing.T) {
+	t.Setenv("PS_END_TO_END_TEST_RUN", "true")
+	config, err := PlanetScaleSource{}.TLSConfig()
+	require.NoError(t, err)
+	assert.True(t, config.InsecureSkipVerify)
+
+	// settings in the source take precedence.
+	config, err = PlanetScaleSource{TLS: &TLSSettings{}}.TLSConfig()
+	require.NoError(t, err)
+	assert.False(t, config.InsecureSkipVerify)
+}
+
+func TestTLSConfig_LoadsCertificates(t *testing.T) {
+	certFile, keyFile := writeTestCertificate(t)
+
+	config, err := PlanetScaleSource{TLS: &TLSSettings{CAFile: certFile, CertFile: certFile, KeyFile: keyFile}}.TLSConfig()
+	require.NoError(t, err)
+	require.NotNil(t, config.RootCAs)
+	assert.Len(t, config.Certificates, 1)
+
+	_, err = PlanetScaleSource{TLS: &TLSSettings{CertFile: certFile}}.TLSConfig()
+	assert.EqualError(t, err, "a TLS client certificate needs both cert_file and key_file")
+
+	_, err = PlanetScaleSource{TLS: &TLSSettings{CAFile: keyFile}}.TLSConfig()
+	assert.ErrorContains(t, err, "no certificates found in")
+
+	_, err = PlanetScaleSource{TLS: &TLSSettings{CAFile: filepath.Join(t.TempDir(), "missing.pem")}}.TLSConfig()
+	assert.ErrorContains(t, err, "unable to read TLS certificate authorities")
+}
+
+func TestDSN_AppliesTLSSettings(t *testing.T) {
+	certFile, _ := writeTestCertificate(t)
+	source := PlanetScaleSource{Host: "vtgate.internal:3306", Database: "employees", Username: "user", Password: "pass", TLS: &TLSSettings{CAFile: certFile}}
+
+	dsn, err := source.DSN(psdbconnect.TabletType_replica)
+	require.NoError(t, err)
+	config, err := mysql.ParseDSN(dsn)
+	require.NoError(t, err)
+	assert.Equal(t, "employees@replica", config.DBName)
+	require.NotNil(t, config.TLS)
+	assert.NotNil(t, config.TLS.RootCAs)
+	assert.Equal(t, "vtgate.internal", config.TLS.ServerName)
+
+	source.TLS = &TLSSettings{Mode: "disabled"}
+	dsn, err = source.DSN(psdbconnect.TabletType_primary)
+	require.NoError(t, err)
+	config, err = mysql.ParseDSN(dsn)
+	require.NoError(t, err)
+	assert.Nil(t, config.TLS)
+
+	opts, err := source.grpcOptions()
+	require.NoError(t, err)
+	assert.Empty(t, opts)
+}
@@ -0,0 +1,131 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/planetscale/singer-tap"
+
+// Attribute keys recorded on spans, these mirror the fields used in status messages.
+const (
+	streamAttribute     = attribute.Key(StreamKey)
+	shardAttribute      = attribute.Key(ShardKey)
+	tabletTypeAttribute = attribute.Key(TabletTypeKey)
+	positionAttribute   = attribute.Key(PositionKey)
+	batchSizeAttribute  = attribute.Key(BatchSizeKey)
+)
+
+type TraceExporter string
+
+const (
+	TraceExporterNone TraceExporter = "none"
+	TraceExporterOTLP TraceExporter = "otlp"
+	TraceExporterFile TraceExporter = "file"
+)
+
+// TracingSettings configures where spans for a tap run are exported to.
+type TracingSettings struct {
+	// Exporter is one of none, otlp or file.
+	Exporter TraceExporter
+	// Endpoint is the host:port of an OTLP gRPC collector,
+	// the OTEL_EXPORTER_OTLP_* environment variables are used if empty.
+	Endpoint string
+	// Insecure disables TLS when talking to the OTLP collector.
+	Insecure bool
+	// FilePath is where spans are written as JSON when using the file exporter.
+	FilePath string
+	// ServiceVersion is recorded on every span as the version of this tap.
+	ServiceVersion string
+}
+
+// SetupTracing installs a global tracer provider for the configured exporter.
+// The returned function flushes any pending spans and must be called before the process exits.
+func SetupTracing(ctx context.Context, settings TracingSettings) (func(context.Context) error, error) {
+	var (
+		exporter sdktrace.SpanExporter
+		closer   func() error
+		err      error
+	)
+
+	switch settings.Exporter {
+	case "", TraceExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case TraceExporterOTLP:
+		var opts []otlptracegrpc.Option
+		if len(settings.Endpoint) > 0 {
+			opts = append(opts, otlptracegrpc.WithEndpoint(settings.Endpoint))
+		}
+		if settings.Insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		exporter, err = otlptracegrpc.New(ctx, opts...)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to create OTLP trace exporter")
+		}
+	case TraceExporterFile:
+		if len(settings.FilePath) == 0 {
+			return nil, errors.New("file trace exporter requires a path to write spans to")
+		}
+		f, err := os.Create(settings.FilePath)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to create trace file at path %v", settings.FilePath)
+		}
+		closer = f.Close
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(f))
+		if err != nil {
+			f.Close()
+			return nil, errors.Wrap(err, "unable to create file trace exporter")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported trace exporter %q, must be one of none, otlp, file", settings.Exporter)
+	}
+
+	res := resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName("planetscale-singer-tap"),
+		semconv.ServiceVersion(settings.ServiceVersion),
+	)
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(tp)
+
+	return func(ctx context.Context) error {
+		err := tp.Shutdown(ctx)
+		if closer != nil {
+			if cErr := closer(); cErr != nil && err == nil {
+				err = cErr
+			}
+		}
+		return err
+	}, nil
+}
+
+// startSpan starts a span from the global tracer provider,
+// which does nothing unless SetupTracing was called.
+func startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// endSpan records err on the span, if any, and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
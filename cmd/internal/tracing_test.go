@@ -0,0 +1,67 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	psdbconnect "github.com/planetscale/airbyte-source/proto/psdbconnect/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"google.golang.org/grpc"
+)
+
+func TestTracing_RecordsSpansForRead(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(previous)
+
+	b := bytes.NewBufferString("")
+	ped := PlanetScaleEdgeDatabase{
+		Logger: NewLogger("test", b, b),
+		Mysql:  getTestMysqlAccess(),
+	}
+	tc := &psdbconnect.TableCursor{
+		Shard:    "-",
+		Position: "THIS_IS_A_SHARD_GTID",
+		Keyspace: "connect-test",
+	}
+	cc := clientConnectionMock{
+		syncFn: func(ctx context.Context, in *psdbconnect.SyncRequest, opts ...grpc.CallOption) (psdbconnect.Connect_SyncClient, error) {
+			return &connectSyncClientMock{
+				syncResponses: []*psdbconnect.SyncResponse{{Cursor: tc}},
+			}, nil
+		},
+	}
+	ped.clientFn = func(ctx context.Context, ps PlanetScaleSource) (psdbconnect.ConnectClient, error) {
+		return &cc, nil
+	}
+
+	_, err := ped.Read(context.Background(), ReadParams{
+		Source:            PlanetScaleSource{Database: "connect-test"},
+		Table:             Stream{Name: "customers"},
+		LastKnownPosition: tc,
+		TabletType:        psdbconnect.TabletType_primary,
+	})
+	assert.NoError(t, err)
+
+	spans := recorder.Ended()
+	var names []string
+	for _, span := range spans {
+		names = append(names, span.Name())
+	}
+	assert.Equal(t, []string{"PlanetScaleEdgeDatabase.getLatestCursorPosition", "PlanetScaleEdgeDatabase.Read"}, names)
+	assert.Equal(t, spans[1].SpanContext().TraceID(), spans[0].SpanContext().TraceID(), "peek should be a child of the read iteration")
+	assert.Contains(t, spans[1].Attributes(), streamAttribute.String("customers"))
+}
+
+func TestTracing_CanRejectUnknownExporter(t *testing.T) {
+	_, err := SetupTracing(context.Background(), TracingSettings{Exporter: "zipkin"})
+	assert.ErrorContains(t, err, "unsupported trace exporter")
+
+	_, err = SetupTracing(context.Background(), TracingSettings{Exporter: TraceExporterFile})
+	assert.ErrorContains(t, err, "requires a path")
+}
@@ -0,0 +1,262 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type TransformType string
+
+const (
+	// TransformHash replaces a value with the hex encoded SHA-256 hash of the salt followed by the value.
+	TransformHash TransformType = "hash"
+	// TransformMask replaces all but the last Keep characters of a value with "*".
+	TransformMask TransformType = "mask"
+	// TransformNullify replaces a value with null.
+	TransformNullify TransformType = "nullify"
+	// TransformTruncate shortens a string value to at most Length characters.
+	TransformTruncate TransformType = "truncate"
+	// TransformRename emits a value as a property with a different name.
+	TransformRename TransformType = "rename"
+)
+
+// ColumnTransform is a transformation of the values of a property, configured in the property's metadata.
+// example:
+//
+//	"transforms": [
+//	  { "type": "hash", "salt": "4b0f2c" },
+//	  { "type": "rename", "name": "email_hash" }
+//	]
+type ColumnTransform struct {
+	Type TransformType `json:"type"`
+	// Salt is prepended to values before they are hashed.
+	Salt string `json:"salt,omitempty"`
+	// Keep is the number of trailing characters that a mask leaves visible.
+	Keep int `json:"keep,omitempty"`
+	// Length is the number of characters that a value is truncated to.
+	Length int `json:"length,omitempty"`
+	// Name is the property name that a renamed value is emitted as.
+	Name string `json:"name,omitempty"`
+}
+
+// RecordTransformer applies the transforms configured for the properties of a stream
+// to its records, and adjusts the schema of the stream to match.
+type RecordTransformer struct {
+	transforms map[string][]ColumnTransform
+	// names maps the properties of the stream to the names they are emitted as.
+	names map[string]string
+	// properties are the emitted schemas of the transformed properties.
+	properties map[string]StreamProperty
+}
+
+// NewRecordTransformer validates the transforms of all properties in a filtered stream.
+// It returns nil if no property of the stream is transformed.
+func NewRecordTransformer(s Stream) (*RecordTransformer, error) {
+	t := &RecordTransformer{
+		transforms: map[string][]ColumnTransform{},
+		names:      map[string]string{},
+		properties: map[string]StreamProperty{},
+	}
+
+	for name, m := range s.Metadata.GetPropertyMap() {
+		property, ok := s.Schema.Properties[name]
+		if !ok || len(m.Metadata.Transforms) == 0 {
+			continue
+		}
+
+		emittedName := name
+		for _, ct := range m.Metadata.Transforms {
+			switch ct.Type {
+			case TransformHash:
+				property = stringProperty(property)
+			case TransformMask:
+				if ct.Keep < 0 {
+					return nil, fmt.Errorf("property %q of stream %q cannot keep a negative number of characters unmasked", name, s.Name)
+				}
+				property = stringProperty(property)
+			case TransformNullify:
+				if contains(s.KeyProperties, name) {
+					return nil, fmt.Errorf("key property %q of stream %q cannot be nullified", name, s.Name)
+				}
+				if !property.hasType("null") {
+					property.Types = append([]string{"null"}, property.Types...)
+				}
+			case TransformTruncate:
+				if ct.Length <= 0 {
+					return nil, fmt.Errorf("property %q of stream %q must be truncated to a positive length", name, s.Name)
+				}
+				if !property.hasType("string") {
+					return nil, fmt.Errorf("property %q of stream %q is not a string and cannot be truncated", name, s.Name)
+				}
+				property.CustomFormat = ""
+			case TransformRename:
+				if len(ct.Name) == 0 {
+					return nil, fmt.Errorf("property %q of stream %q must be renamed to a non-empty name", name, s.Name)
+				}
+				emittedName = ct.Name
+			default:
+				return nil, fmt.Errorf("unknown transform %q for property %q of stream %q", ct.Type, name, s.Name)
+			}
+		}
+
+		t.transforms[name] = m.Metadata.Transforms
+		t.names[name] = emittedName
+		t.properties[name] = property
+	}
+
+	if len(t.transforms) == 0 {
+		return nil, nil
+	}
+
+	// renamed properties should not collide with each other, or with properties that keep their name.
+	emitted := map[string]string{}
+	var names []string
+	for name := range s.Schema.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		emittedName := t.name(name)
+		if other, ok := emitted[emittedName]; ok {
+			return nil, fmt.Errorf("properties %q and %q of stream %q would both be emitted as %q", other, name, s.Name, emittedName)
+		}
+		emitted[emittedName] = name
+	}
+
+	return t, nil
+}
+
+// Transform returns the record that is emitted for data, the converted values of a row.
+// A nil transformer returns data as is.
+func (t *RecordTransformer) Transform(data map[string]interface{}) map[string]interface{} {
+	if t == nil {
+		return data
+	}
+
+	transformed := make(map[string]interface{}, len(data))
+	for name, value := range data {
+		for _, ct := range t.transforms[name] {
+			value = applyTransform(ct, value)
+		}
+		transformed[t.name(name)] = value
+	}
+	return transformed
+}
+
+// Schema returns the stream as it is emitted in a SCHEMA message,
+// with transformed properties renamed and retyped, and without any transform configuration.
+func (t *RecordTransformer) Schema(s Stream) Stream {
+	if t == nil {
+		return s
+	}
+
+	emitted := s
+	emitted.Schema.Properties = make(map[string]StreamProperty, len(s.Schema.Properties))
+	for name, property := range s.Schema.Properties {
+		if tp, ok := t.properties[name]; ok {
+			property = tp
+		}
+		emitted.Schema.Properties[t.name(name)] = property
+	}
+
+	emitted.Metadata = make(MetadataCollection, 0, len(s.Metadata))
+	for _, m := range s.Metadata {
+		// transforms can contain salts, which should not be sent along with the schema.
+		m.Metadata.Transforms = nil
+		if n := len(m.Metadata.BreadCrumb); n > 0 {
+			breadcrumb := make([]string, n)
+			copy(breadcrumb, m.Metadata.BreadCrumb)
+			breadcrumb[n-1] = t.name(breadcrumb[n-1])
+			m.Metadata.BreadCrumb = breadcrumb
+		}
+		emitted.Metadata = append(emitted.Metadata, m)
+	}
+
+	emitted.KeyProperties = t.renameAll(s.KeyProperties)
+	emitted.CursorProperties = t.renameAll(s.CursorProperties)
+	return emitted
+}
+
+func (t *RecordTransformer) name(property string) string {
+	if name, ok := t.names[property]; ok {
+		return name
+	}
+	return property
+}
+
+func (t *RecordTransformer) renameAll(properties []string) []string {
+	if properties == nil {
+		return nil
+	}
+	renamed := make([]string, 0, len(properties))
+	for _, property := range properties {
+		renamed = append(renamed, t.name(property))
+	}
+	return renamed
+}
+
+// newRecordTransformers returns the transformers for all streams in a filtered catalog
+// that have transformed properties, keyed by stream name.
+func newRecordTransformers(catalog Catalog) (map[string]*RecordTransformer, error) {
+	transformers := map[string]*RecordTransformer{}
+	for _, stream := range catalog.Streams {
+		t, err := NewRecordTransformer(stream)
+		if err != nil {
+			return nil, err
+		}
+		if t != nil {
+			transformers[stream.Name] = t
+		}
+	}
+	return transformers, nil
+}
+
+// applyTransform transforms a single converted value, null values are only affected by renames.
+func applyTransform(ct ColumnTransform, value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+
+	switch ct.Type {
+	case TransformHash:
+		sum := sha256.Sum256([]byte(ct.Salt + transformString(value)))
+		return hex.EncodeToString(sum[:])
+	case TransformMask:
+		runes := []rune(transformString(value))
+		keep := ct.Keep
+		// never leave a value entirely visible.
+		if keep >= len(runes) {
+			keep = 0
+		}
+		return strings.Repeat("*", len(runes)-keep) + string(runes[len(runes)-keep:])
+	case TransformNullify:
+		return nil
+	case TransformTruncate:
+		if s, ok := value.(string); ok {
+			if runes := []rune(s); len(runes) > ct.Length {
+				return string(runes[:ct.Length])
+			}
+		}
+		return value
+	default:
+		return value
+	}
+}
+
+func transformString(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+	return fmt.Sprint(value)
+}
+
+// stringProperty returns the schema of a property whose values are replaced with strings.
+func stringProperty(property StreamProperty) StreamProperty {
+	if property.hasType("null") {
+		return StreamProperty{Types: []string{"null", "string"}, Description: property.Description}
+	}
+	return StreamProperty{Types: []string{"string"}, Description: property.Description}
+}
@@ -0,0 +1,195 @@
+package internal
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func getTransformStream(t *testing.T, transforms map[string][]ColumnTransform) Stream {
+	stream := Stream{
+		Name:          "employees",
+		TableName:     "employees",
+		KeyProperties: []string{"emp_no"},
+		Schema: StreamSchema{
+			Properties: map[string]StreamProperty{
+				"emp_no":     {Types: []string{"null", "integer"}},
+				"email":      {Types: []string{"null", "string"}},
+				"phone":      {Types: []string{"string"}},
+				"birth_date": {Types: []string{"null", "string"}, CustomFormat: "date-time"},
+				"notes":      {Types: []string{"null", "string"}},
+			},
+		},
+		Metadata: MetadataCollection{
+			{Metadata: NodeMetadata{Selected: true, BreadCrumb: []string{}}},
+		},
+	}
+	for _, name := range []string{"emp_no", "email", "phone", "birth_date", "notes"} {
+		stream.Metadata = append(stream.Metadata, Metadata{Metadata: NodeMetadata{
+			Selected:   true,
+			BreadCrumb: []string{"properties", name},
+			Transforms: transforms[name],
+		}})
+	}
+	filtered, err := filterSchema(Catalog{Streams: []Stream{stream}})
+	require.NoError(t, err)
+	return filtered.Streams[0]
+}
+
+func TestRecordTransformer_CanTransformRecords(t *testing.T) {
+	stream := getTransformStream(t, map[string][]ColumnTransform{
+		"email": {
+			{Type: TransformHash, Salt: "pepper"},
+			{Type: TransformRename, Name: "email_hash"},
+		},
+		"phone":      {{Type: TransformMask, Keep: 4}},
+		"birth_date": {{Type: TransformNullify}},
+		"notes":      {{Type: TransformTruncate, Length: 5}},
+	})
+	rt, err := NewRecordTransformer(stream)
+	require.NoError(t, err)
+
+	record := rt.Transform(map[string]interface{}{
+		"emp_no":     int64(10001),
+		"email":      "georgi@example.com",
+		"phone":      "555-0100",
+		"birth_date": "1953-09-02T00:00:00Z",
+		"notes":      "Prefers email",
+	})
+	hash := sha256.Sum256([]byte("peppergeorgi@example.com"))
+	assert.Equal(t, map[string]interface{}{
+		"emp_no":     int64(10001),
+		"email_hash": hex.EncodeToString(hash[:]),
+		"phone":      "****0100",
+		"birth_date": nil,
+		"notes":      "Prefe",
+	}, record)
+
+	record = rt.Transform(map[string]interface{}{"email": nil, "phone": "12"})
+	assert.Equal(t, map[string]interface{}{"email_hash": nil, "phone": "**"}, record, "null values stay null, short values are fully masked")
+}
+
+func TestRecordTransformer_CanAdjustSchema(t *testing.T) {
+	stream := getTransformStream(t, map[string][]ColumnTransform{
+		"emp_no":     {{Type: TransformHash, Salt: "pepper"}, {Type: TransformRename, Name: "emp_hash"}},
+		"birth_date": {{Type: TransformMask}},
+		"phone":      {{Type: TransformNullify}},
+	})
+	rt, err := NewRecordTransformer(stream)
+	require.NoError(t, err)
+
+	emitted := rt.Schema(stream)
+	assert.Equal(t, []string{"emp_hash"}, emitted.KeyProperties)
+	assert.Equal(t, StreamProperty{Types: []string{"null", "string"}}, emitted.Schema.Properties["emp_hash"])
+	assert.Equal(t, StreamProperty{Types: []string{"null", "string"}}, emitted.Schema.Properties["birth_date"])
+	assert.Equal(t, StreamProperty{Types: []string{"null", "string"}}, emitted.Schema.Properties["phone"])
+	assert.NotContains(t, emitted.Schema.Properties, "emp_no")
+	assert.Contains(t, emitted.Metadata.GetPropertyMap(), "emp_hash")
+	for _, m := range emitted.Metadata {
+		assert.Empty(t, m.Metadata.Transforms, "transforms should not be emitted")
+	}
+
+	// the stream that rows are read with is unchanged.
+	assert.Equal(t, []string{"emp_no"}, stream.KeyProperties)
+	assert.Contains(t, stream.Metadata.GetPropertyMap(), "emp_no")
+}
+
+func TestRecordTransformer_RejectsInvalidTransforms(t *testing.T) {
+	tests := []struct {
+		name       string
+		transforms map[string][]ColumnTransform
+		err        string
+	}{
+		{
+			name:       "unknown",
+			transforms: map[string][]ColumnTransform{"email": {{Type: "encrypt"}}},
+			err:        `unknown transform "encrypt" for property "email"`,
+		},
+		{
+			name:       "nullify key",
+			transforms: map[string][]ColumnTransform{"emp_no": {{Type: TransformNullify}}},
+			err:        `key property "emp_no" of stream "employees" cannot be nullified`,
+		},
+		{
+			name:       "truncate number",
+			transforms: map[string][]ColumnTransform{"emp_no": {{Type: TransformTruncate, Length: 2}}},
+			err:        "is not a string and cannot be truncated",
+		},
+		{
+			name:       "truncate to zero",
+			transforms: map[string][]ColumnTransform{"notes": {{Type: TransformTruncate}}},
+			err:        "must be truncated to a positive length",
+		},
+		{
+			name:       "rename collision",
+			transforms: map[string][]ColumnTransform{"email": {{Type: TransformRename, Name: "phone"}}},
+			err:        `would both be emitted as "phone"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewRecordTransformer(getTransformStream(t, tt.transforms))
+			assert.ErrorContains(t, err, tt.err)
+		})
+	}
+}
+
+func TestRecordTransformer_NilWithoutTransforms(t *testing.T) {
+	rt, err := NewRecordTransformer(getTransformStream(t, nil))
+	require.NoError(t, err)
+	assert.Nil(t, rt)
+
+	data := map[string]interface{}{"email": "georgi@example.com"}
+	assert.Equal(t, data, rt.Transform(data))
+}
+
+func TestSync_TransformsRecordsAndSchema(t *testing.T) {
+	catalog := getVerifyCatalog()
+	catalog.Streams[0].Metadata[2].Metadata.Transforms = []ColumnTransform{
+		{Type: TransformMask, Keep: 1},
+		{Type: TransformRename, Name: "initial"},
+	}
+
+	ped := &testPlanetScaleEdgeDatabase{
+		ReadParamsFn: func(ctx context.Context, params ReadParams) (*SerializedCursor, error) {
+			assert.ElementsMatch(t, []string{"emp_no", "first_name"}, params.Columns)
+			if err := params.OnResult(getVerifyResult("10001|Georgi")); err != nil {
+				return nil, err
+			}
+			return TableCursorToSerializedCursor(params.LastKnownPosition)
+		},
+	}
+	logger := &testSingerLogger{}
+
+	_, err := Sync(context.Background(), getTestMysqlAccess(), ped, logger, PlanetScaleSource{Database: "employees"}, catalog, nil, logger, SyncSettings{})
+	require.NoError(t, err)
+	require.Len(t, logger.streamSchemas, 1)
+	assert.Contains(t, logger.streamSchemas["employees"].Properties, "initial")
+	records := logger.records["employees"]
+	require.Len(t, records, 1)
+	assert.Equal(t, map[string]interface{}{"emp_no": int64(10001), "initial": "*****i"}, records[0].Data)
+}
+
+func TestVerify_ComparesTransformedRecords(t *testing.T) {
+	catalog := getVerifyCatalog()
+	catalog.Streams[0].Metadata[1].Metadata.Transforms = []ColumnTransform{{Type: TransformRename, Name: "id"}}
+	catalog.Streams[0].Metadata[2].Metadata.Transforms = []ColumnTransform{{Type: TransformHash}}
+
+	// export the rows as they would be emitted during a sync.
+	filtered, err := filterSchema(catalog)
+	require.NoError(t, err)
+	rt, err := NewRecordTransformer(filtered.Streams[0])
+	require.NoError(t, err)
+	export := writeVerifyExportWith(t, filtered.Streams[0], rt, "10001|Georgi", "10002|Bezalel")
+
+	tma := getVerifyMysqlAccess(t, "10001|Georgi", "10002|Bezalel")
+	report, err := Verify(context.Background(), tma, &testSingerLogger{}, PlanetScaleSource{Database: "employees"}, catalog, VerifySettings{ExportPaths: []string{export}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"id"}, report.Streams[0].KeyProperties)
+	assert.True(t, report.Matched)
+}
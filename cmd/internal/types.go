@@ -2,6 +2,7 @@ package internal
 
 import (
 	"encoding/base64"
+	"log/slog"
 	"strings"
 
 	"github.com/pkg/errors"
@@ -11,10 +12,14 @@ import (
 	"vitess.io/vitess/go/sqltypes"
 )
 
+// StatusLogger reports the progress of the tap, separately from the Singer messages it emits.
+// Each message can carry structured fields, see the *Key constants for well known field names.
 type StatusLogger interface {
 	Log(message string)
-	Info(message string)
-	Error(message string)
+	Debug(message string, attrs ...slog.Attr)
+	Info(message string, attrs ...slog.Attr)
+	Warn(message string, attrs ...slog.Attr)
+	Error(message string, attrs ...slog.Attr)
 }
 
 type RecordWriter interface {
@@ -112,6 +117,15 @@ type Stream struct {
 	CursorProperties []string `json:"bookmark_properties"`
 }
 
+// tableName returns the name of the table that a stream reads rows from, which is
+// the name of the stream if it has no table name.
+func (s Stream) tableName() string {
+	if len(s.TableName) > 0 {
+		return s.TableName
+	}
+	return s.Name
+}
+
 //func (c *Catalog) GetStreamSchema(streamName string) (StreamSchema, error) {
 //
 //}
@@ -123,8 +137,11 @@ type StreamSchema struct {
 }
 
 type StreamProperty struct {
-	Types        []string `json:"type"`
-	CustomFormat string   `json:"format,omitempty"`
+	Types        []string    `json:"type"`
+	CustomFormat string      `json:"format,omitempty"`
+	Description  string      `json:"description,omitempty"`
+	Default      interface{} `json:"default,omitempty"`
+	MaxLength    int64       `json:"maxLength,omitempty"`
 }
 
 func (s StreamProperty) IsBoolean() bool {
@@ -165,6 +182,10 @@ func (s *Stream) IncrementalSyncRequested() bool {
 		return false
 	}
 
+	// streams that discovery forces to be synced in full cannot be synced incrementally, whichever method was picked.
+	if tm.Metadata.ForcedReplicationMethod == "FULL_TABLE" {
+		return false
+	}
 	return tm.Metadata.ReplicationMethod == "INCREMENTAL"
 }
 
@@ -245,7 +266,7 @@ func (m MetadataCollection) GetPropertyMap() map[string]Metadata {
 func (m MetadataCollection) GetSelectedProperties() []string {
 	var properties []string
 	for _, nm := range m {
-		if len(nm.Metadata.BreadCrumb) > 0 && nm.Metadata.Selected {
+		if len(nm.Metadata.BreadCrumb) > 0 && nm.Metadata.Selected && nm.Metadata.Inclusion != "unsupported" {
 			// example for a stream: "breadcrumb": []
 			// example for a property: "breadcrumb": ["properties", "id"]
 			propertyName := nm.Metadata.BreadCrumb[len(nm.Metadata.BreadCrumb)-1]
@@ -369,9 +390,45 @@ type NodeMetadata struct {
 	// Name of database.
 	DatabaseName string `json:"database-name,omitempty"`
 
+	// The name of the source in the config that a stream is read from, for configs with several sources.
+	SourceName string `json:"source-name,omitempty"`
+
 	// Represents the datatype of a database column.
 	SqlDataType string `json:"sql-datatype,omitempty"`
 
+	// The position of a database column in its table, starting at 1.
+	OrdinalPosition int `json:"ordinal-position,omitempty"`
+
+	// A SQL expression that rows of a stream must satisfy to be synced, for example "created_at >= '2024-01-01'".
+	// It applies to both the initial copy of the table and all changes after it.
+	Filter string `json:"filter,omitempty"`
+
+	// The approximate number of rows in a table, recorded during discovery.
+	RowCount int64 `json:"row-count,omitempty"`
+
+	// Where an incrementally synced stream without state starts reading from,
+	// one of StartFromBeginning, StartFromNow or StartFromPosition.
+	StartFrom string `json:"start-from,omitempty"`
+
+	// The position to start reading every shard from, for streams that start from StartFromPosition.
+	StartPositions map[string]string `json:"start-positions,omitempty"`
+
+	// The number of chunks to split the initial copy of a table into, which are copied at the same time.
+	CopyChunks int `json:"copy-chunks,omitempty"`
+
+	// The maximum number of rows per second to read from a stream, in addition to the limits for all streams.
+	RowsPerSecond float64 `json:"rows-per-second,omitempty"`
+
+	// The maximum number of bytes of row values per second to read from a stream, in addition to the limits for all streams.
+	BytesPerSecond float64 `json:"bytes-per-second,omitempty"`
+
+	// Streams with a higher priority are synced before streams with a lower priority,
+	// streams with the same priority are synced in the order of the catalog.
+	SyncPriority int `json:"sync-priority,omitempty"`
+
+	// Transformations applied, in order, to the values of a property before they are emitted.
+	Transforms []ColumnTransform `json:"transforms,omitempty"`
+
 	// The breadcrumb object defines the path into the schema to the node to which the metadata belongs.
 	//  Metadata for a stream will have an empty breadcrumb.
 	// example for a stream: "breadcrumb": []
@@ -453,7 +510,25 @@ func NewRecord() Record {
 //	 }
 //	}
 type State struct {
-	Streams map[string]ShardStates `json:"bookmarks"`
+	// CurrentlySyncing is the name of the stream that was being synced when this state was emitted,
+	// it is empty once all streams have been synced.
+	CurrentlySyncing string `json:"currently_syncing,omitempty"`
+	// Snapshot is the position that all streams were read up to, for syncs with a consistent snapshot.
+	Snapshot *Snapshot `json:"snapshot,omitempty"`
+	// Copies is the progress of the tables that are being copied in chunks, by stream name.
+	Copies map[string]*TableCopy `json:"copies,omitempty"`
+	// Resnapshots is the progress of the tables that are being copied again while their changes are read, by stream name.
+	Resnapshots map[string]*Resnapshot `json:"resnapshots,omitempty"`
+	Streams     map[string]ShardStates `json:"bookmarks"`
+	// Sources is the state of every source, by source name, for configs with several sources.
+	Sources map[string]*State `json:"sources,omitempty"`
+}
+
+// Snapshot is the position of every shard in a keyspace at a single point in time.
+type Snapshot struct {
+	Keyspace string `json:"keyspace"`
+	// Shards maps the name of every shard to its position.
+	Shards map[string]string `json:"shards"`
 }
 
 type WrappedState struct {
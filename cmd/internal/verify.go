@@ -0,0 +1,345 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/pkg/errors"
+	"vitess.io/vitess/go/sqltypes"
+)
+
+const DefaultVerifyChunkSize = 10000
+
+// VerifySettings configures how the rows of selected streams are verified.
+type VerifySettings struct {
+	// ChunkSize is the number of rows, in primary key order, covered by each checksum.
+	ChunkSize int
+	// ExportPaths are files of Singer messages written by this tap, one JSON message per line,
+	// to compare the source against. If empty, the checksums of the source are only reported.
+	ExportPaths []string
+}
+
+// VerifyReport lists the row counts and checksums of every selected stream.
+// Checksums are computed over the records exactly as the tap would emit them:
+// every row is serialized to JSON with sorted keys and hashed with SHA-256,
+// the first 8 bytes of each hash are then XOR-ed together for all rows in a chunk.
+type VerifyReport struct {
+	Compared bool                  `json:"compared"`
+	Matched  bool                  `json:"matched"`
+	Streams  []*StreamVerification `json:"streams"`
+}
+
+type StreamVerification struct {
+	Stream            string            `json:"stream"`
+	KeyProperties     []string          `json:"key_properties"`
+	RowCount          int               `json:"row_count"`
+	ExportRowCount    *int              `json:"export_row_count,omitempty"`
+	MissingFromExport int               `json:"missing_from_export,omitempty"`
+	ExtraInExport     int               `json:"extra_in_export,omitempty"`
+	Matched           *bool             `json:"matched,omitempty"`
+	Chunks            []*ChunkChecksum  `json:"chunks"`
+	Error             string            `json:"error,omitempty"`
+	exportRows        map[string]uint64 `json:"-"`
+}
+
+type ChunkChecksum struct {
+	Index          int           `json:"index"`
+	FirstKey       []interface{} `json:"first_key"`
+	LastKey        []interface{} `json:"last_key"`
+	Rows           int           `json:"rows"`
+	Checksum       string        `json:"checksum"`
+	ExportRows     *int          `json:"export_rows,omitempty"`
+	ExportChecksum string        `json:"export_checksum,omitempty"`
+	Matched        *bool         `json:"matched,omitempty"`
+}
+
+// Verify computes row counts and checksums for all selected streams in the catalog,
+// and compares them against the records in any configured exports.
+func Verify(ctx context.Context, mysqlDatabase PlanetScaleEdgeMysqlAccess, logger Logger, source PlanetScaleSource, catalog Catalog, settings VerifySettings) (*VerifyReport, error) {
+	if settings.ChunkSize <= 0 {
+		settings.ChunkSize = DefaultVerifyChunkSize
+	}
+
+	filters, err := newRowFilters(catalog)
+	if err != nil {
+		return nil, err
+	}
+
+	filteredSchema, err := filterSchema(catalog)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to filter schema")
+	}
+
+	transformers, err := newRecordTransformers(filteredSchema)
+	if err != nil {
+		return nil, err
+	}
+
+	// records in exports are compared as they were emitted, after any transforms.
+	emittedSchema := Catalog{}
+	for _, stream := range filteredSchema.Streams {
+		emittedSchema.Streams = append(emittedSchema.Streams, transformers[stream.Name].Schema(stream))
+	}
+
+	report := &VerifyReport{
+		Compared: len(settings.ExportPaths) > 0,
+		Matched:  true,
+	}
+	for _, stream := range emittedSchema.Streams {
+		report.Streams = append(report.Streams, &StreamVerification{
+			Stream:        stream.Name,
+			KeyProperties: stream.KeyProperties,
+			Chunks:        []*ChunkChecksum{},
+		})
+	}
+
+	if report.Compared {
+		for _, path := range settings.ExportPaths {
+			logger.Info("reading export", slog.String("path", path))
+			if err := readExport(path, emittedSchema, report); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for i, stream := range filteredSchema.Streams {
+		sv := report.Streams[i]
+		if err := verifyStream(ctx, mysqlDatabase, logger, source, stream, filters[stream.Name], transformers[stream.Name], settings.ChunkSize, report.Compared, sv); err != nil {
+			return report, err
+		}
+		if sv.Matched != nil && !*sv.Matched {
+			report.Matched = false
+		}
+	}
+
+	return report, nil
+}
+
+func verifyStream(ctx context.Context, mysqlDatabase PlanetScaleEdgeMysqlAccess, logger Logger, source PlanetScaleSource, stream Stream, filter *RowFilter, transformer *RecordTransformer, chunkSize int, compare bool, sv *StreamVerification) error {
+	if len(stream.KeyProperties) == 0 {
+		sv.Error = "stream has no key properties to order rows by"
+		if compare {
+			sv.Matched = boolPointer(false)
+		}
+		return nil
+	}
+
+	columns := stream.Metadata.GetSelectedProperties()
+	for _, key := range stream.KeyProperties {
+		if !contains(columns, key) {
+			columns = append(columns, key)
+		}
+	}
+
+	var (
+		after []sqltypes.Value
+		where string
+	)
+	if filter != nil {
+		where = filter.SQL()
+	}
+	for {
+		qr, err := mysqlDatabase.GetTableRows(ctx, source, TableRowsQuery{
+			Table:      stream.tableName(),
+			Columns:    columns,
+			KeyColumns: stream.KeyProperties,
+			After:      after,
+			Where:      where,
+			Limit:      chunkSize,
+		})
+		if err != nil {
+			return errors.Wrapf(err, "unable to read rows for stream %q", stream.Name)
+		}
+		if len(qr.Rows) == 0 {
+			break
+		}
+
+		chunk, err := checksumChunk(qr, stream, transformer, len(sv.Chunks), sv.exportRows)
+		if err != nil {
+			return errors.Wrapf(err, "unable to checksum rows for stream %q", stream.Name)
+		}
+		sv.Chunks = append(sv.Chunks, chunk)
+		sv.RowCount += chunk.Rows
+		if chunk.ExportRows != nil {
+			sv.MissingFromExport += chunk.Rows - *chunk.ExportRows
+		}
+		logger.Debug("verified chunk", slog.String(StreamKey, stream.Name), slog.Int("chunk", chunk.Index), slog.Int(BatchSizeKey, chunk.Rows))
+
+		after = keyValues(qr, len(qr.Rows)-1, stream.KeyProperties)
+		if len(qr.Rows) < chunkSize {
+			break
+		}
+	}
+
+	if compare {
+		exportRowCount := sv.RowCount - sv.MissingFromExport + len(sv.exportRows)
+		sv.ExportRowCount = &exportRowCount
+		sv.ExtraInExport = len(sv.exportRows)
+		matched := sv.ExtraInExport == 0
+		for _, chunk := range sv.Chunks {
+			matched = matched && *chunk.Matched
+		}
+		sv.Matched = &matched
+	}
+	logger.Info("verified stream", slog.String(StreamKey, stream.Name), slog.Int("rows", sv.RowCount), slog.Int("chunks", len(sv.Chunks)))
+	return nil
+}
+
+// checksumChunk computes the checksum of all rows in qr as they would be emitted,
+// and if exported rows are provided, the checksum of the matching exported rows, which are then removed.
+func checksumChunk(qr *sqltypes.Result, stream Stream, transformer *RecordTransformer, index int, exportRows map[string]uint64) (*ChunkChecksum, error) {
+	keyProperties := transformer.Schema(stream).KeyProperties
+	var (
+		checksum, exportChecksum uint64
+		exported                 int
+	)
+
+	chunk := &ChunkChecksum{
+		Index: index,
+		Rows:  len(qr.Rows),
+	}
+	for i, datum := range QueryResultToRecords(qr) {
+		data, err := recordData(datum, stream)
+		if err != nil {
+			return nil, err
+		}
+		data = transformer.Transform(data)
+		key, keyJSON, err := recordKey(data, keyProperties)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			chunk.FirstKey = key
+		}
+		chunk.LastKey = key
+
+		rc, err := rowChecksum(data)
+		if err != nil {
+			return nil, err
+		}
+		checksum ^= rc
+
+		if exportRows != nil {
+			if ec, ok := exportRows[keyJSON]; ok {
+				exportChecksum ^= ec
+				exported++
+				delete(exportRows, keyJSON)
+			}
+		}
+	}
+
+	chunk.Checksum = fmt.Sprintf("%016x", checksum)
+	if exportRows != nil {
+		chunk.ExportRows = &exported
+		chunk.ExportChecksum = fmt.Sprintf("%016x", exportChecksum)
+		chunk.Matched = boolPointer(exported == chunk.Rows && exportChecksum == checksum)
+	}
+	return chunk, nil
+}
+
+// readExport reads Singer RECORD messages for the streams being verified,
+// later records for the same key replace earlier ones, just as they would in the warehouse.
+func readExport(path string, catalog Catalog, report *VerifyReport) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.Wrapf(err, "unable to read export at path %v", path)
+	}
+	defer f.Close()
+
+	streams := map[string]int{}
+	for i, stream := range catalog.Streams {
+		streams[stream.Name] = i
+		if report.Streams[i].exportRows == nil {
+			report.Streams[i].exportRows = map[string]uint64{}
+		}
+	}
+
+	decoder := json.NewDecoder(f)
+	for {
+		var message struct {
+			Type   string          `json:"type"`
+			Stream string          `json:"stream"`
+			Record json.RawMessage `json:"record"`
+		}
+		if err := decoder.Decode(&message); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return errors.Wrapf(err, "unable to parse export at path %v", path)
+		}
+
+		i, ok := streams[message.Stream]
+		if message.Type != "RECORD" || !ok {
+			continue
+		}
+
+		// decode numbers as written so that they serialize back to the same JSON.
+		var data map[string]interface{}
+		recordDecoder := json.NewDecoder(bytes.NewReader(message.Record))
+		recordDecoder.UseNumber()
+		if err := recordDecoder.Decode(&data); err != nil {
+			return errors.Wrapf(err, "unable to parse record in export at path %v", path)
+		}
+
+		_, keyJSON, err := recordKey(data, catalog.Streams[i].KeyProperties)
+		if err != nil {
+			return errors.Wrapf(err, "invalid record for stream %q in export at path %v", message.Stream, path)
+		}
+		rc, err := rowChecksum(data)
+		if err != nil {
+			return err
+		}
+		report.Streams[i].exportRows[keyJSON] = rc
+	}
+}
+
+// recordKey returns the values of the key properties of a record, along with their JSON serialization.
+func recordKey(data map[string]interface{}, keyProperties []string) ([]interface{}, string, error) {
+	key := make([]interface{}, 0, len(keyProperties))
+	for _, kp := range keyProperties {
+		v, ok := data[kp]
+		if !ok {
+			return nil, "", fmt.Errorf("key property %q is not selected", kp)
+		}
+		key = append(key, v)
+	}
+	b, err := json.Marshal(key)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "unable to serialize record key")
+	}
+	return key, string(b), nil
+}
+
+func rowChecksum(data map[string]interface{}) (uint64, error) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return 0, errors.Wrap(err, "unable to serialize record")
+	}
+	sum := sha256.Sum256(b)
+	return binary.BigEndian.Uint64(sum[:8]), nil
+}
+
+// keyValues returns the values of the key columns for a row in qr.
+func keyValues(qr *sqltypes.Result, row int, keyColumns []string) []sqltypes.Value {
+	values := make([]sqltypes.Value, 0, len(keyColumns))
+	for _, key := range keyColumns {
+		for i, field := range qr.Fields {
+			if field.Name == key {
+				values = append(values, qr.Rows[row][i])
+				break
+			}
+		}
+	}
+	return values
+}
+
+func boolPointer(b bool) *bool {
+	return &b
+}
@@ -0,0 +1,157 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"vitess.io/vitess/go/sqltypes"
+)
+
+func TestVerify_CanReportChecksums(t *testing.T) {
+	tma := getVerifyMysqlAccess(t, "10001|Georgi", "10002|Bezalel", "10003|Parto")
+	logger := NewLogger("test", &bytes.Buffer{}, &bytes.Buffer{})
+
+	report, err := Verify(context.Background(), tma, logger, PlanetScaleSource{Database: "employees"}, getVerifyCatalog(), VerifySettings{ChunkSize: 2})
+	require.NoError(t, err)
+	assert.False(t, report.Compared)
+	require.Len(t, report.Streams, 1)
+	sv := report.Streams[0]
+	assert.Equal(t, 3, sv.RowCount)
+	assert.Nil(t, sv.Matched)
+	require.Len(t, sv.Chunks, 2)
+	assert.Equal(t, []interface{}{int64(10001)}, sv.Chunks[0].FirstKey)
+	assert.Equal(t, []interface{}{int64(10002)}, sv.Chunks[0].LastKey)
+	assert.Equal(t, 1, sv.Chunks[1].Rows)
+	assert.Len(t, sv.Chunks[0].Checksum, 16)
+}
+
+func TestVerify_CanMatchExport(t *testing.T) {
+	tma := getVerifyMysqlAccess(t, "10001|Georgi", "10002|Bezalel", "10003|Parto")
+	logger := NewLogger("test", &bytes.Buffer{}, &bytes.Buffer{})
+	export := writeVerifyExport(t, "10001|Georgi", "10002|Bezalel", "10003|Parto")
+
+	report, err := Verify(context.Background(), tma, logger, PlanetScaleSource{Database: "employees"}, getVerifyCatalog(), VerifySettings{ChunkSize: 2, ExportPaths: []string{export}})
+	require.NoError(t, err)
+	assert.True(t, report.Compared)
+	assert.True(t, report.Matched)
+	sv := report.Streams[0]
+	assert.Equal(t, 3, *sv.ExportRowCount)
+	assert.True(t, *sv.Matched)
+	for _, chunk := range sv.Chunks {
+		assert.Equal(t, chunk.Checksum, chunk.ExportChecksum)
+	}
+}
+
+func TestVerify_CanDetectMismatchedExport(t *testing.T) {
+	tma := getVerifyMysqlAccess(t, "10001|Georgi", "10002|Bezalel", "10003|Parto")
+	logger := NewLogger("test", &bytes.Buffer{}, &bytes.Buffer{})
+	export := writeVerifyExport(t, "10001|Georgi", "10002|Bezalel-Changed", "10004|Chirstian")
+
+	report, err := Verify(context.Background(), tma, logger, PlanetScaleSource{Database: "employees"}, getVerifyCatalog(), VerifySettings{ChunkSize: 2, ExportPaths: []string{export}})
+	require.NoError(t, err)
+	assert.False(t, report.Matched)
+	sv := report.Streams[0]
+	assert.False(t, *sv.Matched)
+	assert.Equal(t, 1, sv.MissingFromExport)
+	assert.Equal(t, 1, sv.ExtraInExport)
+	assert.False(t, *sv.Chunks[0].Matched, "chunk with a changed row should not match")
+	assert.False(t, *sv.Chunks[1].Matched, "chunk with a missing row should not match")
+}
+
+func getVerifyCatalog() Catalog {
+	return Catalog{
+		Streams: []Stream{
+			{
+				Name:          "employees",
+				TableName:     "employees",
+				KeyProperties: []string{"emp_no"},
+				Schema: StreamSchema{
+					Properties: map[string]StreamProperty{
+						"emp_no":     {Types: []string{"null", "integer"}},
+						"first_name": {Types: []string{"null", "string"}},
+					},
+				},
+				Metadata: MetadataCollection{
+					{
+						Metadata: NodeMetadata{
+							Selected:   true,
+							BreadCrumb: []string{},
+						},
+					},
+					{
+						Metadata: NodeMetadata{
+							Selected:   true,
+							Inclusion:  "automatic",
+							BreadCrumb: []string{"properties", "emp_no"},
+						},
+					},
+					{
+						Metadata: NodeMetadata{
+							Selected:   true,
+							BreadCrumb: []string{"properties", "first_name"},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func getVerifyResult(rows ...string) *sqltypes.Result {
+	return sqltypes.MakeTestResult(sqltypes.MakeTestFields("emp_no|first_name", "int64|varchar"), rows...)
+}
+
+// getVerifyMysqlAccess returns a mysql mock that pages through the given rows, ordered by emp_no.
+func getVerifyMysqlAccess(t *testing.T, rows ...string) *mysqlAccessMock {
+	all := getVerifyResult(rows...)
+	tma := getTestMysqlAccess()
+	tma.GetTableRowsFn = func(ctx context.Context, psc PlanetScaleSource, query TableRowsQuery) (*sqltypes.Result, error) {
+		assert.Equal(t, []string{"emp_no"}, query.KeyColumns)
+		qr := &sqltypes.Result{Fields: all.Fields}
+		for _, row := range all.Rows {
+			if len(query.After) > 0 {
+				after, _ := query.After[0].ToInt64()
+				current, _ := row[0].ToInt64()
+				if current <= after {
+					continue
+				}
+			}
+			if len(qr.Rows) == query.Limit {
+				break
+			}
+			qr.Rows = append(qr.Rows, row)
+		}
+		return qr, nil
+	}
+	return tma
+}
+
+// writeVerifyExport writes the given rows as the tap would write them to stdout.
+func writeVerifyExport(t *testing.T, rows ...string) string {
+	filtered, err := filterSchema(getVerifyCatalog())
+	require.NoError(t, err)
+	return writeVerifyExportWith(t, filtered.Streams[0], nil, rows...)
+}
+
+// writeVerifyExportWith writes the given rows of a filtered stream, transformed as they would be during a sync.
+func writeVerifyExportWith(t *testing.T, stream Stream, transformer *RecordTransformer, rows ...string) string {
+	var stdout bytes.Buffer
+	logger := NewLogger("test", &stdout, &bytes.Buffer{})
+
+	require.NoError(t, logger.StreamSchema(transformer.Schema(stream)))
+	_, err := printQueryResult(getVerifyResult(rows...), stream, transformer.Schema(stream), nil, transformer, logger)
+	require.NoError(t, err)
+	require.NoError(t, logger.Flush(stream))
+	require.NoError(t, logger.State(State{}))
+	assert.Equal(t, len(rows)+2, strings.Count(stdout.String(), "\n"))
+
+	path := filepath.Join(t.TempDir(), "export.jsonl")
+	require.NoError(t, os.WriteFile(path, stdout.Bytes(), 0o644))
+	return path
+}
@@ -0,0 +1,328 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	psdbconnect "github.com/planetscale/airbyte-source/proto/psdbconnect/v1alpha1"
+	grpcclient "github.com/planetscale/psdb/core/pool"
+	clientoptions "github.com/planetscale/psdb/core/pool/options"
+	"go.opentelemetry.io/otel/attribute"
+	"google.golang.org/grpc"
+	"vitess.io/vitess/go/mysql"
+	"vitess.io/vitess/go/sqltypes"
+	vtgrpcclient "vitess.io/vitess/go/vt/grpcclient"
+	binlogdatapb "vitess.io/vitess/go/vt/proto/binlogdata"
+	querypb "vitess.io/vitess/go/vt/proto/query"
+	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+	vtgatepb "vitess.io/vitess/go/vt/proto/vtgate"
+	vtgateservicepb "vitess.io/vitess/go/vt/proto/vtgateservice"
+)
+
+func NewVitess(mysql PlanetScaleEdgeMysqlAccess, logger Logger, throttle *Throttle) PlanetScaleDatabase {
+	return &VitessDatabase{
+		Mysql:    mysql,
+		Logger:   logger,
+		Throttle: throttle,
+	}
+}
+
+// VitessDatabase is an implementation of the PlanetScaleDatabase interface for self-hosted Vitess clusters.
+// It uses vtgate's mysql protocol for all schema/shard/tablet discovery and
+// vtgate's VStream gRPC API for incrementally syncing rows.
+type VitessDatabase struct {
+	Logger Logger
+	Mysql  PlanetScaleEdgeMysqlAccess
+	// Throttle limits how fast rows are read, reads are not limited if nil.
+	Throttle *Throttle
+	clientFn func(ctx context.Context, ps PlanetScaleSource) (vtgateservicepb.VitessClient, error)
+}
+
+func (p VitessDatabase) CanConnect(ctx context.Context, psc PlanetScaleSource) error {
+	return p.Mysql.PingContext(ctx, psc)
+}
+
+func (p VitessDatabase) LatestPosition(ctx context.Context, params ReadParams) (string, error) {
+	tc := params.LastKnownPosition
+	return p.getLatestCursorPosition(ctx, tc.Shard, tc.Keyspace, params.Table, params.Source, params.TabletType, params.Cells)
+}
+
+func (p VitessDatabase) Close() error {
+	return p.Mysql.Close()
+}
+
+// Read streams rows from a table given a starting cursor, see readShard.
+// A cursor without a position, or with the last primary key that was copied, starts or resumes
+// the copy phase of the VStream, which selects all rows of the table before streaming changes to them.
+func (p VitessDatabase) Read(ctx context.Context, params ReadParams) (*SerializedCursor, error) {
+	return readShard(ctx, "VitessDatabase", p, p.Logger, p.Throttle, params)
+}
+
+// getLatestCursorPosition returns the GTID position of a shard, which VStream takes as the position of a VGTID.
+// The position is read from a tablet of the given type, in any cell, as a connection can't be targeted at cells.
+func (p VitessDatabase) getLatestCursorPosition(ctx context.Context, shard, keyspace string, s Stream, ps PlanetScaleSource, tabletType psdbconnect.TabletType, cells []string) (_ string, err error) {
+	ctx, span := startSpan(ctx, "VitessDatabase.getLatestCursorPosition",
+		streamAttribute.String(s.Name),
+		shardAttribute.String(shard),
+		tabletTypeAttribute.String(tabletType.String()),
+	)
+	defer func() { endSpan(span, err) }()
+
+	return p.Mysql.GetShardPosition(ctx, ps, shard, tabletType)
+}
+
+func (p VitessDatabase) sync(ctx context.Context, tc *psdbconnect.TableCursor, stopPosition string, readDuration time.Duration, params ReadParams) (_ *psdbconnect.TableCursor, err error) {
+	defer p.Logger.Flush(params.Table)
+	// waiting for the throttle may outlast the read duration, so that a response is never read in part.
+	throttleCtx := ctx
+	if readDuration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, readDuration)
+		defer cancel()
+	}
+
+	rows := 0
+	ctx, span := startSpan(ctx, "VitessDatabase.sync",
+		streamAttribute.String(params.Table.Name),
+		shardAttribute.String(tc.Shard),
+		positionAttribute.String(tc.Position),
+	)
+	defer func() {
+		span.SetAttributes(attribute.Int("rows", rows))
+		if errors.Is(err, io.EOF) {
+			endSpan(span, nil)
+			return
+		}
+		endSpan(span, err)
+	}()
+
+	var stop mysql.Position
+	if len(stopPosition) > 0 {
+		if stop, err = mysql.DecodePosition(stopPosition); err != nil {
+			return tc, errors.Wrapf(err, "unable to decode stop position %q", stopPosition)
+		}
+	}
+
+	client, closeClient, err := p.client(ctx, params.Source)
+	if err != nil {
+		return tc, err
+	}
+	defer closeClient()
+
+	c, err := client.VStream(ctx, vstreamRequest(tc, params))
+	if err != nil {
+		return tc, err
+	}
+
+	// rows are only synced once the VGTID event that follows them shows which position they were written at.
+	var (
+		copying = len(tc.Position) == 0 || tc.LastKnownPk != nil
+		fields  []*querypb.Field
+		pending []*sqltypes.Result
+	)
+	flush := func() error {
+		for _, result := range pending {
+			rows++
+			if err := p.Throttle.wait(throttleCtx, params.Table, result); err != nil {
+				return err
+			}
+			if params.OnResult != nil {
+				if err := params.OnResult(result); err != nil {
+					return err
+				}
+			}
+		}
+		pending = nil
+		return nil
+	}
+	advance := func(next *psdbconnect.TableCursor) error {
+		tc = next
+		if params.OnCursor != nil {
+			return params.OnCursor(tc)
+		}
+		return nil
+	}
+	reachedStop := func() bool {
+		if copying || params.Continuous || len(stopPosition) == 0 {
+			return false
+		}
+		position, err := mysql.DecodePosition(tc.Position)
+		return err == nil && position.AtLeast(stop)
+	}
+
+	for {
+		res, err := c.Recv()
+		if err != nil {
+			return tc, err
+		}
+
+		for _, event := range res.Events {
+			switch event.Type {
+			case binlogdatapb.VEventType_FIELD:
+				if vstreamTableName(event.FieldEvent.TableName, tc.Keyspace) == params.Table.tableName() {
+					fields = event.FieldEvent.Fields
+				}
+			case binlogdatapb.VEventType_ROW:
+				if vstreamTableName(event.RowEvent.TableName, tc.Keyspace) != params.Table.tableName() {
+					continue
+				}
+				for _, change := range event.RowEvent.RowChanges {
+					// deletes leave no row behind, and are not synced.
+					if change.After == nil {
+						continue
+					}
+					pending = append(pending, &sqltypes.Result{
+						Fields: fields,
+						Rows:   []sqltypes.Row{sqltypes.MakeRowTrusted(fields, change.After)},
+					})
+				}
+			case binlogdatapb.VEventType_VGTID:
+				shardGtid := findShardGtid(event.Vgtid, tc.Keyspace, tc.Shard)
+				if shardGtid == nil {
+					continue
+				}
+				// when reading up to a fixed position, rows past it are left for the next sync session.
+				if !copying && len(params.StopPosition) > 0 {
+					position, err := mysql.DecodePosition(shardGtid.Gtid)
+					if err != nil {
+						return tc, errors.Wrapf(err, "unable to decode position %q", shardGtid.Gtid)
+					}
+					if !stop.AtLeast(position) {
+						return tc, io.EOF
+					}
+				}
+				if err := flush(); err != nil {
+					return tc, err
+				}
+				next := &psdbconnect.TableCursor{
+					Shard:    tc.Shard,
+					Keyspace: tc.Keyspace,
+					Position: shardGtid.Gtid,
+				}
+				if copying {
+					next.LastKnownPk = tc.LastKnownPk
+					for _, tablePK := range shardGtid.TablePKs {
+						if vstreamTableName(tablePK.TableName, tc.Keyspace) == params.Table.tableName() {
+							next.LastKnownPk = tablePK.Lastpk
+						}
+					}
+				}
+				if err := advance(next); err != nil {
+					return tc, err
+				}
+				if reachedStop() {
+					return tc, io.EOF
+				}
+			case binlogdatapb.VEventType_COPY_COMPLETED:
+				// the copy phase of a shard is complete once an event for the shard, or for all shards, says so.
+				if !copying || (len(event.Keyspace) > 0 && (event.Keyspace != tc.Keyspace || event.Shard != tc.Shard)) {
+					continue
+				}
+				if err := flush(); err != nil {
+					return tc, err
+				}
+				copying = false
+				if err := advance(&psdbconnect.TableCursor{Shard: tc.Shard, Keyspace: tc.Keyspace, Position: tc.Position}); err != nil {
+					return tc, err
+				}
+				if reachedStop() {
+					return tc, io.EOF
+				}
+			}
+		}
+	}
+}
+
+// client returns a client of the vtgate VStream API of a source, along with a function that closes it.
+func (p VitessDatabase) client(ctx context.Context, ps PlanetScaleSource) (vtgateservicepb.VitessClient, func(), error) {
+	if p.clientFn != nil {
+		client, err := p.clientFn(ctx, ps)
+		return client, func() {}, err
+	}
+
+	opts, err := ps.grpcOptions()
+	if err != nil {
+		return nil, nil, err
+	}
+	var dialOptions []grpc.DialOption
+	// vtgate authenticates gRPC calls with the same static credentials as mysql connections.
+	if len(ps.Username) > 0 {
+		dialOptions = append(dialOptions, grpc.WithPerRPCCredentials(&vtgrpcclient.StaticAuthClientCreds{
+			Username: ps.Username,
+			Password: ps.Password,
+		}))
+	}
+	conn, err := grpcclient.Dial(ctx, ps.grpcHost(), append(opts,
+		clientoptions.WithConnectionPool(1),
+		clientoptions.WithExtraDialOptions(dialOptions),
+	)...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return vtgateservicepb.NewVitessClient(conn), func() { conn.Close() }, nil
+}
+
+// vstreamRequest returns the request to stream the rows of a table in a shard from a cursor.
+func vstreamRequest(tc *psdbconnect.TableCursor, params ReadParams) *vtgatepb.VStreamRequest {
+	shardGtid := &binlogdatapb.ShardGtid{
+		Keyspace: tc.Keyspace,
+		Shard:    tc.Shard,
+		Gtid:     tc.Position,
+	}
+	if tc.LastKnownPk != nil {
+		filterFields(tc.LastKnownPk, params.Table)
+		shardGtid.TablePKs = []*binlogdatapb.TableLastPK{{
+			TableName: params.Table.tableName(),
+			Lastpk:    tc.LastKnownPk,
+		}}
+	}
+
+	rule := &binlogdatapb.Rule{Match: params.Table.tableName()}
+	if len(params.Columns) > 0 {
+		columns := make([]string, 0, len(params.Columns))
+		for _, column := range params.Columns {
+			columns = append(columns, quoteIdentifier(column))
+		}
+		rule.Filter = fmt.Sprintf("select %v from %v", strings.Join(columns, ", "), quoteIdentifier(params.Table.tableName()))
+	}
+
+	return &vtgatepb.VStreamRequest{
+		TabletType: topoTabletType(params.TabletType),
+		Vgtid:      &binlogdatapb.VGtid{ShardGtids: []*binlogdatapb.ShardGtid{shardGtid}},
+		Filter:     &binlogdatapb.Filter{Rules: []*binlogdatapb.Rule{rule}},
+		Flags:      &vtgatepb.VStreamFlags{Cells: strings.Join(params.Cells, ",")},
+	}
+}
+
+// findShardGtid returns the position of a shard in a VGTID, or nil if it has none.
+func findShardGtid(vgtid *binlogdatapb.VGtid, keyspace, shard string) *binlogdatapb.ShardGtid {
+	if vgtid == nil {
+		return nil
+	}
+	for _, shardGtid := range vgtid.ShardGtids {
+		if shardGtid.Keyspace == keyspace && shardGtid.Shard == shard {
+			return shardGtid
+		}
+	}
+	return nil
+}
+
+// vstreamTableName returns the name of a table in a VStream event, which vtgate qualifies with its keyspace.
+func vstreamTableName(name, keyspace string) string {
+	return strings.TrimPrefix(name, keyspace+".")
+}
+
+// topoTabletType is a tablet type as the vtgate API takes it.
+func topoTabletType(tabletType psdbconnect.TabletType) topodatapb.TabletType {
+	switch tabletType {
+	case psdbconnect.TabletType_replica:
+		return topodatapb.TabletType_REPLICA
+	case psdbconnect.TabletType_read_only:
+		return topodatapb.TabletType_RDONLY
+	}
+	return topodatapb.TabletType_PRIMARY
+}
@@ -0,0 +1,226 @@
+package internal
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	psdbconnect "github.com/planetscale/airbyte-source/proto/psdbconnect/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"vitess.io/vitess/go/sqltypes"
+	binlogdatapb "vitess.io/vitess/go/vt/proto/binlogdata"
+	querypb "vitess.io/vitess/go/vt/proto/query"
+	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+	vtgatepb "vitess.io/vitess/go/vt/proto/vtgate"
+	vtgateservicepb "vitess.io/vitess/go/vt/proto/vtgateservice"
+)
+
+const (
+	vitessPosition1 = "MySQL56/3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5"
+	vitessPosition2 = "MySQL56/3e11fa47-71ca-11e1-9e33-c80aa9429562:1-7"
+	vitessPosition3 = "MySQL56/3e11fa47-71ca-11e1-9e33-c80aa9429562:1-9"
+)
+
+func getVitessDatabase(latestPosition string, events ...[]*binlogdatapb.VEvent) (*VitessDatabase, *vitessClientMock) {
+	tma := getTestMysqlAccess()
+	tma.GetShardPositionFn = func(ctx context.Context, psc PlanetScaleSource, shard string, tabletType psdbconnect.TabletType) (string, error) {
+		return latestPosition, nil
+	}
+	var responses []*vtgatepb.VStreamResponse
+	for _, e := range events {
+		responses = append(responses, &vtgatepb.VStreamResponse{Events: e})
+	}
+	client := &vitessClientMock{
+		vstreamFn: func(ctx context.Context, in *vtgatepb.VStreamRequest, opts ...grpc.CallOption) (vtgateservicepb.Vitess_VStreamClient, error) {
+			return &vstreamClientMock{responses: responses}, nil
+		},
+	}
+	vd := &VitessDatabase{
+		Logger: &testSingerLogger{},
+		Mysql:  tma,
+		clientFn: func(ctx context.Context, ps PlanetScaleSource) (vtgateservicepb.VitessClient, error) {
+			return client, nil
+		},
+	}
+	return vd, client
+}
+
+var vitessFields = []*querypb.Field{
+	{Name: "emp_no", Type: querypb.Type_INT64},
+	{Name: "first_name", Type: querypb.Type_VARCHAR},
+}
+
+func vitessFieldEvent() *binlogdatapb.VEvent {
+	return &binlogdatapb.VEvent{
+		Type:       binlogdatapb.VEventType_FIELD,
+		FieldEvent: &binlogdatapb.FieldEvent{TableName: "employees.employees", Fields: vitessFields},
+	}
+}
+
+// vitessRowEvent returns an event that changes the rows of employees to the given first names, or deletes them if empty.
+func vitessRowEvent(firstNames ...string) *binlogdatapb.VEvent {
+	event := &binlogdatapb.VEvent{
+		Type:     binlogdatapb.VEventType_ROW,
+		RowEvent: &binlogdatapb.RowEvent{TableName: "employees.employees"},
+	}
+	for i, firstName := range firstNames {
+		row := sqltypes.RowToProto3([]sqltypes.Value{sqltypes.NewInt64(int64(i + 1)), sqltypes.NewVarChar(firstName)})
+		change := &binlogdatapb.RowChange{After: row}
+		if len(firstName) == 0 {
+			change = &binlogdatapb.RowChange{Before: row}
+		}
+		event.RowEvent.RowChanges = append(event.RowEvent.RowChanges, change)
+	}
+	return event
+}
+
+func vitessVgtidEvent(position string, lastPK *querypb.QueryResult) *binlogdatapb.VEvent {
+	shardGtid := &binlogdatapb.ShardGtid{Keyspace: "employees", Shard: "-", Gtid: position}
+	if lastPK != nil {
+		shardGtid.TablePKs = []*binlogdatapb.TableLastPK{{TableName: "employees", Lastpk: lastPK}}
+	}
+	return &binlogdatapb.VEvent{
+		Type:  binlogdatapb.VEventType_VGTID,
+		Vgtid: &binlogdatapb.VGtid{ShardGtids: []*binlogdatapb.ShardGtid{shardGtid}},
+	}
+}
+
+func readVitess(t *testing.T, vd *VitessDatabase, tc *psdbconnect.TableCursor, stopPosition string) ([]string, *psdbconnect.TableCursor) {
+	var firstNames []string
+	sc, err := vd.Read(context.Background(), ReadParams{
+		Source:            PlanetScaleSource{Database: "employees"},
+		Table:             Stream{Name: "employees", KeyProperties: []string{"emp_no"}},
+		LastKnownPosition: tc,
+		StopPosition:      stopPosition,
+		TabletType:        psdbconnect.TabletType_primary,
+		OnResult: func(result *sqltypes.Result) error {
+			for _, row := range result.Rows {
+				firstNames = append(firstNames, row[1].ToString())
+			}
+			return nil
+		},
+	})
+	require.NoError(t, err)
+	cursor, err := sc.SerializedCursorToTableCursor()
+	require.NoError(t, err)
+	return firstNames, cursor
+}
+
+func TestVitessRead_CopiesTableThenStreamsChanges(t *testing.T) {
+	lastPK := &querypb.QueryResult{Fields: vitessFields[:1], Rows: []*querypb.Row{sqltypes.RowToProto3([]sqltypes.Value{sqltypes.NewInt64(2)})}}
+	vd, client := getVitessDatabase(vitessPosition2,
+		[]*binlogdatapb.VEvent{vitessFieldEvent(), vitessRowEvent("Georgi", "Bezalel"), vitessVgtidEvent(vitessPosition1, lastPK)},
+		[]*binlogdatapb.VEvent{{Type: binlogdatapb.VEventType_COPY_COMPLETED, Keyspace: "employees", Shard: "-"}},
+		// deletes are not synced.
+		[]*binlogdatapb.VEvent{vitessRowEvent("", "Parto"), vitessVgtidEvent(vitessPosition2, nil)},
+		[]*binlogdatapb.VEvent{vitessRowEvent("Chirstian"), vitessVgtidEvent(vitessPosition3, nil)},
+	)
+
+	firstNames, cursor := readVitess(t, vd, &psdbconnect.TableCursor{Keyspace: "employees", Shard: "-"}, "")
+	assert.Equal(t, []string{"Georgi", "Bezalel", "Parto"}, firstNames)
+	assert.Equal(t, vitessPosition2, cursor.Position)
+	assert.Nil(t, cursor.LastKnownPk)
+
+	require.Len(t, client.vstreamRequests, 1)
+	request := client.vstreamRequests[0]
+	assert.Equal(t, topodatapb.TabletType_PRIMARY, request.TabletType)
+	assert.Equal(t, &binlogdatapb.ShardGtid{Keyspace: "employees", Shard: "-"}, request.Vgtid.ShardGtids[0])
+	assert.Equal(t, "employees", request.Filter.Rules[0].Match)
+}
+
+func TestVitessRead_ResumesCopyFromLastPrimaryKey(t *testing.T) {
+	lastPK := &querypb.QueryResult{Fields: vitessFields, Rows: []*querypb.Row{sqltypes.RowToProto3([]sqltypes.Value{sqltypes.NewInt64(2), sqltypes.NewVarChar("Bezalel")})}}
+	vd, client := getVitessDatabase(vitessPosition1,
+		[]*binlogdatapb.VEvent{vitessFieldEvent(), vitessRowEvent("Georgi", "Bezalel", "Parto"), vitessVgtidEvent(vitessPosition1, lastPK)},
+	)
+
+	// the copy phase is read from even though the shard has not moved since it started.
+	firstNames, cursor := readVitess(t, vd, &psdbconnect.TableCursor{Keyspace: "employees", Shard: "-", Position: vitessPosition1, LastKnownPk: lastPK}, "")
+	assert.Equal(t, []string{"Georgi", "Bezalel", "Parto"}, firstNames)
+	assert.Equal(t, vitessPosition1, cursor.Position)
+	assert.NotNil(t, cursor.LastKnownPk)
+
+	require.Len(t, client.vstreamRequests, 1)
+	tablePKs := client.vstreamRequests[0].Vgtid.ShardGtids[0].TablePKs
+	require.Len(t, tablePKs, 1)
+	assert.Equal(t, "employees", tablePKs[0].TableName)
+	// only the key columns of the last primary key are sent.
+	assert.Equal(t, []*querypb.Field{vitessFields[0]}, tablePKs[0].Lastpk.Fields)
+}
+
+func TestVitessRead_StopsAtStopPosition(t *testing.T) {
+	vd, _ := getVitessDatabase(vitessPosition3,
+		[]*binlogdatapb.VEvent{vitessFieldEvent(), vitessRowEvent("Georgi"), vitessVgtidEvent(vitessPosition2, nil)},
+		[]*binlogdatapb.VEvent{vitessRowEvent("Bezalel"), vitessVgtidEvent(vitessPosition3, nil)},
+	)
+
+	firstNames, cursor := readVitess(t, vd, &psdbconnect.TableCursor{Keyspace: "employees", Shard: "-", Position: vitessPosition1}, vitessPosition2)
+	assert.Equal(t, []string{"Georgi"}, firstNames)
+	assert.Equal(t, vitessPosition2, cursor.Position)
+}
+
+func TestVitessRead_ExitsWithoutNewPositions(t *testing.T) {
+	vd, client := getVitessDatabase(vitessPosition1)
+	firstNames, cursor := readVitess(t, vd, &psdbconnect.TableCursor{Keyspace: "employees", Shard: "-", Position: vitessPosition1}, "")
+	assert.Empty(t, firstNames)
+	assert.Equal(t, vitessPosition1, cursor.Position)
+	assert.Empty(t, client.vstreamRequests)
+}
+
+func TestVitessLatestPosition_ReadsFromRoutedTabletType(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	defer db.Close()
+
+	// the position is read from the tablet type that the read was routed to, rather than the one the connection is targeted at.
+	mock.ExpectExec("use `employees:-@replica`").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("select @@global.gtid_executed").
+		WillReturnRows(sqlmock.NewRows([]string{"@@global.gtid_executed"}).AddRow("3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5"))
+	mock.ExpectExec("use `employees@primary`").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	vd := VitessDatabase{
+		Logger: &testSingerLogger{},
+		Mysql:  planetScaleEdgeMySQLAccess{db: db, tabletType: psdbconnect.TabletType_primary},
+	}
+	position, err := vd.LatestPosition(context.Background(), ReadParams{
+		Source:            PlanetScaleSource{Database: "employees"},
+		Table:             Stream{Name: "employees"},
+		LastKnownPosition: &psdbconnect.TableCursor{Shard: "-", Keyspace: "employees"},
+		TabletType:        psdbconnect.TabletType_replica,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, vitessPosition1, position)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestVStreamRequest_SelectsColumnsFromTablets(t *testing.T) {
+	request := vstreamRequest(&psdbconnect.TableCursor{Keyspace: "employees", Shard: "-80", Position: vitessPosition1}, ReadParams{
+		Table:      Stream{Name: "employees"},
+		Columns:    []string{"emp_no", "first_name"},
+		TabletType: psdbconnect.TabletType_read_only,
+		Cells:      []string{"zone1", "zone2"},
+	})
+	assert.Equal(t, "select `emp_no`, `first_name` from `employees`", request.Filter.Rules[0].Filter)
+	assert.Equal(t, topodatapb.TabletType_RDONLY, request.TabletType)
+	assert.Equal(t, "zone1,zone2", request.Flags.Cells)
+	assert.Equal(t, vitessPosition1, request.Vgtid.ShardGtids[0].Gtid)
+}
+
+func TestNewDatabase_PicksFlavor(t *testing.T) {
+	db, err := NewDatabase(PlanetScaleSource{}, getTestMysqlAccess(), &testSingerLogger{}, nil)
+	require.NoError(t, err)
+	assert.IsType(t, &PlanetScaleEdgeDatabase{}, db)
+
+	db, err = NewDatabase(PlanetScaleSource{Flavor: "vitess"}, getTestMysqlAccess(), &testSingerLogger{}, nil)
+	require.NoError(t, err)
+	assert.IsType(t, &VitessDatabase{}, db)
+
+	db, err = NewDatabase(PlanetScaleSource{Flavor: "mysql"}, getTestMysqlAccess(), &testSingerLogger{}, nil)
+	require.NoError(t, err)
+	assert.IsType(t, &MySQLBinlogDatabase{}, db)
+
+	_, err = NewDatabase(PlanetScaleSource{Flavor: "postgres"}, getTestMysqlAccess(), &testSingerLogger{}, nil)
+	assert.EqualError(t, err, `unsupported flavor "postgres", must be one of planetscale, vitess, mysql`)
+}
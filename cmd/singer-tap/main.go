@@ -2,10 +2,16 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"log/slog"
+	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
 
 	psdbconnect "github.com/planetscale/airbyte-source/proto/psdbconnect/v1alpha1"
 
@@ -27,11 +33,43 @@ var (
 	treatTinyIntAsBoolean bool
 	useReplica            bool
 	useReadOnly           bool
+	includedTables        string
 	excludedTables        string
 	singerAPIURL          string
 	batchSize             int
 	apiToken              string
 	stateDirectory        string
+	stateLocation         string
+	stateKeepLast         int
+	stateMaxAge           time.Duration
+	rollbackTo            string
+	checkpointRows        int
+	checkpointInterval    time.Duration
+	streamOrder           string
+	consistentSnapshot    bool
+	continuous            bool
+	heartbeatInterval     time.Duration
+	healthAddress         string
+	startFrom             string
+	copyChunks            int
+	resnapshot            string
+	maxRowsPerSecond      float64
+	maxBytesPerSecond     float64
+	adaptiveThrottle      bool
+	maxReplicaLag         time.Duration
+	replicaLagWait        time.Duration
+	replicaLagFallback    bool
+	logFormat             string
+	logLevel              string
+	traceExporter         string
+	traceEndpoint         string
+	traceInsecure         bool
+	traceFilePath         string
+	reportFilePath        string
+	verifyMode            bool
+	verifyExports         string
+	verifyChunkSize       int
+	sampleRows            int
 )
 
 func init() {
@@ -42,38 +80,109 @@ func init() {
 	flag.BoolVar(&autoSelect, "auto-select", false, "(discover mode only) select all tables & columns in the schema")
 	flag.BoolVar(&treatTinyIntAsBoolean, "tinyint-as-boolean", false, "(discover mode only) if true, tinyint(1) will be represented as booleans")
 	flag.BoolVar(&useIncrementalSync, "incremental", true, "(discover mode only) all tables & views will be synced incrementally")
+	flag.StringVar(&includedTables, "tables", "", "(discover mode only) comma separated list of tables & views to discover, all of them are discovered if empty.")
 	flag.StringVar(&excludedTables, "excluded-tables", "", "(discover mode only) comma separated list of tables & views to exclude.")
-	flag.BoolVar(&useReplica, "use-replica", false, "(sync mode only) use a replica tablet to stream rows from PlanetScale")
-	flag.BoolVar(&useReadOnly, "use-rdonly", false, "(sync mode only) use a readonly tablet to stream rows from PlanetScale")
+	flag.BoolVar(&useReplica, "use-replica", false, "(sync mode only) use a replica tablet to stream rows from PlanetScale, unless tablet_types is set in the config")
+	flag.BoolVar(&useReadOnly, "use-rdonly", false, "(sync mode only) use a readonly tablet to stream rows from PlanetScale, unless tablet_types is set in the config")
+	flag.IntVar(&sampleRows, "sample", 0, "(sync mode only) preview the first N rows of every selected stream without reading or writing state")
+	flag.IntVar(&checkpointRows, "checkpoint-rows", 0, "(sync mode only) emit state for incrementally synced streams after this many rows, 0 to disable")
+	flag.DurationVar(&checkpointInterval, "checkpoint-interval", 5*time.Minute, "(sync mode only) emit state for incrementally synced streams at this interval while they are read, 0 to disable")
+	flag.BoolVar(&consistentSnapshot, "consistent-snapshot", false, "(sync mode only) read all streams up to the position the shards were at when the sync started")
+	flag.BoolVar(&continuous, "continuous", false, "(sync mode only) keep reading changes to incrementally synced streams after they have caught up, until the tap is stopped")
+	flag.DurationVar(&heartbeatInterval, "heartbeat-interval", 30*time.Second, "(continuous mode only) emit state at this interval when no state was emitted otherwise, 0 to disable")
+	flag.StringVar(&healthAddress, "health-address", "", "(continuous mode only) host:port to serve the health of the sync on at /healthz, disabled if empty")
+	flag.StringVar(&startFrom, "start-from", internal.StartFromBeginning, "(sync mode only) where incrementally synced streams without state start from, one of beginning, now; can be set per stream with start-from metadata, starting from a timestamp is not supported")
+	flag.IntVar(&copyChunks, "copy-chunks", 0, "(sync mode only) copy the existing rows of incrementally synced streams in this many primary key ranges at once, 0 or 1 to copy them in one pass; can be set per stream with copy-chunks metadata")
+	flag.StringVar(&resnapshot, "resnapshot", "", "(sync mode only) comma separated list of incrementally synced streams to copy again while reading their changes")
+	flag.DurationVar(&maxReplicaLag, "max-replica-lag", 0, "(sync mode only) only read shards from replica or rdonly tablets that are at most this far behind their primary, 0 to not check")
+	flag.DurationVar(&replicaLagWait, "replica-lag-wait", 0, "(sync mode only) how long to wait for replication lag to drop below --max-replica-lag before giving up on a shard")
+	flag.BoolVar(&replicaLagFallback, "replica-lag-fallback", false, "(sync mode only) read from the primary tablet when replication lag stays above --max-replica-lag, instead of failing")
+	flag.Float64Var(&maxRowsPerSecond, "max-rows-per-second", 0, "(sync mode only) maximum rows per second to read across all streams, 0 for no limit; can be set per stream with rows-per-second metadata")
+	flag.Float64Var(&maxBytesPerSecond, "max-bytes-per-second", 0, "(sync mode only) maximum bytes of row values per second to read across all streams, 0 for no limit; can be set per stream with bytes-per-second metadata")
+	flag.BoolVar(&adaptiveThrottle, "adaptive-throttle", false, "(sync mode only) slow down and retry reads when a tablet reports that it is overloaded, instead of stopping the stream")
+	flag.StringVar(&streamOrder, "stream-order", internal.StreamOrderCatalog, "(sync mode only) order to sync streams in, one of catalog, smallest-first or a comma separated list of stream names")
+	flag.StringVar(&reportFilePath, "report-file", "", "(sync mode only) path to write a JSON summary of the sync to, the summary is written to stderr if empty")
+	flag.StringVar(&logFormat, "log-format", "text", "format of the status messages written to stderr, one of text, json")
+	flag.StringVar(&logLevel, "log-level", "info", "minimum level of the status messages written to stderr, one of debug, info, warn, error")
+	flag.StringVar(&traceExporter, "trace-exporter", "none", "where to export traces of this run, one of none, otlp, file")
+	flag.StringVar(&traceEndpoint, "trace-endpoint", "", "host:port of an OTLP gRPC collector, defaults to the OTEL_EXPORTER_OTLP_ENDPOINT environment variable")
+	flag.BoolVar(&traceInsecure, "trace-insecure", false, "disable TLS when exporting traces to an OTLP collector")
+	flag.StringVar(&traceFilePath, "trace-file", "", "path to write traces to when using the file trace exporter")
 
 	// variables for http commit mode
 	flag.BoolVar(&commitMode, "commit", false, "(sync mode only) Run this tap in commit mode, sends rows to Stitch Import API")
 	flag.StringVar(&singerAPIURL, "singer-api-url", "https://api.stitchdata.com", "(sync mode only) API Url for Singer")
 	flag.IntVar(&batchSize, "batch-size", 9000, "(sync mode only) size of each batch sent to Singer")
 	flag.StringVar(&apiToken, "singer-api-token", "", "(sync mode only) API Token to authenticate with Singer")
-	flag.StringVar(&stateDirectory, "state-directory", "", "(sync mode only) Directory to save any received state")
+	flag.StringVar(&stateDirectory, "state-directory", "", "(sync mode only) Directory to save any received state, same as --state-store with a directory")
+	flag.StringVar(&stateLocation, "state-store", "", "(sync mode only) where to save state, one of a directory, s3://bucket/prefix or mysql://dsn")
+	flag.IntVar(&stateKeepLast, "state-keep-last", 0, "(sync mode only) number of most recent state checkpoints to keep, all are kept if 0")
+	flag.DurationVar(&stateMaxAge, "state-max-age", 0, "(sync mode only) remove state checkpoints older than this, like 720h, they are kept forever if 0")
+	flag.StringVar(&rollbackTo, "rollback-to", "", "make the state checkpoint with this ID the latest, so that the next sync resumes from it")
+
+	// variables for verify mode
+	flag.BoolVar(&verifyMode, "verify", false, "Run this tap in verify mode, prints row counts and checksums of the selected streams in the catalog")
+	flag.StringVar(&verifyExports, "verify-export", "", "(verify mode only) comma separated list of files with messages written by this tap to compare against")
+	flag.IntVar(&verifyChunkSize, "verify-chunk-size", internal.DefaultVerifyChunkSize, "(verify mode only) number of rows, in primary key order, covered by each checksum")
 }
 
 func main() {
 	flag.Parse()
 	var recordWriter internal.RecordWriter
-	logger := internal.NewLogger("PlanetScale Tap", os.Stdout, os.Stderr)
+	format, err := internal.ParseLogFormat(logFormat)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	level, err := internal.ParseLogLevel(logLevel)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	logger := internal.NewStructuredLogger("PlanetScale Tap", os.Stdout, os.Stderr, format, level)
+	if len(stateLocation) == 0 {
+		stateLocation = stateDirectory
+	}
+	var stateStore internal.StateStore
+	if len(stateLocation) > 0 {
+		stateStore, err = internal.NewStateStore(stateLocation)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+	}
+
+	if len(rollbackTo) > 0 {
+		err := rollback(context.Background(), logger, stateStore, rollbackTo)
+		closeStateStore(logger, stateStore)
+		if err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+
 	if commitMode {
 		if len(apiToken) == 0 {
 			fmt.Println("Commit mode requires an apiToken, please provide a valid apiToken with the --api-token flag")
 			os.Exit(1)
 		}
 
-		if len(stateDirectory) == 0 {
-			fmt.Println("Commit mode requires a directory to store generated state files, please provide a valid path with the --state-directory flag")
+		if stateStore == nil {
+			fmt.Println("Commit mode requires a location to store generated state, please provide a valid location with the --state-store or --state-directory flag")
 			os.Exit(1)
 		}
 
-		recordWriter = internal.NewHttpRecordWriter(batchSize, singerAPIURL, apiToken, stateDirectory, logger)
+		retention := internal.StateRetention{
+			KeepLast: stateKeepLast,
+			MaxAge:   stateMaxAge,
+		}
+		// the writer outlives the sync, so that the last state is still saved once the sync is shut down.
+		recordWriter = internal.NewHttpRecordWriter(context.Background(), batchSize, singerAPIURL, apiToken, stateStore, retention, logger)
 	} else {
 		recordWriter = logger
 	}
-	logger.Info(fmt.Sprintf("PlanetScale Singer Tap : version [%q], commit [%q], published on [%q]", version, commit, date))
+	logger.Info("PlanetScale Singer Tap", slog.String("version", version), slog.String("commit", commit), slog.String("date", date))
 	if useReplica && useReadOnly {
 		fmt.Println("Only one of use-replica, use-rdonly can be specified, please pick one of these two modes and try again")
 		os.Exit(1)
@@ -87,26 +196,47 @@ func main() {
 		tabletType = psdbconnect.TabletType_primary
 	}
 
-	err := execute(discoverMode, logger, configFilePath, catalogFilePath, stateFilePath, recordWriter, tabletType)
+	shutdownTracing, err := internal.SetupTracing(context.Background(), internal.TracingSettings{
+		Exporter:       internal.TraceExporter(traceExporter),
+		Endpoint:       traceEndpoint,
+		Insecure:       traceInsecure,
+		FilePath:       traceFilePath,
+		ServiceVersion: version,
+	})
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	if !commitMode {
+		// state is only saved to the store in commit mode.
+		closeStateStore(logger, stateStore)
+		stateStore = nil
+	}
+	err = execute(discoverMode, logger, configFilePath, catalogFilePath, stateFilePath, stateStore, recordWriter, tabletType)
+	closeStateStore(logger, stateStore)
+	if sErr := shutdownTracing(context.Background()); sErr != nil {
+		logger.Warn("unable to flush traces", slog.String(internal.ErrorKey, sErr.Error()))
+	}
 	if err != nil {
 		logger.Error(err.Error())
 		os.Exit(1)
 	}
 }
 
-func execute(discoverMode bool, logger internal.Logger, configFilePath, catalogFilePath, stateFilePath string, recordWriter internal.RecordWriter, tabletType psdbconnect.TabletType) error {
+func execute(discoverMode bool, logger internal.Logger, configFilePath, catalogFilePath, stateFilePath string, stateStore internal.StateStore, recordWriter internal.RecordWriter, tabletType psdbconnect.TabletType) error {
 	var (
-		sourceConfig internal.PlanetScaleSource
-		catalog      internal.Catalog
-		state        *internal.State
-		err          error
+		sources []internal.NamedSource
+		catalog internal.Catalog
+		state   *internal.State
+		err     error
 	)
 
 	if len(configFilePath) == 0 {
 		return errors.New("Please specify path to a valid configuration file with the --config flag")
 	}
 
-	sourceConfig, err = internal.Parse(configFilePath, sourceConfig)
+	sources, err = internal.ParseSources(configFilePath)
 	if err != nil {
 		return fmt.Errorf("config file contents are invalid: %q", err)
 	}
@@ -119,11 +249,14 @@ func execute(discoverMode bool, logger internal.Logger, configFilePath, catalogF
 			TreatTinyIntAsBoolean: treatTinyIntAsBoolean,
 		}
 
+		if len(includedTables) > 0 {
+			settings.IncludedTables = strings.Split(includedTables, ",")
+		}
 		if len(excludedTables) > 0 {
 			settings.ExcludedTables = strings.Split(excludedTables, ",")
 		}
 
-		return discover(context.Background(), logger, sourceConfig, settings)
+		return discover(context.Background(), logger, sources, settings)
 	}
 
 	if len(catalogFilePath) == 0 {
@@ -135,40 +268,335 @@ func execute(discoverMode bool, logger internal.Logger, configFilePath, catalogF
 		return fmt.Errorf("catalog file contents are invalid: %q", err)
 	}
 
+	if verifyMode {
+		logger.Info("running in verify mode")
+		settings := internal.VerifySettings{
+			ChunkSize: verifyChunkSize,
+		}
+
+		if len(verifyExports) > 0 {
+			settings.ExportPaths = strings.Split(verifyExports, ",")
+		}
+
+		return forEachSource(sources, catalog, func(source internal.PlanetScaleSource, catalog internal.Catalog) error {
+			return verify(context.Background(), logger, source, catalog, settings)
+		})
+	}
+
+	if sampleRows > 0 {
+		logger.Info("running in sample mode", slog.Int("rows", sampleRows))
+		return forEachSource(sources, catalog, func(source internal.PlanetScaleSource, catalog internal.Catalog) error {
+			return sample(context.Background(), logger, source, catalog, internal.SampleSettings{Rows: sampleRows})
+		})
+	}
+
+	if stateStore != nil {
+		ctx := context.Background()
+		if err := stateStore.Lock(ctx); err != nil {
+			return err
+		}
+		defer func() {
+			if err := stateStore.Unlock(ctx); err != nil {
+				logger.Warn("unable to unlock state", slog.String("location", stateStore.String()), slog.String(internal.ErrorKey, err.Error()))
+			}
+		}()
+	}
+
 	if len(stateFilePath) > 0 {
 		state, err = internal.ParseSavedState(stateFilePath)
 		if err != nil {
 			return fmt.Errorf("state file contents are invalid: %q", err)
 		}
+	} else if stateStore != nil {
+		var checkpoint *internal.Checkpoint
+		state, checkpoint, err = internal.LatestState(context.Background(), stateStore)
+		if err != nil {
+			return errors.Wrap(err, "unable to load latest state")
+		}
+		if checkpoint != nil {
+			logger.Info("resuming from saved state", slog.String("location", stateStore.String()), slog.String("checkpoint", checkpoint.ID))
+		}
+	}
+
+	settings := internal.SyncSettings{
+		TabletType:         tabletType,
+		CheckpointRows:     checkpointRows,
+		CheckpointInterval: checkpointInterval,
+		StreamOrder:        streamOrder,
+		ConsistentSnapshot: consistentSnapshot,
+		Continuous:         continuous,
+		HeartbeatInterval:  heartbeatInterval,
+		StartFrom:          startFrom,
+		CopyChunks:         copyChunks,
+		MaxReplicaLag:      maxReplicaLag,
+		ReplicaLagWait:     replicaLagWait,
+		ReplicaLagFallback: replicaLagFallback,
+	}
+	if len(resnapshot) > 0 {
+		settings.Resnapshot = strings.Split(resnapshot, ",")
+	}
+
+	ctx := context.Background()
+	if continuous {
+		// streams are read continuously until the tap is stopped, so a source would never finish for the next one to start.
+		if internal.IsMultiSource(sources) {
+			return errors.New("continuous mode cannot be used with a config that lists sources")
+		}
+		// stop reading on a signal, the records read so far are flushed and the state is emitted.
+		var stop context.CancelFunc
+		ctx, stop = signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		if len(healthAddress) > 0 {
+			settings.Health = internal.NewHealth()
+			shutdownHealth := serveHealth(logger, healthAddress, settings.Health)
+			defer shutdownHealth()
+		}
+	}
+
+	return sync(ctx, logger, sources, catalog, state, recordWriter, settings)
+}
+
+// forEachSource calls fn with every source in the config and the streams of the catalog that are read from it.
+func forEachSource(sources []internal.NamedSource, catalog internal.Catalog, fn func(source internal.PlanetScaleSource, catalog internal.Catalog) error) error {
+	if !internal.IsMultiSource(sources) {
+		return fn(sources[0].PlanetScaleSource, catalog)
+	}
+
+	catalogs, err := internal.SplitCatalog(catalog, sources)
+	if err != nil {
+		return err
+	}
+	for _, source := range sources {
+		if err := fn(source.PlanetScaleSource, catalogs[source.Name]); err != nil {
+			return errors.Wrapf(err, "source %v", source.Name)
+		}
+	}
+	return nil
+}
+
+// sync reads the selected streams of every source in turn, with the same limits on how fast rows are read.
+// When the config lists sources, the state of each source is kept apart in the state of all sources.
+func sync(ctx context.Context, logger internal.Logger, sources []internal.NamedSource, catalog internal.Catalog, state *internal.State, recordWriter internal.RecordWriter, settings internal.SyncSettings) error {
+	throttle := internal.NewThrottle(internal.ThrottleSettings{
+		RowsPerSecond:  maxRowsPerSecond,
+		BytesPerSecond: maxBytesPerSecond,
+		Adaptive:       adaptiveThrottle,
+	})
+
+	if !internal.IsMultiSource(sources) {
+		report, err := syncSource(ctx, logger, sources[0].PlanetScaleSource, catalog, state, recordWriter, settings, throttle)
+		if rErr := writeReport(report); rErr != nil {
+			logger.Error("unable to write sync report", slog.String(internal.ErrorKey, rErr.Error()))
+		}
+		return err
+	}
+
+	catalogs, err := internal.SplitCatalog(catalog, sources)
+	if err != nil {
+		return err
+	}
+	if state == nil {
+		state = &internal.State{}
+	}
+	if state.Streams == nil {
+		state.Streams = map[string]internal.ShardStates{}
+	}
+
+	report := internal.NewSyncReport()
+	for _, source := range sources {
+		logger.Info("syncing source", slog.String("source", source.Name))
+		var sourceReport *internal.SyncReport
+		sourceReport, err = syncSource(ctx, logger, source.PlanetScaleSource, catalogs[source.Name], state.Sources[source.Name],
+			internal.NewSourceStateWriter(recordWriter, state, source.Name), settings, throttle)
+		if sourceReport != nil {
+			report.Streams = append(report.Streams, sourceReport.Streams...)
+		}
+		if err != nil {
+			err = errors.Wrapf(err, "source %v", source.Name)
+			break
+		}
+	}
+	report.Finish(err)
+	if rErr := writeReport(report); rErr != nil {
+		logger.Error("unable to write sync report", slog.String(internal.ErrorKey, rErr.Error()))
+	}
+	return err
+}
+
+func syncSource(ctx context.Context, logger internal.Logger, source internal.PlanetScaleSource, catalog internal.Catalog, state *internal.State, recordWriter internal.RecordWriter, settings internal.SyncSettings, throttle *internal.Throttle) (*internal.SyncReport, error) {
+	logger.Info("Syncing records for PlanetScale database", slog.String("database", source.Database))
+	mysql, err := internal.NewMySQL(&source, psdbconnect.TabletType_primary)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create mysql connection")
+	}
+
+	route, err := internal.RouteTablets(ctx, mysql, source, settings.TabletType)
+	if err != nil {
+		mysql.Close()
+		return nil, errors.Wrap(err, "unable to pick tablets to read from")
+	}
+	settings.Route = &route
+	settings.Throttle = throttle
+	logger.Info("reading rows from tablets", slog.String(internal.TabletTypeKey, internal.TabletTypeToString(route.TabletType)), slog.Any(internal.CellsKey, route.Cells))
+	if route.TabletType != psdbconnect.TabletType_primary {
+		// rows that are selected are read from the same type of tablet as rows that are streamed,
+		// and from the primary tablet once replication lag makes a shard fall back to it.
+		primary := mysql
+		defer primary.Close()
+		settings.PrimaryMysql = primary
+		mysql, err = internal.NewMySQL(&source, route.TabletType)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to create mysql connection")
+		}
+	}
+	defer mysql.Close()
+	ped, err := internal.NewDatabase(source, mysql, logger, throttle)
+	if err != nil {
+		return nil, err
 	}
 
-	return sync(context.Background(), logger, sourceConfig, catalog, state, recordWriter, tabletType)
+	return internal.Sync(ctx, mysql, ped, logger, source, catalog, state, recordWriter, settings)
 }
 
-func sync(ctx context.Context, logger internal.Logger, source internal.PlanetScaleSource, catalog internal.Catalog, state *internal.State, recordWriter internal.RecordWriter, tabletType psdbconnect.TabletType) error {
-	logger.Info(fmt.Sprintf("Syncing records for PlanetScale database : %v", source.Database))
-	mysql, err := internal.NewMySQL(&source)
+// serveHealth serves the health of a sync at /healthz and returns a function that stops serving it.
+func serveHealth(logger internal.Logger, address string, health *internal.Health) func() {
+	mux := http.NewServeMux()
+	mux.Handle("/healthz", health)
+	server := &http.Server{Addr: address, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("unable to serve health", slog.String("address", address), slog.String(internal.ErrorKey, err.Error()))
+		}
+	}()
+	logger.Info("serving health", slog.String("address", address))
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(ctx)
+	}
+}
+
+func closeStateStore(logger internal.Logger, stateStore internal.StateStore) {
+	if stateStore == nil {
+		return
+	}
+	if err := stateStore.Close(); err != nil {
+		logger.Warn("unable to close state store", slog.String("location", stateStore.String()), slog.String(internal.ErrorKey, err.Error()))
+	}
+}
+
+func rollback(ctx context.Context, logger internal.Logger, stateStore internal.StateStore, id string) error {
+	if stateStore == nil {
+		return errors.New("Rolling back state requires a location where state is stored, please provide a valid location with the --state-store or --state-directory flag")
+	}
+
+	if err := stateStore.Lock(ctx); err != nil {
+		return err
+	}
+	defer func() {
+		if err := stateStore.Unlock(ctx); err != nil {
+			logger.Warn("unable to unlock state", slog.String("location", stateStore.String()), slog.String(internal.ErrorKey, err.Error()))
+		}
+	}()
+
+	checkpoint, err := internal.RollbackState(ctx, stateStore, id)
+	if err != nil {
+		return errors.Wrapf(err, "unable to roll back to checkpoint %v", id)
+	}
+	logger.Info("rolled back state", slog.String("location", stateStore.String()), slog.String("from", id), slog.String("checkpoint", checkpoint.ID))
+	return nil
+}
+
+func writeReport(report *internal.SyncReport) error {
+	if len(reportFilePath) > 0 {
+		return internal.WriteReportFile(reportFilePath, report)
+	}
+	return internal.WriteReport(os.Stderr, report)
+}
+
+func verify(ctx context.Context, logger internal.Logger, source internal.PlanetScaleSource, catalog internal.Catalog, settings internal.VerifySettings) error {
+	logger.Info("Verifying rows for PlanetScale database", slog.String("database", source.Database))
+	mysql, err := internal.NewMySQL(&source, psdbconnect.TabletType_primary)
 	if err != nil {
 		return errors.Wrap(err, "unable to create mysql connection")
 	}
 	defer mysql.Close()
-	ped := internal.NewEdge(mysql, logger)
 
-	return internal.Sync(ctx, mysql, ped, logger, source, catalog, state, recordWriter, tabletType)
+	report, err := internal.Verify(ctx, mysql, logger, source, catalog, settings)
+	if err != nil {
+		return errors.Wrap(err, "unable to verify rows for PlanetScale database")
+	}
+
+	if err := json.NewEncoder(os.Stdout).Encode(report); err != nil {
+		return errors.Wrap(err, "unable to write verification report")
+	}
+
+	if report.Compared && !report.Matched {
+		return errors.New("rows in the export do not match the PlanetScale database")
+	}
+	return nil
 }
 
-func discover(ctx context.Context, logger internal.Logger, source internal.PlanetScaleSource, settings internal.DiscoverSettings) error {
-	logger.Info(fmt.Sprintf("Discovering Schema for PlanetScale database : %v", source.Database))
-	mysql, err := internal.NewMySQL(&source)
+func sample(ctx context.Context, logger internal.Logger, source internal.PlanetScaleSource, catalog internal.Catalog, settings internal.SampleSettings) error {
+	logger.Info("Sampling records for PlanetScale database", slog.String("database", source.Database))
+	mysql, err := internal.NewMySQL(&source, psdbconnect.TabletType_primary)
 	if err != nil {
 		return errors.Wrap(err, "unable to create mysql connection")
 	}
 	defer mysql.Close()
 
-	catalog, err := internal.Discover(ctx, source, mysql, settings)
+	samples, err := internal.Sample(ctx, mysql, logger, source, catalog, settings)
 	if err != nil {
-		return errors.Wrap(err, "unable to discover schema for PlanetScale database")
+		return errors.Wrap(err, "unable to sample records for PlanetScale database")
 	}
 
+	failures := 0
+	for _, s := range samples {
+		failures += len(s.Failures)
+	}
+	if failures > 0 {
+		return fmt.Errorf("%v values could not be converted to the types in the catalog", failures)
+	}
+	return nil
+}
+
+// discover writes a single catalog with the streams of every source,
+// which are namespaced by source when the config lists sources.
+func discover(ctx context.Context, logger internal.Logger, sources []internal.NamedSource, settings internal.DiscoverSettings) error {
+	var catalogs []internal.Catalog
+	for _, source := range sources {
+		sourceCatalog, err := discoverSource(ctx, logger, source.PlanetScaleSource, settings)
+		if err != nil {
+			if internal.IsMultiSource(sources) {
+				return errors.Wrapf(err, "source %v", source.Name)
+			}
+			return err
+		}
+		if internal.IsMultiSource(sources) {
+			sourceCatalog = internal.NamespaceCatalog(source.Name, sourceCatalog)
+		}
+		catalogs = append(catalogs, sourceCatalog)
+	}
+
+	catalog, err := internal.MergeCatalogs(catalogs...)
+	if err != nil {
+		return err
+	}
 	return logger.Schema(catalog)
 }
+
+func discoverSource(ctx context.Context, logger internal.Logger, source internal.PlanetScaleSource, settings internal.DiscoverSettings) (internal.Catalog, error) {
+	logger.Info("Discovering Schema for PlanetScale database", slog.String("database", source.Database))
+	mysql, err := internal.NewMySQL(&source, psdbconnect.TabletType_primary)
+	if err != nil {
+		return internal.Catalog{}, errors.Wrap(err, "unable to create mysql connection")
+	}
+	defer mysql.Close()
+
+	catalog, err := internal.Discover(ctx, source, mysql, settings)
+	if err != nil {
+		return catalog, errors.Wrap(err, "unable to discover schema for PlanetScale database")
+	}
+	return catalog, nil
+}